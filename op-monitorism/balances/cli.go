@@ -2,36 +2,108 @@ package balances
 
 import (
 	"fmt"
+	"os"
+	"slices"
 	"strings"
+	"time"
 
 	opservice "github.com/ethereum-optimism/optimism/op-service"
 
 	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
 )
 
 const (
-	NodeURLFlagName  = "node.url"
-	AccountsFlagName = "accounts"
+	NodeURLFlagName       = "node.url"
+	NodeChainFlagName     = "node.chain"
+	AccountsFlagName      = "accounts"
+	ConfigFileFlagName    = "config.file"
+	BlockTagFlagName      = "block.tag"
+	BlockIntervalFlagName = "block.interval"
 )
 
+// Chain is a chain whose accounts are checked through its node
+type Chain struct {
+	Name    string `yaml:"name"`
+	NodeUrl string `yaml:"node_url"`
+}
+
+// CLIConfig is the config of the monitor, the config file only sets the chains and the accounts
 type CLIConfig struct {
-	NodeUrl  string
-	Accounts []Account
+	NodeUrl   string `yaml:"-"`
+	NodeChain string `yaml:"-"` // the name of the chain of `NodeUrl`, checked for the accounts without chains
+
+	// block mode, for the accounts with flows
+	BlockTag      string        `yaml:"-"`
+	BlockInterval time.Duration `yaml:"-"`
+
+	Chains   []Chain   `yaml:"chains"`
+	Accounts []Account `yaml:"accounts"`
 }
 
 func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
-	cfg := CLIConfig{NodeUrl: ctx.String(NodeURLFlagName)}
+	cfg := CLIConfig{
+		NodeUrl:       ctx.String(NodeURLFlagName),
+		NodeChain:     ctx.String(NodeChainFlagName),
+		BlockTag:      ctx.String(BlockTagFlagName),
+		BlockInterval: ctx.Duration(BlockIntervalFlagName),
+	}
+
+	// The accounts of the config file come first, the accounts of the flag are added to them.
+	if configFile := ctx.String(ConfigFileFlagName); configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse config file: %w", err)
+		}
+		chains := map[string]bool{cfg.NodeChain: true}
+		for _, chain := range cfg.Chains {
+			if chain.Name == "" || chain.NodeUrl == "" {
+				return cfg, fmt.Errorf("the chains require a name and a node_url")
+			}
+			if chains[chain.Name] {
+				return cfg, fmt.Errorf("duplicate chain %s", chain.Name)
+			}
+			chains[chain.Name] = true
+		}
+		for _, account := range cfg.Accounts {
+			if len(account.Nickname) == 0 {
+				return cfg, fmt.Errorf("nickname for %s not set", account.Address)
+			}
+			for _, chain := range account.Chains {
+				if !chains[chain] {
+					return cfg, fmt.Errorf("unknown chain %s of %s", chain, account.Nickname)
+				}
+			}
+			if account.Flows != nil {
+				if err := account.Flows.Validate(); err != nil {
+					return cfg, fmt.Errorf("invalid flows of %s: %w", account.Nickname, err)
+				}
+				if len(account.Chains) > 0 && !slices.Contains(account.Chains, cfg.NodeChain) {
+					return cfg, fmt.Errorf("the flows of %s are only processed on the chain %s of --%s", account.Nickname, cfg.NodeChain, NodeURLFlagName)
+				}
+			}
+			if account.Runway != nil {
+				if err := account.Runway.Validate(); err != nil {
+					return cfg, fmt.Errorf("invalid runway of %s: %w", account.Nickname, err)
+				}
+			}
+		}
+	}
+
 	accounts := ctx.StringSlice(AccountsFlagName)
-	if len(accounts) == 0 {
-		return cfg, fmt.Errorf("--%s must have at least one account", AccountsFlagName)
+	if len(accounts) == 0 && len(cfg.Accounts) == 0 {
+		return cfg, fmt.Errorf("--%s or --%s must have at least one account", AccountsFlagName, ConfigFileFlagName)
 	}
 
 	for _, account := range accounts {
 		split := strings.Split(account, ":")
-		if len(split) != 2 {
-			return cfg, fmt.Errorf("failed to parse `address:nickname`: %s", account)
+		if len(split) < 2 {
+			return cfg, fmt.Errorf("failed to parse `address:nickname[:token...]`: %s", account)
 		}
 
 		addr, nickname := split[0], split[1]
@@ -42,7 +114,15 @@ func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
 			return cfg, fmt.Errorf("nickname for %s not set", addr)
 		}
 
-		cfg.Accounts = append(cfg.Accounts, Account{common.HexToAddress(addr), nickname})
+		var tokens []common.Address
+		for _, token := range split[2:] {
+			if !common.IsHexAddress(token) {
+				return cfg, fmt.Errorf("token of %s is not a hex-encoded address: %s", nickname, token)
+			}
+			tokens = append(tokens, common.HexToAddress(token))
+		}
+
+		cfg.Accounts = append(cfg.Accounts, Account{Address: common.HexToAddress(addr), Nickname: nickname, Tokens: tokens})
 	}
 
 	return cfg, nil
@@ -56,11 +136,33 @@ func CLIFlags(envPrefix string) []cli.Flag {
 			Value:   "127.0.0.1:8545",
 			EnvVars: opservice.PrefixEnvVar(envPrefix, "NODE_URL"),
 		},
+		&cli.StringFlag{
+			Name:    NodeChainFlagName,
+			Usage:   "Name of the chain of --node.url, the `chain` label of the accounts without chains",
+			Value:   "default",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "NODE_CHAIN"),
+		},
 		&cli.StringSliceFlag{
-			Name:     AccountsFlagName,
-			Usage:    "One or multiples accounts formatted via `address:nickname`",
-			EnvVars:  opservice.PrefixEnvVar(envPrefix, "ACCOUNTS"),
-			Required: true,
+			Name:    AccountsFlagName,
+			Usage:   "One or multiples accounts formatted via `address:nickname[:token...]`, with the addresses of the ERC-20 tokens held by the account",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "ACCOUNTS"),
+		},
+		&cli.StringFlag{
+			Name:    BlockTagFlagName,
+			Usage:   "Block tag followed by the block mode (\"latest\", \"safe\" or \"finalized\")",
+			Value:   "latest",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "BLOCK_TAG"),
+		},
+		&cli.DurationFlag{
+			Name:    BlockIntervalFlagName,
+			Usage:   "Polling interval of the new blocks in block mode",
+			Value:   2 * time.Second,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "BLOCK_INTERVAL"),
+		},
+		&cli.StringFlag{
+			Name:    ConfigFileFlagName,
+			Usage:   "Path to a YAML config file containing the chains and the accounts, with their tokens and their runway",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "CONFIG_FILE"),
 		},
 	}
 }
@@ -0,0 +1,212 @@
+package balances
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// FlowConfig enables the per-block balance deltas of an account in block mode, the thresholds are in ETH and 0 disables them
+type FlowConfig struct {
+	MaxOutflow float64 `yaml:"max_outflow"` // alert when the ETH leaving the account in a single block exceeds it
+	MaxInflow  float64 `yaml:"max_inflow"`  // alert when the ETH received by the account in a single block exceeds it
+}
+
+// Validate ensures the flow config is usable
+func (c *FlowConfig) Validate() error {
+	if c.MaxOutflow < 0 || c.MaxInflow < 0 {
+		return fmt.Errorf("the flow thresholds can't be negative")
+	}
+	return nil
+}
+
+// Transfer is a change of the balance of an account attributed to a transaction
+type Transfer struct {
+	TxHash common.Hash
+	Amount *big.Int // positive for an inflow, negative for an outflow
+}
+
+// BlockFlows is the change of the balance of an account in a block
+type BlockFlows struct {
+	Delta     *big.Int   // the balance at the block minus the balance at its parent
+	Outflow   *big.Int   // the ETH that left the account
+	Inflow    *big.Int   // the ETH received by the account
+	Transfers []Transfer // the transfers of the transactions sent by or to the account
+	Residual  *big.Int   // the part of the delta not explained by the transfers, moved by internal calls
+}
+
+// computeFlows splits the delta of a balance into the transfers of the transactions and a residual. The outflows and the inflows are summed
+// separately, so an account drained and refilled in the same block shows both.
+func computeFlows(pre, post *big.Int, transfers []Transfer) BlockFlows {
+	flows := BlockFlows{
+		Delta:     new(big.Int).Sub(post, pre),
+		Outflow:   new(big.Int),
+		Inflow:    new(big.Int),
+		Transfers: transfers,
+	}
+	flows.Residual = new(big.Int).Set(flows.Delta)
+	for _, transfer := range transfers {
+		flows.Residual.Sub(flows.Residual, transfer.Amount)
+		if transfer.Amount.Sign() < 0 {
+			flows.Outflow.Sub(flows.Outflow, transfer.Amount)
+		} else {
+			flows.Inflow.Add(flows.Inflow, transfer.Amount)
+		}
+	}
+	if flows.Residual.Sign() < 0 {
+		flows.Outflow.Sub(flows.Outflow, flows.Residual)
+	} else {
+		flows.Inflow.Add(flows.Inflow, flows.Residual)
+	}
+	return flows
+}
+
+// txTransfer returns the change of the balance of `addr` made by a transaction sent by `from` in a block with the base fee `baseFee`: the value unless it
+// reverted, the fees paid by the sender and the mint of the deposits. The internal calls are not seen, they end up in the residual.
+func txTransfer(addr common.Address, tx *types.Transaction, from common.Address, receipt *types.Receipt, baseFee *big.Int) *big.Int {
+	amount := new(big.Int)
+	success := receipt.Status == types.ReceiptStatusSuccessful
+	if from == addr {
+		if tx.IsDepositTx() && tx.Mint() != nil {
+			amount.Add(amount, tx.Mint())
+		}
+		if success {
+			amount.Sub(amount, tx.Value())
+		}
+		if !tx.IsDepositTx() {
+			fee := new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), gasPrice(tx, receipt, baseFee))
+			if receipt.L1Fee != nil {
+				fee.Add(fee, receipt.L1Fee)
+			}
+			if receipt.BlobGasPrice != nil {
+				fee.Add(fee, new(big.Int).Mul(new(big.Int).SetUint64(receipt.BlobGasUsed), receipt.BlobGasPrice))
+			}
+			amount.Sub(amount, fee)
+		}
+	}
+	if tx.To() != nil && *tx.To() == addr && success {
+		amount.Add(amount, tx.Value())
+	}
+	return amount
+}
+
+// gasPrice returns the gas price paid by a transaction. Some providers omit the effectiveGasPrice of the receipts (e.g. the legacy receipts), it's then
+// computed from the base fee of the block, or is the gas price of the transaction before London.
+func gasPrice(tx *types.Transaction, receipt *types.Receipt, baseFee *big.Int) *big.Int {
+	if receipt.EffectiveGasPrice != nil {
+		return receipt.EffectiveGasPrice
+	}
+	if baseFee == nil {
+		return tx.GasPrice()
+	}
+	return new(big.Int).Add(baseFee, tx.EffectiveGasTipValue(baseFee))
+}
+
+// sender returns the sender of a transaction, the deposits carry their sender
+func (m *Monitor) sender(tx *types.Transaction) (common.Address, error) {
+	if tx.IsDepositTx() {
+		// Only the London signer of op-geth returns the sender of the deposits.
+		return types.NewLondonSigner(m.chainID).Sender(tx)
+	}
+	return types.Sender(types.LatestSignerForChainID(m.chainID), tx)
+}
+
+// processBlock computes the flows of the accounts of the block mode in the block. Every request is made before updating the metrics, as the
+// block is retried on error.
+func (m *Monitor) processBlock(block *types.Block, client *ethclient.Client) error {
+	ctx := context.Background()
+	if len(m.flowAccounts) == 0 || block.NumberU64() == 0 {
+		return nil
+	}
+
+	// The balances at the block and at its parent.
+	parent := new(big.Int).Sub(block.Number(), common.Big1)
+	batchElems := make([]rpc.BatchElem, 0, 2*len(m.flowAccounts))
+	for _, index := range m.flowAccounts {
+		for _, number := range []*big.Int{parent, block.Number()} {
+			batchElems = append(batchElems, rpc.BatchElem{
+				Method: "eth_getBalance",
+				Args:   []interface{}{m.accounts[index].Address, hexutil.EncodeBig(number)},
+				Result: new(hexutil.Big),
+			})
+		}
+	}
+	if err := client.Client().BatchCallContext(ctx, batchElems); err != nil {
+		return fmt.Errorf("failed getBalance batch request: %w", err)
+	}
+	for _, elem := range batchElems {
+		if elem.Error != nil {
+			return fmt.Errorf("failed to query balance: %w", elem.Error)
+		}
+	}
+
+	// The transfers of the transactions sent by or to the accounts.
+	watched := make(map[common.Address]bool)
+	for _, index := range m.flowAccounts {
+		watched[m.accounts[index].Address] = true
+	}
+	transfers := make(map[common.Address][]Transfer)
+	for _, tx := range block.Transactions() {
+		from, err := m.sender(tx)
+		if err != nil {
+			m.log.Warn("failed to find tx sender", "tx", tx.Hash(), "block", block.Number(), "err", err)
+			continue
+		}
+		var to common.Address
+		if tx.To() != nil {
+			to = *tx.To()
+		}
+		if !watched[from] && !watched[to] {
+			continue
+		}
+		receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to get transaction receipt: %w", err)
+		}
+		for _, addr := range []common.Address{from, to} {
+			if !watched[addr] || (addr == to && to == from) {
+				continue
+			}
+			if amount := txTransfer(addr, tx, from, receipt, block.BaseFee()); amount.Sign() != 0 {
+				transfers[addr] = append(transfers[addr], Transfer{TxHash: tx.Hash(), Amount: amount})
+			}
+		}
+	}
+
+	for i, index := range m.flowAccounts {
+		account := m.accounts[index]
+		pre := batchElems[2*i].Result.(*hexutil.Big).ToInt()
+		post := batchElems[2*i+1].Result.(*hexutil.Big).ToInt()
+		m.reportFlows(block, account, computeFlows(pre, post, transfers[account.Address]))
+	}
+	return nil
+}
+
+// reportFlows updates the metrics of the flows of an account and alerts on the thresholds
+func (m *Monitor) reportFlows(block *types.Block, account Account, flows BlockFlows) {
+	outflow, inflow := scaleAmount(flows.Outflow, EtherDecimals), scaleAmount(flows.Inflow, EtherDecimals)
+	m.blockOutflow.WithLabelValues(account.Address.String(), account.Nickname, m.nodeChain).Set(outflow)
+	m.blockInflow.WithLabelValues(account.Address.String(), account.Nickname, m.nodeChain).Set(inflow)
+
+	ctx := []interface{}{"address", account.Address, "nickname", account.Nickname, "chain", m.nodeChain, "block", block.Number(), "delta", flows.Delta, "outflow", outflow, "inflow", inflow, "residual", flows.Residual}
+	for _, transfer := range flows.Transfers {
+		ctx = append(ctx, "tx_"+transfer.TxHash.Hex(), transfer.Amount)
+	}
+	if account.Flows.MaxOutflow > 0 && outflow > account.Flows.MaxOutflow {
+		m.log.Warn("large outflow", append(ctx, "max", account.Flows.MaxOutflow)...)
+		m.largeOutflows.WithLabelValues(account.Address.String(), account.Nickname, m.nodeChain).Inc()
+	}
+	if account.Flows.MaxInflow > 0 && inflow > account.Flows.MaxInflow {
+		m.log.Warn("unexpected inflow", append(ctx, "max", account.Flows.MaxInflow)...)
+		m.unexpectedInflows.WithLabelValues(account.Address.String(), account.Nickname, m.nodeChain).Inc()
+	}
+	if flows.Delta.Sign() != 0 {
+		m.log.Debug("balance changed", ctx...)
+	}
+}
@@ -2,15 +2,23 @@ package balances
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"math/big"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/ethereum-optimism/optimism/op-service/client"
 	"github.com/ethereum-optimism/optimism/op-service/metrics"
 
+	"github.com/ethereum-optimism/monitorism/op-monitorism/processor"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
-	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -18,91 +26,421 @@ import (
 
 const (
 	MetricsNamespace = "balance_mon"
+
+	// EtherDecimals is the number of decimals of the native balances
+	EtherDecimals = 18
+
+	BalanceOfABI = "balanceOf(address)"
+	DecimalsABI  = "decimals()"
+)
+
+var (
+	BalanceOfSelector = crypto.Keccak256([]byte(BalanceOfABI))[:4]
+	DecimalsSelector  = crypto.Keccak256([]byte(DecimalsABI))[:4]
 )
 
 type Account struct {
-	Address  common.Address
-	Nickname string
+	Address  common.Address   `yaml:"address"`
+	Nickname string           `yaml:"nickname"`
+	Chains   []string         `yaml:"chains,omitempty"` // the chains where the account is checked, the chain of --node.url if empty
+	Tokens   []common.Address `yaml:"tokens,omitempty"` // the ERC-20 tokens held by the account, on each of its chains
+	Runway   *RunwayConfig    `yaml:"runway,omitempty"` // the burn rate and the runway of the ETH balance
+	Flows    *FlowConfig      `yaml:"flows,omitempty"`  // the per-block outflows and inflows, in block mode on the chain of --node.url
+}
+
+// chainClient checks the accounts of a chain
+type chainClient struct {
+	name     string
+	rpc      client.RPC
+	accounts []int // the indexes of the accounts checked on the chain
+
+	// decimals of the tokens, queried once
+	decimals map[common.Address]uint8
+}
+
+// accountKey identifies an account on a chain
+type accountKey struct {
+	chain   string
+	account int
 }
 
 type Monitor struct {
 	log log.Logger
 
-	rpc      client.RPC
+	chains   []*chainClient
 	accounts []Account
 
+	// balance histories and runway severities of the accounts with a runway
+	histories  map[accountKey]*balanceHistory
+	severities map[accountKey]string
+
+	// block mode, processing each block of the chain of --node.url for the accounts with flows
+	nodeChain    string
+	chainID      *big.Int
+	flowAccounts []int
+	processor    *processor.BlockProcessor
+	startOnce    sync.Once // the block processor is started by the first run
+
 	// metrics
 	balances            *prometheus.GaugeVec
+	totalBalances       *prometheus.GaugeVec
+	tokenBalances       *prometheus.GaugeVec
+	burnRate            *prometheus.GaugeVec
+	runway              *prometheus.GaugeVec
+	runwaySeverity      *prometheus.GaugeVec
+	blockOutflow        *prometheus.GaugeVec
+	blockInflow         *prometheus.GaugeVec
+	largeOutflows       *prometheus.CounterVec
+	unexpectedInflows   *prometheus.CounterVec
 	unexpectedRpcErrors *prometheus.CounterVec
 }
 
 func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIConfig) (*Monitor, error) {
 	log.Info("creating balance monitor")
-	rpc, err := client.NewRPC(ctx, log, cfg.NodeUrl)
-	if err != nil {
-		return nil, err
-	}
 
-	for _, account := range cfg.Accounts {
-		log.Info("configured account", "address", account.Address, "nickname", account.Nickname)
+	// Only the chains of the accounts are dialed, the chain of --node.url is used by the accounts without chains.
+	nodeUrls := map[string]string{cfg.NodeChain: cfg.NodeUrl}
+	for _, chain := range cfg.Chains {
+		nodeUrls[chain.Name] = chain.NodeUrl
+	}
+	var chains []*chainClient
+	chainsByName := make(map[string]*chainClient)
+	for i, account := range cfg.Accounts {
+		log.Info("configured account", "address", account.Address, "nickname", account.Nickname, "chains", account.Chains, "tokens", account.Tokens)
+		accountChains := account.Chains
+		if len(accountChains) == 0 {
+			accountChains = []string{cfg.NodeChain}
+		}
+		for _, name := range accountChains {
+			chain, ok := chainsByName[name]
+			if !ok {
+				nodeUrl, ok := nodeUrls[name]
+				if !ok {
+					return nil, fmt.Errorf("unknown chain %s of %s", name, account.Nickname)
+				}
+				rpc, err := client.NewRPC(ctx, log, nodeUrl)
+				if err != nil {
+					return nil, fmt.Errorf("failed to dial chain %s: %w", name, err)
+				}
+				chain = &chainClient{name: name, rpc: rpc, decimals: make(map[common.Address]uint8)}
+				chainsByName[name] = chain
+				chains = append(chains, chain)
+			}
+			if !slices.Contains(chain.accounts, i) {
+				chain.accounts = append(chain.accounts, i)
+			}
+		}
 	}
 
-	return &Monitor{
-		log:      log,
-		rpc:      rpc,
-		accounts: cfg.Accounts,
+	mon := &Monitor{
+		log:        log,
+		chains:     chains,
+		accounts:   cfg.Accounts,
+		histories:  make(map[accountKey]*balanceHistory),
+		severities: make(map[accountKey]string),
+		nodeChain:  cfg.NodeChain,
 
 		balances: m.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: MetricsNamespace,
 			Name:      "balances",
 			Help:      "balances held by accounts registered with the monitor",
-		}, []string{"address", "nickname"}),
+		}, []string{"address", "nickname", "chain"}),
+		totalBalances: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "total_balance",
+			Help:      "ETH balances held by the accounts of a nickname across all their chains",
+		}, []string{"nickname"}),
+		tokenBalances: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "token_balance",
+			Help:      "ERC-20 token balances held by accounts registered with the monitor, scaled by the decimals of the token",
+		}, []string{"address", "nickname", "token", "chain"}),
+		burnRate: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "burn_rate",
+			Help:      "ETH burned per second by the account over the window, the top-ups are ignored",
+		}, []string{"address", "nickname", "chain", "window"}),
+		runway: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "runway_seconds",
+			Help:      "seconds until the ETH balance of the account runs out at its highest burn rate",
+		}, []string{"address", "nickname", "chain"}),
+		runwaySeverity: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "runway_severity",
+			Help:      "1 if the runway of the account is below the threshold of the severity level, 0 otherwise",
+		}, []string{"address", "nickname", "chain", "severity"}),
+		blockOutflow: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "block_outflow",
+			Help:      "ETH that left the account in the last block processed",
+		}, []string{"address", "nickname", "chain"}),
+		blockInflow: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "block_inflow",
+			Help:      "ETH received by the account in the last block processed",
+		}, []string{"address", "nickname", "chain"}),
+		largeOutflows: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "large_outflows_total",
+			Help:      "number of blocks in which the outflow of the account exceeded its max_outflow",
+		}, []string{"address", "nickname", "chain"}),
+		unexpectedInflows: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "unexpected_inflows_total",
+			Help:      "number of blocks in which the inflow of the account exceeded its max_inflow",
+		}, []string{"address", "nickname", "chain"}),
 		unexpectedRpcErrors: m.NewCounterVec(prometheus.CounterOpts{
 			Namespace: MetricsNamespace,
 			Name:      "unexpectedRpcErrors",
 			Help:      "number of unexpected rpc errors",
 		}, []string{"section", "name"}),
-	}, nil
+	}
+
+	// The block mode only starts when an account of the chain of --node.url has flows.
+	nodeChain, ok := chainsByName[cfg.NodeChain]
+	if ok {
+		for _, index := range nodeChain.accounts {
+			if cfg.Accounts[index].Flows != nil {
+				mon.flowAccounts = append(mon.flowAccounts, index)
+			}
+		}
+	}
+	if len(mon.flowAccounts) > 0 {
+		var chainID hexutil.Big
+		if err := nodeChain.rpc.CallContext(ctx, &chainID, "eth_chainId"); err != nil {
+			return nil, fmt.Errorf("failed to get chain id: %w", err)
+		}
+		mon.chainID = chainID.ToInt()
+
+		proc, err := processor.NewBlockProcessor(m, log, cfg.NodeUrl, nil, mon.processBlock, nil, &processor.Config{
+			Interval: cfg.BlockInterval,
+			BlockTag: cfg.BlockTag,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create block processor: %w", err)
+		}
+		mon.processor = proc
+	}
+	return mon, nil
+}
+
+// tokenBalance is a token balance of an account queried by the batch
+type tokenBalance struct {
+	account Account
+	token   common.Address
 }
 
 func (m *Monitor) Run(ctx context.Context) {
+	if m.processor != nil {
+		m.startOnce.Do(func() {
+			go func() {
+				if err := m.processor.Start(); err != nil && !errors.Is(err, context.Canceled) {
+					m.log.Error("block processor error", "err", err)
+				}
+			}()
+		})
+	}
+
 	m.log.Info("querying balances...")
-	batchElems := make([]rpc.BatchElem, len(m.accounts))
-	for i := 0; i < len(m.accounts); i++ {
+	now := time.Now()
+
+	// The total of a nickname is only set when its balances were queried on every chain.
+	totals := make(map[string]*big.Int)
+	incomplete := make(map[string]bool)
+	for _, chain := range m.chains {
+		balances := m.queryChain(ctx, chain, now)
+		for _, i := range chain.accounts {
+			nickname := m.accounts[i].Nickname
+			balance, ok := balances[i]
+			if !ok {
+				incomplete[nickname] = true
+				continue
+			}
+			if totals[nickname] == nil {
+				totals[nickname] = new(big.Int)
+			}
+			totals[nickname].Add(totals[nickname], balance)
+		}
+	}
+	for nickname, total := range totals {
+		if incomplete[nickname] {
+			m.log.Warn("skipping total balance, a balance is missing", "nickname", nickname)
+			continue
+		}
+		m.totalBalances.WithLabelValues(nickname).Set(scaleAmount(total, EtherDecimals))
+	}
+}
+
+// queryChain queries the balances of the accounts of a chain and returns the ETH balances queried, by index of the account
+func (m *Monitor) queryChain(ctx context.Context, chain *chainClient, now time.Time) map[int]*big.Int {
+	m.queryDecimals(ctx, chain)
+
+	// The token balances are batched with the native balances, the tokens whose decimals are unknown are skipped until they are queried.
+	batchElems := make([]rpc.BatchElem, len(chain.accounts))
+	for i, index := range chain.accounts {
 		batchElems[i] = rpc.BatchElem{
 			Method: "eth_getBalance",
-			Args:   []interface{}{m.accounts[i].Address, "latest"},
+			Args:   []interface{}{m.accounts[index].Address, "latest"},
 			Result: new(hexutil.Big),
 		}
 	}
-	if err := m.rpc.BatchCallContext(ctx, batchElems); err != nil {
-		m.log.Error("failed getBalance batch request", "err", err)
+	var tokenBalances []tokenBalance
+	for _, index := range chain.accounts {
+		account := m.accounts[index]
+		for _, token := range account.Tokens {
+			if _, ok := chain.decimals[token]; !ok {
+				continue
+			}
+			data := append(append([]byte{}, BalanceOfSelector...), common.LeftPadBytes(account.Address.Bytes(), 32)...)
+			batchElems = append(batchElems, rpc.BatchElem{
+				Method: "eth_call",
+				Args:   []interface{}{map[string]interface{}{"to": token, "data": hexutil.Bytes(data)}, "latest"},
+				Result: new(hexutil.Bytes),
+			})
+			tokenBalances = append(tokenBalances, tokenBalance{account, token})
+		}
+	}
+	if err := chain.rpc.BatchCallContext(ctx, batchElems); err != nil {
+		m.log.Error("failed getBalance batch request", "chain", chain.name, "err", err)
 		m.unexpectedRpcErrors.WithLabelValues("balances", "batched_getBalance").Inc()
-		return
+		return nil
 	}
 
-	for i := 0; i < len(m.accounts); i++ {
-		account := m.accounts[i]
+	balances := make(map[int]*big.Int)
+	for i, index := range chain.accounts {
+		account := m.accounts[index]
 		if batchElems[i].Error != nil {
-			m.log.Error("failed to query account balance", "address", account.Address, "nickname", account.Nickname, "err", batchElems[i].Error)
+			m.log.Error("failed to query account balance", "address", account.Address, "nickname", account.Nickname, "chain", chain.name, "err", batchElems[i].Error)
 			m.unexpectedRpcErrors.WithLabelValues("balances", "getBalance").Inc()
 			continue
 		}
 
-		ethBalance := weiToEther((batchElems[i].Result).(*hexutil.Big).ToInt())
-		m.balances.WithLabelValues(account.Address.String(), account.Nickname).Set(ethBalance)
-		m.log.Info("set balance", "address", account.Address, "nickname", account.Nickname, "balance", ethBalance)
+		weiBalance := (batchElems[i].Result).(*hexutil.Big).ToInt()
+		balances[index] = weiBalance
+		ethBalance := scaleAmount(weiBalance, EtherDecimals)
+		m.balances.WithLabelValues(account.Address.String(), account.Nickname, chain.name).Set(ethBalance)
+		m.log.Info("set balance", "address", account.Address, "nickname", account.Nickname, "chain", chain.name, "balance", ethBalance)
+		if account.Runway != nil {
+			m.updateRunway(accountKey{chain.name, index}, account, weiBalance, now)
+		}
+	}
+
+	for i, tb := range tokenBalances {
+		elem := batchElems[len(chain.accounts)+i]
+		result := *(elem.Result).(*hexutil.Bytes)
+		if elem.Error != nil || len(result) != 32 {
+			m.log.Error("failed to query token balance", "address", tb.account.Address, "nickname", tb.account.Nickname, "chain", chain.name, "token", tb.token, "err", elem.Error)
+			m.unexpectedRpcErrors.WithLabelValues("balances", BalanceOfABI).Inc()
+			continue
+		}
+
+		balance := scaleAmount(new(big.Int).SetBytes(result), chain.decimals[tb.token])
+		m.tokenBalances.WithLabelValues(tb.account.Address.String(), tb.account.Nickname, tb.token.String(), chain.name).Set(balance)
+		m.log.Info("set token balance", "address", tb.account.Address, "nickname", tb.account.Nickname, "chain", chain.name, "token", tb.token, "balance", balance)
+	}
+	return balances
+}
+
+// queryDecimals queries the decimals of the tokens of a chain that are not known yet in a single batch
+func (m *Monitor) queryDecimals(ctx context.Context, chain *chainClient) {
+	var tokens []common.Address
+	var batchElems []rpc.BatchElem
+	for _, index := range chain.accounts {
+		for _, token := range m.accounts[index].Tokens {
+			if _, ok := chain.decimals[token]; ok || slices.Contains(tokens, token) {
+				continue
+			}
+			tokens = append(tokens, token)
+			batchElems = append(batchElems, rpc.BatchElem{
+				Method: "eth_call",
+				Args:   []interface{}{map[string]interface{}{"to": token, "data": hexutil.Bytes(DecimalsSelector)}, "latest"},
+				Result: new(hexutil.Bytes),
+			})
+		}
+	}
+	if len(batchElems) == 0 {
+		return
+	}
+	if err := chain.rpc.BatchCallContext(ctx, batchElems); err != nil {
+		m.log.Error("failed decimals batch request", "chain", chain.name, "err", err)
+		m.unexpectedRpcErrors.WithLabelValues("balances", "batched_decimals").Inc()
+		return
+	}
+
+	for i, token := range tokens {
+		result := *(batchElems[i].Result).(*hexutil.Bytes)
+		if batchElems[i].Error != nil || len(result) != 32 || new(big.Int).SetBytes(result).Cmp(big.NewInt(255)) > 0 {
+			m.log.Error("failed to query token decimals", "chain", chain.name, "token", token, "err", batchElems[i].Error)
+			m.unexpectedRpcErrors.WithLabelValues("balances", DecimalsABI).Inc()
+			continue
+		}
+		chain.decimals[token] = uint8(new(big.Int).SetBytes(result).Uint64())
+		m.log.Info("token decimals", "chain", chain.name, "token", token, "decimals", chain.decimals[token])
+	}
+}
+
+// updateRunway records the balance of the account and updates its burn rates, its runway and its severity
+func (m *Monitor) updateRunway(key accountKey, account Account, balance *big.Int, now time.Time) {
+	history, ok := m.histories[key]
+	if !ok {
+		history = &balanceHistory{}
+		m.histories[key] = history
+	}
+	history.add(now, balance, account.Runway.maxWindow())
+
+	// The runway is projected at the highest burn rate of the windows.
+	var highest *big.Float
+	for _, window := range account.Runway.Windows {
+		rate, ok := history.burnRate(now, window)
+		if !ok {
+			continue
+		}
+		etherRate, _ := new(big.Float).Quo(rate, big.NewFloat(math.Pow10(EtherDecimals))).Float64()
+		m.burnRate.WithLabelValues(account.Address.String(), account.Nickname, key.chain, window.String()).Set(etherRate)
+		if highest == nil || rate.Cmp(highest) > 0 {
+			highest = rate
+		}
+	}
+	if highest == nil {
+		return
+	}
+
+	remaining := runway(balance, highest)
+	runwaySeconds := math.Inf(1)
+	if remaining < time.Duration(math.MaxInt64) {
+		runwaySeconds = remaining.Seconds()
+	}
+	m.runway.WithLabelValues(account.Address.String(), account.Nickname, key.chain).Set(runwaySeconds)
+
+	severity := account.Runway.Severity(remaining)
+	for _, level := range account.Runway.Levels {
+		active := 0.0
+		if level.Severity == severity {
+			active = 1
+		}
+		m.runwaySeverity.WithLabelValues(account.Address.String(), account.Nickname, key.chain, level.Severity).Set(active)
+	}
+	if severity != m.severities[key] {
+		m.log.Warn("runway severity changed", "address", account.Address, "nickname", account.Nickname, "chain", key.chain, "severity", severity, "previous", m.severities[key], "runway", remaining)
+		m.severities[key] = severity
 	}
 }
 
 func (m *Monitor) Close(_ context.Context) error {
-	m.rpc.Close()
+	if m.processor != nil {
+		m.processor.Stop()
+	}
+	for _, chain := range m.chains {
+		chain.rpc.Close()
+	}
 	return nil
 }
 
-func weiToEther(wei *big.Int) float64 {
-	num := new(big.Rat).SetInt(wei)
-	denom := big.NewRat(params.Ether, 1)
+// scaleAmount converts an amount in the smallest unit of an asset with `decimals` decimals to a float for the metrics
+func scaleAmount(amount *big.Int, decimals uint8) float64 {
+	num := new(big.Rat).SetInt(amount)
+	denom := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
 	num = num.Quo(num, denom)
 	f, _ := num.Float64()
 	return f
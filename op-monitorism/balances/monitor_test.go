@@ -0,0 +1,256 @@
+package balances
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-service/client"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	account = common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	usdc    = common.HexToAddress("0x0b2C639c533813f4Aa9D7837CAf62653d097Ff85")
+	op      = common.HexToAddress("0x4200000000000000000000000000000000000042")
+)
+
+type callArgs struct {
+	To   common.Address `json:"to"`
+	Data hexutil.Bytes  `json:"data"`
+}
+
+// ethService serves the balances and the calls to the tokens
+type ethService struct {
+	balances      map[common.Address]*big.Int
+	tokenBalances map[common.Address]*big.Int
+	decimals      map[common.Address]uint8
+	decimalsCalls int
+	fail          bool
+}
+
+func (s *ethService) GetBalance(addr common.Address, block string) (*hexutil.Big, error) {
+	if s.fail {
+		return nil, fmt.Errorf("node unavailable")
+	}
+	return (*hexutil.Big)(s.balances[addr]), nil
+}
+
+func (s *ethService) Call(args callArgs, block string) (hexutil.Bytes, error) {
+	switch {
+	case bytes.Equal(args.Data, DecimalsSelector):
+		s.decimalsCalls++
+		decimals, ok := s.decimals[args.To]
+		if !ok {
+			return nil, fmt.Errorf("execution reverted")
+		}
+		return common.LeftPadBytes([]byte{decimals}, 32), nil
+	case bytes.HasPrefix(args.Data, BalanceOfSelector):
+		return common.LeftPadBytes(s.tokenBalances[args.To].Bytes(), 32), nil
+	}
+	return nil, fmt.Errorf("unexpected call")
+}
+
+// newTestMonitor builds a monitor checking the accounts on the chains served by the services, the accounts without chains are checked on the `default` chain
+func newTestMonitor(t *testing.T, services map[string]*ethService, accounts ...Account) *Monitor {
+	monitor := &Monitor{
+		log:                 log.New(),
+		accounts:            accounts,
+		histories:           make(map[accountKey]*balanceHistory),
+		severities:          make(map[accountKey]string),
+		balances:            prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "balances"}, []string{"address", "nickname", "chain"}),
+		totalBalances:       prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "total_balance"}, []string{"nickname"}),
+		tokenBalances:       prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "token_balance"}, []string{"address", "nickname", "token", "chain"}),
+		burnRate:            prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "burn_rate"}, []string{"address", "nickname", "chain", "window"}),
+		runway:              prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "runway_seconds"}, []string{"address", "nickname", "chain"}),
+		runwaySeverity:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "runway_severity"}, []string{"address", "nickname", "chain", "severity"}),
+		unexpectedRpcErrors: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "unexpectedRpcErrors"}, []string{"section", "name"}),
+	}
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		server := rpc.NewServer()
+		require.NoError(t, server.RegisterName("eth", services[name]))
+		chain := &chainClient{name: name, rpc: client.NewBaseRPCClient(rpc.DialInProc(server)), decimals: make(map[common.Address]uint8)}
+		for i, account := range accounts {
+			if slices.Contains(account.Chains, name) || (len(account.Chains) == 0 && name == "default") {
+				chain.accounts = append(chain.accounts, i)
+			}
+		}
+		monitor.chains = append(monitor.chains, chain)
+	}
+	return monitor
+}
+
+func TestTokenBalances(t *testing.T) {
+	usdcBalance, _ := new(big.Int).SetString("1500000", 10)
+	opBalance, _ := new(big.Int).SetString("2500000000000000000", 10)
+	broken := common.HexToAddress("0x01")
+	svc := &ethService{
+		balances:      map[common.Address]*big.Int{account: big.NewInt(5e17)},
+		tokenBalances: map[common.Address]*big.Int{usdc: usdcBalance, op: opBalance},
+		decimals:      map[common.Address]uint8{usdc: 6, op: 18},
+	}
+	monitor := newTestMonitor(t, map[string]*ethService{"default": svc}, Account{Address: account, Nickname: "batcher", Tokens: []common.Address{usdc, op, broken}})
+
+	monitor.Run(context.Background())
+	require.Equal(t, 0.5, testutil.ToFloat64(monitor.balances.WithLabelValues(account.String(), "batcher", "default")))
+	require.Equal(t, 1.5, testutil.ToFloat64(monitor.tokenBalances.WithLabelValues(account.String(), "batcher", usdc.String(), "default")))
+	require.Equal(t, 2.5, testutil.ToFloat64(monitor.tokenBalances.WithLabelValues(account.String(), "batcher", op.String(), "default")))
+	require.Equal(t, 1, testutil.CollectAndCount(monitor.unexpectedRpcErrors), "the token without decimals is skipped")
+
+	// The decimals are only queried again for the tokens that failed.
+	monitor.Run(context.Background())
+	require.Equal(t, 4, svc.decimalsCalls)
+	require.Equal(t, float64(2), testutil.ToFloat64(monitor.unexpectedRpcErrors.WithLabelValues("balances", DecimalsABI)))
+}
+
+func TestConfigFile(t *testing.T) {
+	cfg := CLIConfig{NodeUrl: "http://localhost:8545", NodeChain: "op", BlockTag: "safe", BlockInterval: time.Second}
+	data := "nodeurl: http://attacker:8545\nnodechain: l1\nblocktag: latest\nblockinterval: 1h\nchains: [{name: l1, node_url: http://l1:8545}]\naccounts: [{address: " + account.Hex() + ", nickname: batcher}]\n"
+	require.NoError(t, yaml.Unmarshal([]byte(data), &cfg))
+	require.Equal(t, CLIConfig{
+		NodeUrl:       "http://localhost:8545",
+		NodeChain:     "op",
+		BlockTag:      "safe",
+		BlockInterval: time.Second,
+		Chains:        []Chain{{Name: "l1", NodeUrl: "http://l1:8545"}},
+		Accounts:      []Account{{Address: account, Nickname: "batcher"}},
+	}, cfg, "the flags can't be overridden by the config file")
+}
+
+func TestMultiChainBalances(t *testing.T) {
+	other := common.HexToAddress("0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC")
+	l1 := &ethService{balances: map[common.Address]*big.Int{account: big.NewInt(1e18)}}
+	l2 := &ethService{balances: map[common.Address]*big.Int{account: big.NewInt(2e18), other: big.NewInt(5e17)}}
+	monitor := newTestMonitor(t, map[string]*ethService{"l1": l1, "op": l2},
+		Account{Address: account, Nickname: "batcher", Chains: []string{"l1", "op"}},
+		Account{Address: other, Nickname: "batcher", Chains: []string{"op"}},
+		Account{Address: other, Nickname: "proposer", Chains: []string{"base"}},
+	)
+
+	monitor.Run(context.Background())
+	require.Equal(t, 1.0, testutil.ToFloat64(monitor.balances.WithLabelValues(account.String(), "batcher", "l1")))
+	require.Equal(t, 2.0, testutil.ToFloat64(monitor.balances.WithLabelValues(account.String(), "batcher", "op")))
+	require.Equal(t, 3.5, testutil.ToFloat64(monitor.totalBalances.WithLabelValues("batcher")), "the total sums the accounts of the nickname on every chain")
+	require.Equal(t, 1, testutil.CollectAndCount(monitor.totalBalances), "the proposer isn't checked on any served chain")
+
+	// The total isn't updated when a balance is missing.
+	l1.fail = true
+	l2.balances[other] = big.NewInt(1e18)
+	monitor.Run(context.Background())
+	require.Equal(t, 1.0, testutil.ToFloat64(monitor.balances.WithLabelValues(other.String(), "batcher", "op")))
+	require.Equal(t, 3.5, testutil.ToFloat64(monitor.totalBalances.WithLabelValues("batcher")))
+}
+
+func TestBurnRate(t *testing.T) {
+	ether := func(amount float64) *big.Int {
+		wei, _ := new(big.Float).Mul(big.NewFloat(amount), big.NewFloat(1e18)).Int(nil)
+		return wei
+	}
+	start := time.Unix(1700000000, 0)
+	history := &balanceHistory{}
+	_, ok := history.burnRate(start, time.Hour)
+	require.False(t, ok)
+
+	// 2 ether burned in 3 hours, with a top-up of 4 ether.
+	for i, balance := range []float64{10, 9, 13, 12} {
+		history.add(start.Add(time.Duration(i)*time.Hour), ether(balance), 24*time.Hour)
+	}
+	now := start.Add(3 * time.Hour)
+	rate, ok := history.burnRate(now, 24*time.Hour)
+	require.True(t, ok)
+	perHour, _ := new(big.Float).Mul(rate, big.NewFloat(3600)).Float64()
+	require.InDelta(t, 2e18/3, perHour, 1e3)
+	require.Equal(t, 18*time.Hour, runway(ether(12), rate).Round(time.Second))
+
+	rate, ok = history.burnRate(now, time.Hour)
+	require.True(t, ok, "the window holds the last two samples")
+	perHour, _ = new(big.Float).Mul(rate, big.NewFloat(3600)).Float64()
+	require.InDelta(t, 1e18, perHour, 1e3)
+
+	// Nothing is burned by a top-up.
+	topUp := &balanceHistory{}
+	topUp.add(start, ether(9), time.Hour)
+	topUp.add(start.Add(time.Minute), ether(13), time.Hour)
+	rate, ok = topUp.burnRate(start.Add(time.Minute), time.Hour)
+	require.True(t, ok)
+	require.Equal(t, time.Duration(math.MaxInt64), runway(ether(13), rate))
+
+	// The samples older than the longest window are forgotten.
+	history.add(start.Add(30*time.Hour), ether(12), 24*time.Hour)
+	require.Len(t, history.samples, 1)
+}
+
+func TestRunwaySeverity(t *testing.T) {
+	config := &RunwayConfig{
+		Windows: []time.Duration{time.Hour},
+		Levels:  []RunwayLevel{{Severity: "warning", Below: 72 * time.Hour}, {Severity: "critical", Below: 24 * time.Hour}},
+	}
+	require.NoError(t, config.Validate())
+	require.Equal(t, "", config.Severity(100*time.Hour))
+	require.Equal(t, "warning", config.Severity(48*time.Hour))
+	require.Equal(t, "critical", config.Severity(10*time.Hour))
+
+	require.Error(t, (&RunwayConfig{}).Validate(), "a window is required")
+	config.Levels = append(config.Levels, RunwayLevel{Severity: "warning", Below: time.Hour})
+	require.Error(t, config.Validate(), "duplicate severity")
+}
+
+func TestBlockFlows(t *testing.T) {
+	other := common.HexToAddress("0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC")
+	success := &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: 21000, EffectiveGasPrice: big.NewInt(1e9), L1Fee: big.NewInt(1000)}
+	reverted := &types.Receipt{Status: types.ReceiptStatusFailed, GasUsed: 50000, EffectiveGasPrice: big.NewInt(1e9)}
+	send := types.NewTx(&types.DynamicFeeTx{To: &other, Value: big.NewInt(5e18)})
+	refill := types.NewTx(&types.DynamicFeeTx{To: &account, Value: big.NewInt(4e18)})
+	deposit := types.NewTx(&types.DepositTx{From: account, To: &other, Mint: big.NewInt(3e18), Value: big.NewInt(1e18)})
+
+	fee := big.NewInt(21000*1e9 + 1000)
+	require.Equal(t, new(big.Int).Neg(new(big.Int).Add(big.NewInt(5e18), fee)), txTransfer(account, send, account, success, nil))
+	require.Equal(t, big.NewInt(-50000*1e9), txTransfer(account, send, account, reverted, nil), "only the fee is paid when the transaction reverts")
+	require.Equal(t, big.NewInt(4e18), txTransfer(account, refill, other, success, nil))
+	require.Equal(t, big.NewInt(0), txTransfer(account, refill, other, reverted, nil))
+	require.Equal(t, big.NewInt(2e18), txTransfer(account, deposit, account, success, nil), "the mint of the deposit minus its value")
+
+	// Without the effectiveGasPrice in the receipt, the gas price is computed from the base fee, or read from a legacy transaction.
+	noPrice := &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: 21000}
+	tipped := types.NewTx(&types.DynamicFeeTx{To: &other, GasFeeCap: big.NewInt(5e9), GasTipCap: big.NewInt(1e9)})
+	legacy := types.NewTx(&types.LegacyTx{To: &other, GasPrice: big.NewInt(3e9)})
+	require.Equal(t, big.NewInt(-21000*3e9), txTransfer(account, tipped, account, noPrice, big.NewInt(2e9)))
+	require.Equal(t, big.NewInt(-21000*5e9), txTransfer(account, tipped, account, noPrice, big.NewInt(4.5e9)), "the tip is capped by the fee cap")
+	require.Equal(t, big.NewInt(-21000*3e9), txTransfer(account, legacy, account, noPrice, nil))
+
+	// Drained and refilled in the same block: the delta hides the outflow, not the transfers.
+	transfers := []Transfer{
+		{TxHash: send.Hash(), Amount: txTransfer(account, send, account, success, nil)},
+		{TxHash: refill.Hash(), Amount: txTransfer(account, refill, other, success, nil)},
+	}
+	pre := big.NewInt(9e18)
+	post := new(big.Int).Sub(new(big.Int).Add(pre, big.NewInt(-1e18)), fee)
+	flows := computeFlows(pre, post, transfers)
+	require.Equal(t, new(big.Int).Sub(post, pre), flows.Delta)
+	require.Equal(t, new(big.Int).Add(big.NewInt(5e18), fee), flows.Outflow)
+	require.Equal(t, big.NewInt(4e18), flows.Inflow)
+	require.Equal(t, int64(0), flows.Residual.Int64())
+
+	// An internal call sending 2 ether from the account is the residual.
+	flows = computeFlows(pre, new(big.Int).Sub(post, big.NewInt(2e18)), transfers)
+	require.Equal(t, big.NewInt(-2e18), flows.Residual)
+	require.Equal(t, new(big.Int).Add(big.NewInt(7e18), fee), flows.Outflow)
+}
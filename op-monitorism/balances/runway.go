@@ -0,0 +1,125 @@
+package balances
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+)
+
+// RunwayConfig enables the burn rate and the runway projection of the ETH balance of an account
+type RunwayConfig struct {
+	Windows []time.Duration `yaml:"windows"` // the windows of the burn rates (e.g. "1h", "24h"), the runway uses the highest rate
+	Levels  []RunwayLevel   `yaml:"levels"`  // the severity levels, the lowest `below` matching the runway wins
+}
+
+// RunwayLevel is a severity reached when the runway is below a duration
+type RunwayLevel struct {
+	Severity string        `yaml:"severity"`
+	Below    time.Duration `yaml:"below"`
+}
+
+// Validate ensures the runway config is usable
+func (c *RunwayConfig) Validate() error {
+	if len(c.Windows) == 0 {
+		return fmt.Errorf("the runway requires at least one window")
+	}
+	for _, window := range c.Windows {
+		if window <= 0 {
+			return fmt.Errorf("invalid runway window %s", window)
+		}
+	}
+	severities := make(map[string]bool)
+	for _, level := range c.Levels {
+		if level.Severity == "" || level.Below <= 0 {
+			return fmt.Errorf("the runway levels require a severity and a positive `below`")
+		}
+		if severities[level.Severity] {
+			return fmt.Errorf("duplicate runway severity %s", level.Severity)
+		}
+		severities[level.Severity] = true
+	}
+	return nil
+}
+
+// maxWindow returns the longest window, the history is kept for this duration
+func (c *RunwayConfig) maxWindow() time.Duration {
+	var max time.Duration
+	for _, window := range c.Windows {
+		if window > max {
+			max = window
+		}
+	}
+	return max
+}
+
+// Severity returns the severity of a runway, an empty string if no level is reached
+func (c *RunwayConfig) Severity(runway time.Duration) string {
+	var severity string
+	var below time.Duration
+	for _, level := range c.Levels {
+		if runway < level.Below && (severity == "" || level.Below < below) {
+			severity, below = level.Severity, level.Below
+		}
+	}
+	return severity
+}
+
+// balanceSample is a balance at a point in time
+type balanceSample struct {
+	time    time.Time
+	balance *big.Int
+}
+
+// balanceHistory is the rolling history of the balance of an account
+type balanceHistory struct {
+	samples []balanceSample
+}
+
+// add records a balance and forgets the samples older than `keep`
+func (h *balanceHistory) add(now time.Time, balance *big.Int, keep time.Duration) {
+	kept := h.samples[:0]
+	for _, s := range h.samples {
+		if !s.time.Before(now.Add(-keep)) {
+			kept = append(kept, s)
+		}
+	}
+	h.samples = append(kept, balanceSample{time: now, balance: balance})
+}
+
+// burnRate returns the amount burned per second over the window ending at `now`. Only the decreases of the balance are summed, the top-ups are ignored.
+// It returns false until the history holds two samples within the window.
+func (h *balanceHistory) burnRate(now time.Time, window time.Duration) (*big.Float, bool) {
+	burned := new(big.Int)
+	var first, last *balanceSample
+	for i := range h.samples {
+		s := &h.samples[i]
+		if s.time.Before(now.Add(-window)) {
+			continue
+		}
+		if last != nil && s.balance.Cmp(last.balance) < 0 {
+			burned.Add(burned, new(big.Int).Sub(last.balance, s.balance))
+		}
+		if first == nil {
+			first = s
+		}
+		last = s
+	}
+	if first == nil || first == last {
+		return nil, false
+	}
+	elapsed := last.time.Sub(first.time).Seconds()
+	return new(big.Float).Quo(new(big.Float).SetInt(burned), big.NewFloat(elapsed)), true
+}
+
+// runway returns how long the balance lasts at the burn rate (per second), +Inf if nothing is burned
+func runway(balance *big.Int, rate *big.Float) time.Duration {
+	if rate.Sign() == 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	seconds, _ := new(big.Float).Quo(new(big.Float).SetInt(balance), rate).Float64()
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,126 @@
+package bridge_supply_monitor
+
+import (
+	"fmt"
+	"strings"
+
+	opservice "github.com/ethereum-optimism/optimism/op-service"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	L1NodeURLFlagName = "l1.node.url"
+	L2NodeURLFlagName = "l2.node.url"
+
+	L1StandardBridgeAddressFlagName = "l1standardbridge.address"
+	TokensFlagName                  = "tokens"
+	StartBlockFlagName              = "start.block"
+	BlockTagFlagName                = "block.tag"
+	MaxBlocksFlagName               = "max.blocks"
+)
+
+// Token is a token bridged by the standard bridge, the L2 token is the OptimismMintableERC20 representation of the L1 token.
+type Token struct {
+	L1Token common.Address
+	L2Token common.Address
+	Name    string
+}
+
+type CLIConfig struct {
+	L1NodeURL string
+	L2NodeURL string
+
+	L1StandardBridgeAddress common.Address
+	Tokens                  []Token
+
+	StartBlock uint64
+	BlockTag   string
+	MaxBlocks  uint64
+}
+
+func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
+	cfg := CLIConfig{
+		L1NodeURL:  ctx.String(L1NodeURLFlagName),
+		L2NodeURL:  ctx.String(L2NodeURLFlagName),
+		StartBlock: ctx.Uint64(StartBlockFlagName),
+		BlockTag:   ctx.String(BlockTagFlagName),
+		MaxBlocks:  ctx.Uint64(MaxBlocksFlagName),
+	}
+
+	bridgeAddress := ctx.String(L1StandardBridgeAddressFlagName)
+	if !common.IsHexAddress(bridgeAddress) {
+		return cfg, fmt.Errorf("--%s is not a hex-encoded address", L1StandardBridgeAddressFlagName)
+	}
+	cfg.L1StandardBridgeAddress = common.HexToAddress(bridgeAddress)
+
+	names := make(map[string]bool)
+	for _, token := range ctx.StringSlice(TokensFlagName) {
+		split := strings.Split(token, ":")
+		if len(split) != 3 {
+			return cfg, fmt.Errorf("failed to parse `l1_token:l2_token:name`: %s", token)
+		}
+		l1Token, l2Token, name := split[0], split[1], split[2]
+		if !common.IsHexAddress(l1Token) || !common.IsHexAddress(l2Token) {
+			return cfg, fmt.Errorf("token is not a pair of hex-encoded addresses: %s", token)
+		}
+		if name == "" || names[name] {
+			return cfg, fmt.Errorf("token name is empty or duplicated: %s", token)
+		}
+		names[name] = true
+		cfg.Tokens = append(cfg.Tokens, Token{L1Token: common.HexToAddress(l1Token), L2Token: common.HexToAddress(l2Token), Name: name})
+	}
+
+	if cfg.MaxBlocks == 0 {
+		return cfg, fmt.Errorf("--%s must be positive", MaxBlocksFlagName)
+	}
+	return cfg, nil
+}
+
+func CLIFlags(envVar string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     L1NodeURLFlagName,
+			Usage:    "Node URL of L1 archive Geth node",
+			EnvVars:  opservice.PrefixEnvVar(envVar, "L1_NODE_URL"),
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     L2NodeURLFlagName,
+			Usage:    "Node URL of L2 archive Op-Geth node",
+			EnvVars:  opservice.PrefixEnvVar(envVar, "L2_NODE_URL"),
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     L1StandardBridgeAddressFlagName,
+			Usage:    "Address of the L1StandardBridge contract",
+			EnvVars:  opservice.PrefixEnvVar(envVar, "L1_STANDARD_BRIDGE"),
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:     TokensFlagName,
+			Usage:    "One or multiple tokens formatted via `l1_token:l2_token:name`, with the OptimismMintableERC20 of the L1 token on L2",
+			EnvVars:  opservice.PrefixEnvVar(envVar, "TOKENS"),
+			Required: true,
+		},
+		&cli.Uint64Flag{
+			Name:    StartBlockFlagName,
+			Usage:   "L2 block number the bridged amounts are tracked from. Omit to start from the current block",
+			EnvVars: opservice.PrefixEnvVar(envVar, "START_BLOCK"),
+		},
+		&cli.StringFlag{
+			Name:    BlockTagFlagName,
+			Usage:   "Block tag of the L2 blocks checked (\"latest\", \"safe\" or \"finalized\")",
+			Value:   "finalized",
+			EnvVars: opservice.PrefixEnvVar(envVar, "BLOCK_TAG"),
+		},
+		&cli.Uint64Flag{
+			Name:    MaxBlocksFlagName,
+			Usage:   "Maximum number of L2 blocks whose events are queried per loop",
+			Value:   1000,
+			EnvVars: opservice.PrefixEnvVar(envVar, "MAX_BLOCKS"),
+		},
+	}
+}
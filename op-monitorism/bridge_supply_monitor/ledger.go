@@ -0,0 +1,65 @@
+package bridge_supply_monitor
+
+import (
+	"math/big"
+)
+
+// ledger tracks the amounts of a token in flight across the bridge since the start block.
+//
+// The L1StandardBridge escrows the L1 token at the deposit and releases it at the finalization of the withdrawal, while the L2 token is
+// minted when the deposit is finalized on L2 and burned when the withdrawal is initiated. The escrow of the L1 bridge is therefore the
+// L2 supply plus the deposits not finalized on L2 yet plus the withdrawals not finalized on L1 yet.
+//
+// The amounts in flight at the start block are unknown, so the amounts tracked are those bridged since the start block. They're
+// negative when more was finalized than initiated since then, and the surplus of the escrow stays equal to the amount in flight at the
+// start block as long as the token is conserved. That amount stays in the surplus, so the surplus at the start block is the baseline
+// and any drift below it is an over-mint.
+type ledger struct {
+	depositsInFlight    *big.Int
+	withdrawalsInFlight *big.Int
+	baseline            *big.Int
+}
+
+// newLedger starts a ledger from the escrow and the supply at the start block.
+func newLedger(escrow, supply *big.Int) *ledger {
+	return &ledger{depositsInFlight: new(big.Int), withdrawalsInFlight: new(big.Int), baseline: new(big.Int).Sub(escrow, supply)}
+}
+
+// apply records the amounts deposited and withdrawn across both layers.
+func (l *ledger) apply(flows *flows) {
+	l.depositsInFlight.Add(l.depositsInFlight, flows.depositsInitiated)
+	l.depositsInFlight.Sub(l.depositsInFlight, flows.depositsFinalized)
+	l.withdrawalsInFlight.Add(l.withdrawalsInFlight, flows.withdrawalsInitiated)
+	l.withdrawalsInFlight.Sub(l.withdrawalsInFlight, flows.withdrawalsFinalized)
+}
+
+// surplus returns the escrow of the L1 bridge not needed to back the L2 supply and the amounts in flight. A negative surplus means that
+// the L2 token was over-minted.
+func (l *ledger) surplus(escrow, supply *big.Int) *big.Int {
+	required := new(big.Int).Add(supply, l.depositsInFlight)
+	required.Add(required, l.withdrawalsInFlight)
+	return new(big.Int).Sub(escrow, required)
+}
+
+// drift returns the change of the surplus since the start block. A negative drift means that the L2 token was over-minted, even by less
+// than the amount in flight at the start block.
+func (l *ledger) drift(escrow, supply *big.Int) *big.Int {
+	return new(big.Int).Sub(l.surplus(escrow, supply), l.baseline)
+}
+
+// flows are the amounts of a token bridged in a range of blocks.
+type flows struct {
+	depositsInitiated    *big.Int // escrowed by the L1 bridge
+	depositsFinalized    *big.Int // minted by the L2 bridge
+	withdrawalsInitiated *big.Int // burned by the L2 bridge
+	withdrawalsFinalized *big.Int // released by the L1 bridge
+}
+
+func newFlows() *flows {
+	return &flows{
+		depositsInitiated:    new(big.Int),
+		depositsFinalized:    new(big.Int),
+		withdrawalsInitiated: new(big.Int),
+		withdrawalsFinalized: new(big.Int),
+	}
+}
@@ -0,0 +1,55 @@
+package bridge_supply_monitor
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerSurplus(t *testing.T) {
+	// 100 tokens escrowed, 90 minted on L2 and 10 in flight at the start block.
+	l := newLedger(big.NewInt(100), big.NewInt(90))
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(100), big.NewInt(90)))
+	require.Zero(t, l.drift(big.NewInt(100), big.NewInt(90)).Sign())
+
+	// 20 tokens are deposited on L1, of which only 15 are minted on L2 so far.
+	deposit := newFlows()
+	deposit.depositsInitiated.SetInt64(20)
+	deposit.depositsFinalized.SetInt64(15)
+	l.apply(deposit)
+	require.Equal(t, big.NewInt(5), l.depositsInFlight)
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(120), big.NewInt(105)))
+	require.Zero(t, l.drift(big.NewInt(120), big.NewInt(105)).Sign())
+
+	// 30 tokens are burned on L2, and the withdrawals in flight at the start block are released on L1 with 5 of them.
+	withdrawal := newFlows()
+	withdrawal.withdrawalsInitiated.SetInt64(30)
+	withdrawal.withdrawalsFinalized.SetInt64(45)
+	withdrawal.depositsFinalized.SetInt64(5)
+	l.apply(withdrawal)
+	require.Equal(t, big.NewInt(-15), l.withdrawalsInFlight)
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(75), big.NewInt(80)))
+	require.Zero(t, l.drift(big.NewInt(75), big.NewInt(80)).Sign())
+
+	// Tokens minted on L2 without a deposit aren't escrowed.
+	require.Equal(t, big.NewInt(-2), l.surplus(big.NewInt(75), big.NewInt(92)))
+	require.Equal(t, big.NewInt(-12), l.drift(big.NewInt(75), big.NewInt(92)))
+}
+
+func TestLedgerOverMintBelowStartInFlight(t *testing.T) {
+	// 100 tokens escrowed, 60 minted on L2 and 40 in flight at the start block, e.g. withdrawals waiting for their proof window or never
+	// finalized.
+	l := newLedger(big.NewInt(100), big.NewInt(60))
+
+	// 30 tokens are minted on L2 without a deposit: the surplus stays positive but drifts below the start block.
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(100), big.NewInt(90)))
+	require.Equal(t, big.NewInt(-30), l.drift(big.NewInt(100), big.NewInt(90)))
+
+	// The withdrawals in flight at the start block are finalized, the over-mint is still detected.
+	withdrawal := newFlows()
+	withdrawal.withdrawalsFinalized.SetInt64(40)
+	l.apply(withdrawal)
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(60), big.NewInt(90)))
+	require.Equal(t, big.NewInt(-30), l.drift(big.NewInt(60), big.NewInt(90)))
+}
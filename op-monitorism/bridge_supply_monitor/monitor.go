@@ -0,0 +1,429 @@
+package bridge_supply_monitor
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	opbindings "github.com/ethereum-optimism/optimism/op-bindings/bindings"
+	"github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/ethereum-optimism/optimism/op-service/predeploys"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	MetricsNamespace = "bridge_supply_mon"
+)
+
+// blockTags are the block tags supported by --block.tag
+var blockTags = map[string]rpc.BlockNumber{
+	"latest":    rpc.LatestBlockNumber,
+	"safe":      rpc.SafeBlockNumber,
+	"finalized": rpc.FinalizedBlockNumber,
+}
+
+// pair identifies a token in the events of the bridges
+type pair struct {
+	l1Token common.Address
+	l2Token common.Address
+}
+
+type Monitor struct {
+	log      log.Logger
+	l1Client *ethclient.Client
+	l2Client *ethclient.Client
+
+	l1Bridge    *opbindings.L1StandardBridge
+	l2Bridge    *opbindings.L2StandardBridgeFilterer
+	l1BlockInfo *opbindings.L1BlockCaller
+
+	tokens     []Token
+	pairs      map[pair]int // index of the token of a pair
+	l1Tokens   []common.Address
+	l2Tokens   []common.Address
+	startBlock uint64
+	blockTag   rpc.BlockNumber
+	maxBlocks  uint64
+
+	// the ledgers and the decimals are set once the start block is read, l2Block and l1Block are the last blocks accounted on each layer
+	ledgers  []*ledger
+	decimals []uint8
+	l2Block  uint64
+	l1Block  uint64
+
+	/** Metrics **/
+	l1Escrow            *prometheus.GaugeVec
+	l2Supply            *prometheus.GaugeVec
+	depositsInFlight    *prometheus.GaugeVec
+	withdrawalsInFlight *prometheus.GaugeVec
+	escrowSurplus       *prometheus.GaugeVec
+	escrowDrift         *prometheus.GaugeVec
+	overMints           *prometheus.CounterVec
+	highestBlockNumber  *prometheus.GaugeVec
+	unexpectedRpcErrors *prometheus.CounterVec
+}
+
+func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIConfig) (*Monitor, error) {
+	log.Info("creating the bridge supply monitor")
+	blockTag, ok := blockTags[cfg.BlockTag]
+	if !ok {
+		return nil, fmt.Errorf("unsupported block tag %q", cfg.BlockTag)
+	}
+	if len(cfg.Tokens) == 0 {
+		return nil, fmt.Errorf("no token to monitor")
+	}
+
+	l1Client, err := ethclient.Dial(cfg.L1NodeURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial l1: %w", err)
+	}
+	l2Client, err := ethclient.Dial(cfg.L2NodeURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial l2: %w", err)
+	}
+
+	l1Bridge, err := opbindings.NewL1StandardBridge(cfg.L1StandardBridgeAddress, l1Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to the L1StandardBridge: %w", err)
+	}
+	l2Bridge, err := opbindings.NewL2StandardBridgeFilterer(predeploys.L2StandardBridgeAddr, l2Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to the L2StandardBridge: %w", err)
+	}
+	l1BlockInfo, err := opbindings.NewL1BlockCaller(predeploys.L1BlockAddr, l2Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to the L1Block: %w", err)
+	}
+
+	pairs := make(map[pair]int, len(cfg.Tokens))
+	var l1Tokens, l2Tokens []common.Address
+	for i, token := range cfg.Tokens {
+		key := pair{token.L1Token, token.L2Token}
+		if _, ok := pairs[key]; ok {
+			return nil, fmt.Errorf("duplicated token %s:%s", token.L1Token, token.L2Token)
+		}
+		pairs[key] = i
+		l1Tokens = append(l1Tokens, token.L1Token)
+		l2Tokens = append(l2Tokens, token.L2Token)
+		log.Info("monitoring token", "name", token.Name, "l1_token", token.L1Token, "l2_token", token.L2Token)
+	}
+
+	return &Monitor{
+		log:      log,
+		l1Client: l1Client,
+		l2Client: l2Client,
+
+		l1Bridge:    l1Bridge,
+		l2Bridge:    l2Bridge,
+		l1BlockInfo: l1BlockInfo,
+
+		tokens:     cfg.Tokens,
+		pairs:      pairs,
+		l1Tokens:   l1Tokens,
+		l2Tokens:   l2Tokens,
+		startBlock: cfg.StartBlock,
+		blockTag:   blockTag,
+		maxBlocks:  cfg.MaxBlocks,
+
+		l1Escrow: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "l1_escrow",
+			Help:      "Amount of the L1 token escrowed by the L1StandardBridge for the L2 token",
+		}, []string{"token"}),
+		l2Supply: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "l2_supply",
+			Help:      "Total supply of the L2 token",
+		}, []string{"token"}),
+		depositsInFlight: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "deposits_in_flight",
+			Help:      "Amount deposited on L1 minus the amount minted on L2 since the start block",
+		}, []string{"token"}),
+		withdrawalsInFlight: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "withdrawals_in_flight",
+			Help:      "Amount burned on L2 minus the amount released on L1 since the start block",
+		}, []string{"token"}),
+		escrowSurplus: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "escrow_surplus",
+			Help:      "Escrow of the L1 bridge minus the L2 supply and the amounts in flight since the start block",
+		}, []string{"token"}),
+		escrowDrift: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "escrow_drift",
+			Help:      "Escrow surplus minus the surplus at the start block, negative on an over-mint",
+		}, []string{"token"}),
+		overMints: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "over_mints_total",
+			Help:      "Number of checks where the escrow surplus drifted below the start block",
+		}, []string{"token"}),
+		highestBlockNumber: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "highestBlockNumber",
+			Help:      "Last block number checked, by layer",
+		}, []string{"layer"}),
+		unexpectedRpcErrors: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "unexpectedRpcErrors",
+			Help:      "number of unexpected rpc errors",
+		}, []string{"section", "name"}),
+	}, nil
+}
+
+// snapshot is the escrow and the supply of each token at an L2 block and its L1 origin.
+type snapshot struct {
+	l2Block uint64
+	l1Block uint64
+	escrow  []*big.Int
+	supply  []*big.Int
+}
+
+func (m *Monitor) Run(ctx context.Context) {
+	if m.ledgers == nil {
+		if err := m.start(ctx); err != nil {
+			m.log.Error("failed to read the start block", "err", err)
+			m.unexpectedRpcErrors.WithLabelValues("bridge_supply", "start").Inc()
+		}
+		return
+	}
+
+	head, err := m.l2Client.HeaderByNumber(ctx, big.NewInt(int64(m.blockTag)))
+	if err != nil {
+		m.log.Error("failed to query the L2 head", "err", err)
+		m.unexpectedRpcErrors.WithLabelValues("bridge_supply", "HeaderByNumber").Inc()
+		return
+	}
+	if head.Number.Uint64() <= m.l2Block {
+		m.log.Info("no new L2 block", "block", m.l2Block)
+		return
+	}
+	to := min(head.Number.Uint64(), m.l2Block+m.maxBlocks)
+
+	// Everything is queried before the ledgers are updated, so a failed query is retried with the same range at the next loop.
+	snap, err := m.snapshot(ctx, to)
+	if err != nil {
+		m.log.Error("failed to query the supplies", "block", to, "err", err)
+		m.unexpectedRpcErrors.WithLabelValues("bridge_supply", "snapshot").Inc()
+		return
+	}
+	tokenFlows, err := m.queryFlows(ctx, m.l2Block+1, to, m.l1Block+1, snap.l1Block)
+	if err != nil {
+		m.log.Error("failed to query the bridge events", "from", m.l2Block+1, "to", to, "err", err)
+		m.unexpectedRpcErrors.WithLabelValues("bridge_supply", "queryFlows").Inc()
+		return
+	}
+
+	for i, ledger := range m.ledgers {
+		ledger.apply(tokenFlows[i])
+	}
+	m.l2Block, m.l1Block = snap.l2Block, snap.l1Block
+	m.check(snap)
+}
+
+// start reads the decimals of the tokens and checks the start block.
+func (m *Monitor) start(ctx context.Context) error {
+	block := m.startBlock
+	if block == 0 {
+		head, err := m.l2Client.HeaderByNumber(ctx, big.NewInt(int64(m.blockTag)))
+		if err != nil {
+			return fmt.Errorf("failed to query the L2 head: %w", err)
+		}
+		block = head.Number.Uint64()
+	}
+
+	decimals := make([]uint8, len(m.tokens))
+	for i, token := range m.tokens {
+		erc20, err := opbindings.NewERC20Caller(token.L2Token, m.l2Client)
+		if err != nil {
+			return fmt.Errorf("failed to bind to %s: %w", token.Name, err)
+		}
+		decimals[i], err = erc20.Decimals(&bind.CallOpts{Context: ctx})
+		if err != nil {
+			return fmt.Errorf("failed to query the decimals of %s: %w", token.Name, err)
+		}
+	}
+	snap, err := m.snapshot(ctx, block)
+	if err != nil {
+		return err
+	}
+
+	m.decimals = decimals
+	m.ledgers = make([]*ledger, len(m.tokens))
+	for i := range m.ledgers {
+		m.ledgers[i] = newLedger(snap.escrow[i], snap.supply[i])
+	}
+	m.l2Block, m.l1Block = snap.l2Block, snap.l1Block
+	m.check(snap)
+	return nil
+}
+
+// snapshot reads the escrow of the L1 bridge at the L1 origin of an L2 block and the supply of the L2 tokens at the L2 block. Deposits
+// are finalized on L2 in the first block of the epoch of their L1 block, so both layers are aligned at the origin.
+func (m *Monitor) snapshot(ctx context.Context, l2Block uint64) (*snapshot, error) {
+	l2Opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(l2Block)}
+	origin, err := m.l1BlockInfo.Number(l2Opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the L1 origin: %w", err)
+	}
+	l1Opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(origin)}
+
+	snap := &snapshot{l2Block: l2Block, l1Block: origin}
+	for _, token := range m.tokens {
+		escrow, err := m.l1Bridge.Deposits(l1Opts, token.L1Token, token.L2Token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query the deposits of %s: %w", token.Name, err)
+		}
+		erc20, err := opbindings.NewERC20Caller(token.L2Token, m.l2Client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to bind to %s: %w", token.Name, err)
+		}
+		supply, err := erc20.TotalSupply(l2Opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query the total supply of %s: %w", token.Name, err)
+		}
+		snap.escrow = append(snap.escrow, escrow)
+		snap.supply = append(snap.supply, supply)
+	}
+	return snap, nil
+}
+
+// queryFlows reads the amounts bridged by token: the deposits initiated and the withdrawals finalized in the L1 blocks, and the deposits
+// finalized and the withdrawals initiated in the L2 blocks.
+func (m *Monitor) queryFlows(ctx context.Context, l2From, l2To, l1From, l1To uint64) ([]*flows, error) {
+	tokenFlows := make([]*flows, len(m.tokens))
+	for i := range tokenFlows {
+		tokenFlows[i] = newFlows()
+	}
+	// The events are filtered by L1 and L2 token, so the pairs that aren't monitored are skipped.
+	add := func(l1Token, l2Token common.Address, amount *big.Int, field func(*flows) *big.Int) {
+		if i, ok := m.pairs[pair{l1Token, l2Token}]; ok {
+			field(tokenFlows[i]).Add(field(tokenFlows[i]), amount)
+		}
+	}
+
+	l2Opts := &bind.FilterOpts{Start: l2From, End: &l2To, Context: ctx}
+	depositsFinalized, err := m.l2Bridge.FilterDepositFinalized(l2Opts, m.l1Tokens, m.l2Tokens, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter DepositFinalized: %w", err)
+	}
+	defer depositsFinalized.Close()
+	for depositsFinalized.Next() {
+		event := depositsFinalized.Event
+		add(event.L1Token, event.L2Token, event.Amount, func(f *flows) *big.Int { return f.depositsFinalized })
+	}
+	if err := depositsFinalized.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate DepositFinalized: %w", err)
+	}
+
+	withdrawalsInitiated, err := m.l2Bridge.FilterWithdrawalInitiated(l2Opts, m.l1Tokens, m.l2Tokens, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter WithdrawalInitiated: %w", err)
+	}
+	defer withdrawalsInitiated.Close()
+	for withdrawalsInitiated.Next() {
+		event := withdrawalsInitiated.Event
+		add(event.L1Token, event.L2Token, event.Amount, func(f *flows) *big.Int { return f.withdrawalsInitiated })
+	}
+	if err := withdrawalsInitiated.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate WithdrawalInitiated: %w", err)
+	}
+
+	if l1From > l1To {
+		return tokenFlows, nil
+	}
+	l1Opts := &bind.FilterOpts{Start: l1From, End: &l1To, Context: ctx}
+	depositsInitiated, err := m.l1Bridge.FilterERC20DepositInitiated(l1Opts, m.l1Tokens, m.l2Tokens, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter ERC20DepositInitiated: %w", err)
+	}
+	defer depositsInitiated.Close()
+	for depositsInitiated.Next() {
+		event := depositsInitiated.Event
+		add(event.L1Token, event.L2Token, event.Amount, func(f *flows) *big.Int { return f.depositsInitiated })
+	}
+	if err := depositsInitiated.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate ERC20DepositInitiated: %w", err)
+	}
+
+	withdrawalsFinalized, err := m.l1Bridge.FilterERC20WithdrawalFinalized(l1Opts, m.l1Tokens, m.l2Tokens, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter ERC20WithdrawalFinalized: %w", err)
+	}
+	defer withdrawalsFinalized.Close()
+	for withdrawalsFinalized.Next() {
+		event := withdrawalsFinalized.Event
+		add(event.L1Token, event.L2Token, event.Amount, func(f *flows) *big.Int { return f.withdrawalsFinalized })
+	}
+	if err := withdrawalsFinalized.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate ERC20WithdrawalFinalized: %w", err)
+	}
+	return tokenFlows, nil
+}
+
+// check compares the L2 supply of each token with the escrow of the L1 bridge and reports the metrics. The surplus at the start block
+// includes the amounts in flight then, so an over-mint is a drift of the surplus below it.
+func (m *Monitor) check(snap *snapshot) {
+	for i, token := range m.tokens {
+		ledger, decimals := m.ledgers[i], m.decimals[i]
+		surplus := ledger.surplus(snap.escrow[i], snap.supply[i])
+		drift := ledger.drift(snap.escrow[i], snap.supply[i])
+
+		m.l1Escrow.WithLabelValues(token.Name).Set(scaleAmount(snap.escrow[i], decimals))
+		m.l2Supply.WithLabelValues(token.Name).Set(scaleAmount(snap.supply[i], decimals))
+		m.depositsInFlight.WithLabelValues(token.Name).Set(scaleAmount(ledger.depositsInFlight, decimals))
+		m.withdrawalsInFlight.WithLabelValues(token.Name).Set(scaleAmount(ledger.withdrawalsInFlight, decimals))
+		m.escrowSurplus.WithLabelValues(token.Name).Set(scaleAmount(surplus, decimals))
+		m.escrowDrift.WithLabelValues(token.Name).Set(scaleAmount(drift, decimals))
+
+		if drift.Sign() < 0 {
+			m.log.Error("L2 token over-minted",
+				"token", token.Name,
+				"l1_token", token.L1Token,
+				"l2_token", token.L2Token,
+				"l2_block", snap.l2Block,
+				"l1_block", snap.l1Block,
+				"escrow", snap.escrow[i],
+				"supply", snap.supply[i],
+				"deposits_in_flight", ledger.depositsInFlight,
+				"withdrawals_in_flight", ledger.withdrawalsInFlight,
+				"surplus", surplus,
+				"start_surplus", ledger.baseline,
+				"drift", drift,
+			)
+			m.overMints.WithLabelValues(token.Name).Inc()
+			continue
+		}
+		m.log.Info("L2 token backed",
+			"token", token.Name,
+			"l2_block", snap.l2Block,
+			"l1_block", snap.l1Block,
+			"escrow", snap.escrow[i],
+			"supply", snap.supply[i],
+			"surplus", surplus,
+			"drift", drift,
+		)
+	}
+	m.highestBlockNumber.WithLabelValues("l2").Set(float64(snap.l2Block))
+	m.highestBlockNumber.WithLabelValues("l1").Set(float64(snap.l1Block))
+}
+
+func (m *Monitor) Close(_ context.Context) error {
+	m.l1Client.Close()
+	m.l2Client.Close()
+	return nil
+}
+
+// scaleAmount converts an amount in the smallest unit of a token to a float for the metrics.
+func scaleAmount(amount *big.Int, decimals uint8) float64 {
+	unit := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	scaled, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), unit).Float64()
+	return scaled
+}
@@ -6,6 +6,7 @@ import (
 
 	monitorism "github.com/ethereum-optimism/monitorism/op-monitorism"
 	"github.com/ethereum-optimism/monitorism/op-monitorism/balances"
+	"github.com/ethereum-optimism/monitorism/op-monitorism/bridge_supply_monitor"
 	"github.com/ethereum-optimism/monitorism/op-monitorism/conservation_monitor"
 	"github.com/ethereum-optimism/monitorism/op-monitorism/drippie"
 	"github.com/ethereum-optimism/monitorism/op-monitorism/fault"
@@ -14,6 +15,7 @@ import (
 	"github.com/ethereum-optimism/monitorism/op-monitorism/liveness_expiration"
 	"github.com/ethereum-optimism/monitorism/op-monitorism/multisig"
 	"github.com/ethereum-optimism/monitorism/op-monitorism/secrets"
+	"github.com/ethereum-optimism/monitorism/op-monitorism/supply_monitor"
 	"github.com/ethereum-optimism/monitorism/op-monitorism/transaction_monitor"
 	"github.com/ethereum-optimism/monitorism/op-monitorism/withdrawals"
 	withdrawalsv2 "github.com/ethereum-optimism/monitorism/op-monitorism/withdrawals-v2"
@@ -121,6 +123,20 @@ func newCli(GitCommit string, GitDate string) *cli.App {
 				Flags:       append(conservation_monitor.CLIFlags("CONSERVATION_MONITOR"), defaultFlags...),
 				Action:      cliapp.LifecycleCmd(ConservationMonitorMain),
 			},
+			{
+				Name:        "supply_monitor",
+				Usage:       "Monitors that the ETH supply of L2 is backed by the ETH locked on L1",
+				Description: "Monitors that the ETH supply of L2 is backed by the ETH locked in the OptimismPortal and the ETHLockbox on L1",
+				Flags:       append(supply_monitor.CLIFlags("SUPPLY_MONITOR"), defaultFlags...),
+				Action:      cliapp.LifecycleCmd(SupplyMonitorMain),
+			},
+			{
+				Name:        "bridge_supply_monitor",
+				Usage:       "Monitors that the supply of the bridged ERC-20 tokens on L2 is backed by the L1StandardBridge",
+				Description: "Monitors that the supply of the OptimismMintableERC20 tokens on L2 is backed by the tokens escrowed in the L1StandardBridge",
+				Flags:       append(bridge_supply_monitor.CLIFlags("BRIDGE_SUPPLY_MONITOR"), defaultFlags...),
+				Action:      cliapp.LifecycleCmd(BridgeSupplyMonitorMain),
+			},
 			{
 				Name:        "version",
 				Usage:       "Show version",
@@ -323,3 +339,35 @@ func ConservationMonitorMain(ctx *cli.Context, closeApp context.CancelCauseFunc)
 
 	return monitorism.NewCliApp(ctx, log, metricsRegistry, monitor)
 }
+
+func SupplyMonitorMain(ctx *cli.Context, closeApp context.CancelCauseFunc) (cliapp.Lifecycle, error) {
+	log := oplog.NewLogger(oplog.AppOut(ctx), oplog.ReadCLIConfig(ctx))
+	cfg, err := supply_monitor.ReadCLIFlags(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse supply monitor config from flags: %w", err)
+	}
+
+	metricsRegistry := opmetrics.NewRegistry()
+	monitor, err := supply_monitor.NewMonitor(ctx.Context, log, opmetrics.With(metricsRegistry), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create supply monitor: %w", err)
+	}
+
+	return monitorism.NewCliApp(ctx, log, metricsRegistry, monitor)
+}
+
+func BridgeSupplyMonitorMain(ctx *cli.Context, closeApp context.CancelCauseFunc) (cliapp.Lifecycle, error) {
+	log := oplog.NewLogger(oplog.AppOut(ctx), oplog.ReadCLIConfig(ctx))
+	cfg, err := bridge_supply_monitor.ReadCLIFlags(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bridge supply monitor config from flags: %w", err)
+	}
+
+	metricsRegistry := opmetrics.NewRegistry()
+	monitor, err := bridge_supply_monitor.NewMonitor(ctx.Context, log, opmetrics.With(metricsRegistry), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bridge supply monitor: %w", err)
+	}
+
+	return monitorism.NewCliApp(ctx, log, metricsRegistry, monitor)
+}
@@ -0,0 +1,253 @@
+package conservation_monitor
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/ethereum-optimism/optimism/op-service/predeploys"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Finding is the part of the balance change of an address in a block that isn't explained by the block's execution.
+type Finding struct {
+	Address   common.Address
+	Delta     *big.Int      // observed balance change: balance at the block minus balance at the parent block
+	Explained *big.Int      // balance change explained by the value transfers, the fees and the mints
+	Residual  *big.Int      // Delta - Explained
+	TxHashes  []common.Hash // transactions that touched the address
+}
+
+// Components of the ETH accounting of a block.
+const (
+	ComponentMinted            = "minted"              // minted by the deposits
+	ComponentWithdrawalsBurned = "withdrawals_burned"  // burned by L2ToL1MessagePasser.burn()
+	ComponentOtherBurned       = "selfdestruct_burned" // burned by the other contracts self-destructing to themselves
+	ComponentBaseFee           = "base_fee"            // credited to the BaseFeeVault
+	ComponentSequencerFee      = "sequencer_fee"       // credited to the SequencerFeeVault
+	ComponentL1Fee             = "l1_fee"              // credited to the L1FeeVault
+	ComponentOperatorFee       = "operator_fee"        // credited to the OperatorFeeVault
+)
+
+// feeComponents are the fee vaults and the component of the fees credited to each.
+var feeComponents = map[common.Address]string{
+	predeploys.BaseFeeVaultAddr:      ComponentBaseFee,
+	predeploys.SequencerFeeVaultAddr: ComponentSequencerFee,
+	predeploys.L1FeeVaultAddr:        ComponentL1Fee,
+	predeploys.OperatorFeeVaultAddr:  ComponentOperatorFee,
+}
+
+// ledger accumulates the expected balance changes of a block, per address.
+type ledger struct {
+	deltas     map[common.Address]*big.Int
+	txs        map[common.Address][]common.Hash
+	burned     *big.Int            // ETH destroyed by the contracts self-destructing to themselves in their creation transaction
+	components map[string]*big.Int // ETH accounted by component
+}
+
+func newLedger() *ledger {
+	return &ledger{
+		deltas:     make(map[common.Address]*big.Int),
+		txs:        make(map[common.Address][]common.Hash),
+		burned:     new(big.Int),
+		components: make(map[string]*big.Int),
+	}
+}
+
+// account adds an amount to a component.
+func (l *ledger) account(component string, amount *big.Int) {
+	total, ok := l.components[component]
+	if !ok {
+		total = new(big.Int)
+		l.components[component] = total
+	}
+	total.Add(total, amount)
+}
+
+// supplyChange returns the change of the ETH supply explained by the block: the mints minus the burns.
+func (l *ledger) supplyChange() *big.Int {
+	change := new(big.Int)
+	if minted, ok := l.components[ComponentMinted]; ok {
+		change.Add(change, minted)
+	}
+	return change.Sub(change, l.burned)
+}
+
+// touch records that a transaction touched an address.
+func (l *ledger) touch(addr common.Address, txHash common.Hash) {
+	hashes := l.txs[addr]
+	if len(hashes) == 0 || hashes[len(hashes)-1] != txHash {
+		l.txs[addr] = append(hashes, txHash)
+	}
+}
+
+// credit adds an amount to the expected change of an address, a negative amount is a debit.
+func (l *ledger) credit(addr common.Address, amount *big.Int, txHash common.Hash) {
+	l.touch(addr, txHash)
+	if amount.Sign() == 0 {
+		return
+	}
+	delta, ok := l.deltas[addr]
+	if !ok {
+		delta = new(big.Int)
+		l.deltas[addr] = delta
+	}
+	delta.Add(delta, amount)
+}
+
+// transfer moves an amount between two addresses.
+func (l *ledger) transfer(from, to common.Address, amount *big.Int, txHash common.Hash) {
+	l.credit(from, new(big.Int).Neg(amount), txHash)
+	l.credit(to, amount, txHash)
+}
+
+// explained returns the expected change of an address.
+func (l *ledger) explained(addr common.Address) *big.Int {
+	if delta, ok := l.deltas[addr]; ok {
+		return new(big.Int).Set(delta)
+	}
+	return new(big.Int)
+}
+
+// explainBlock builds the ledger of a block from its call traces and its receipts (nil receipts skip the fees).
+func explainBlock(block *types.Block, traces []txTraceResult, receipts []*types.Receipt) *ledger {
+	l := newLedger()
+	receiptsByHash := make(map[common.Hash]*types.Receipt, len(receipts))
+	for _, receipt := range receipts {
+		receiptsByHash[receipt.TxHash] = receipt
+	}
+	tracesByHash := make(map[common.Hash]callTrace, len(traces))
+	for _, trace := range traces {
+		tracesByHash[trace.TxHash] = trace.Result
+	}
+
+	for _, tx := range block.Transactions() {
+		trace, ok := tracesByHash[tx.Hash()]
+		if !ok {
+			continue
+		}
+
+		// The mint of a deposit is credited to its sender, even if the deposit fails.
+		if tx.IsDepositTx() && tx.Mint() != nil {
+			l.credit(trace.From, tx.Mint(), tx.Hash())
+			l.account(ComponentMinted, tx.Mint())
+		}
+		explainCall(l, tx.Hash(), trace, make(map[common.Address]common.Address))
+		if receipt, ok := receiptsByHash[tx.Hash()]; ok && !tx.IsDepositTx() {
+			explainFees(l, tx.Hash(), trace.From, receipt, block.BaseFee())
+		}
+	}
+	return l
+}
+
+// explainCall records the value transfers of a call and of its sub-calls. A reverted call didn't move any value, nor did its sub-calls.
+// `created` holds the creator of each contract created by the transaction.
+func explainCall(l *ledger, txHash common.Hash, call callTrace, created map[common.Address]common.Address) {
+	l.touch(call.From, txHash)
+	if call.To != nil {
+		l.touch(*call.To, txHash)
+	}
+	if call.Error != "" {
+		return
+	}
+
+	value := new(big.Int)
+	if call.Value != nil {
+		value = call.Value.ToInt()
+	}
+	switch call.Type {
+	case "CREATE", "CREATE2":
+		if call.To != nil {
+			created[*call.To] = call.From
+		}
+		fallthrough
+	case "CALL":
+		if call.To != nil && value.Sign() > 0 {
+			l.transfer(call.From, *call.To, value, txHash)
+		}
+	case "SELFDESTRUCT":
+		// A contract self-destructing to itself in its creation transaction destroys its balance (EIP-6780), it is kept otherwise.
+		if call.To != nil && *call.To == call.From {
+			creator, ok := created[call.From]
+			if ok && value.Sign() > 0 {
+				l.credit(call.From, new(big.Int).Neg(value), txHash)
+				l.burned.Add(l.burned, value)
+				// L2ToL1MessagePasser.burn() creates a Burner that self-destructs with the balance of the message passer.
+				if creator == predeploys.L2ToL1MessagePasserAddr {
+					l.account(ComponentWithdrawalsBurned, value)
+				} else {
+					l.account(ComponentOtherBurned, value)
+				}
+			}
+		} else if call.To != nil && value.Sign() > 0 {
+			l.transfer(call.From, *call.To, value, txHash)
+		}
+	}
+
+	for _, sub := range call.Calls {
+		explainCall(l, txHash, sub, created)
+	}
+}
+
+// explainFees records the fees paid by the sender of a transaction and credited to the fee vaults.
+func explainFees(l *ledger, txHash common.Hash, sender common.Address, receipt *types.Receipt, baseFee *big.Int) {
+	gasUsed := new(big.Int).SetUint64(receipt.GasUsed)
+	gasPrice := receipt.EffectiveGasPrice
+	if gasPrice == nil {
+		gasPrice = new(big.Int)
+	}
+	if baseFee == nil {
+		baseFee = new(big.Int)
+	}
+
+	baseFees := new(big.Int).Mul(gasUsed, baseFee)
+	priorityFees := new(big.Int).Mul(gasUsed, new(big.Int).Sub(gasPrice, baseFee))
+	l1Fee := new(big.Int)
+	if receipt.L1Fee != nil {
+		l1Fee.Set(receipt.L1Fee)
+	}
+	operatorFee := operatorFee(receipt)
+
+	for vault, fee := range map[common.Address]*big.Int{
+		predeploys.BaseFeeVaultAddr:      baseFees,
+		predeploys.SequencerFeeVaultAddr: priorityFees,
+		predeploys.L1FeeVaultAddr:        l1Fee,
+		predeploys.OperatorFeeVaultAddr:  operatorFee,
+	} {
+		l.transfer(sender, vault, fee, txHash)
+		l.account(feeComponents[vault], fee)
+	}
+}
+
+// operatorFee returns the operator fee of a transaction (Isthmus): gasUsed * operatorFeeScalar / 1e6 + operatorFeeConstant.
+func operatorFee(receipt *types.Receipt) *big.Int {
+	fee := new(big.Int)
+	if receipt.OperatorFeeScalar == nil || receipt.OperatorFeeConstant == nil {
+		return fee
+	}
+	fee.SetUint64(receipt.GasUsed)
+	fee.Mul(fee, new(big.Int).SetUint64(*receipt.OperatorFeeScalar))
+	fee.Div(fee, big.NewInt(1_000_000))
+	return fee.Add(fee, new(big.Int).SetUint64(*receipt.OperatorFeeConstant))
+}
+
+// findings compares the observed balance changes of the addresses with the ledger, and returns the addresses with an unexplained residual.
+func (l *ledger) findings(parent, current map[common.Address]*big.Int) []Finding {
+	var findings []Finding
+	for addr, before := range parent {
+		after, ok := current[addr]
+		if !ok {
+			continue
+		}
+		delta := new(big.Int).Sub(after, before)
+		explained := l.explained(addr)
+		residual := new(big.Int).Sub(delta, explained)
+		if residual.Sign() != 0 {
+			findings = append(findings, Finding{Address: addr, Delta: delta, Explained: explained, Residual: residual, TxHashes: l.txs[addr]})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Address.Cmp(findings[j].Address) < 0
+	})
+	return findings
+}
@@ -11,12 +11,18 @@ const (
 	NodeURLFlagName         = "node.url"
 	StartBlockFlagName      = "start.block"
 	PollingIntervalFlagName = "poll.interval"
+	StrictFlagName          = "strict"
+	BalanceSourceFlagName   = "balance.source"
+	CompareSourcesFlagName  = "balance.compare"
 )
 
 type CLIConfig struct {
 	NodeUrl         string        `yaml:"node_url"`
 	StartBlock      uint64        `yaml:"start_block"`
 	PollingInterval time.Duration `yaml:"poll_interval"`
+	Strict          bool          `yaml:"strict"`
+	BalanceSource   string        `yaml:"balance_source"`
+	CompareSources  bool          `yaml:"balance_compare"`
 }
 
 func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
@@ -24,6 +30,9 @@ func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
 		NodeUrl:         ctx.String(NodeURLFlagName),
 		StartBlock:      ctx.Uint64(StartBlockFlagName),
 		PollingInterval: ctx.Duration(PollingIntervalFlagName),
+		Strict:          ctx.Bool(StrictFlagName),
+		BalanceSource:   ctx.String(BalanceSourceFlagName),
+		CompareSources:  ctx.Bool(CompareSourcesFlagName),
 	}
 	return cfg, nil
 }
@@ -48,5 +57,21 @@ func CLIFlags(envPrefix string) []cli.Flag {
 			Value:   12 * time.Second,
 			EnvVars: opservice.PrefixEnvVar(envPrefix, "POLL_INTERVAL"),
 		},
+		&cli.BoolFlag{
+			Name:    StrictFlagName,
+			Usage:   "Strict accounting: assert the exact equality of the balance changes with the mints minus the burns, and explain the change of every address (fees, withdrawals burned)",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "STRICT"),
+		},
+		&cli.StringFlag{
+			Name:    BalanceSourceFlagName,
+			Usage:   "Source of the balances of the touched addresses: \"calltrace\" (callTracer and eth_getBalance at the parent and the block) or \"prestate\" (prestateTracer in diff mode, falling back to calltrace)",
+			Value:   SourceCallTrace,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "BALANCE_SOURCE"),
+		},
+		&cli.BoolFlag{
+			Name:    CompareSourcesFlagName,
+			Usage:   "Also get the balances from the call trace and compare them with the prestateTracer ones",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "BALANCE_COMPARE"),
+		},
 	}
 }
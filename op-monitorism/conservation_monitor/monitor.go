@@ -4,15 +4,16 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum-optimism/optimism/op-service/metrics"
-	"github.com/ethereum-optimism/optimism/op-service/predeploys"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/prometheus/client_golang/prometheus"
 
@@ -26,6 +27,11 @@ const (
 type Metrics struct {
 	invariantHeld       *prometheus.CounterVec
 	invariantViolations *prometheus.CounterVec
+	unexplainedChanges  *prometheus.CounterVec
+	accountedEth        *prometheus.CounterVec
+	prestateFallbacks   prometheus.Counter
+	sourceComparisons   prometheus.Counter
+	sourceMismatches    prometheus.Counter
 }
 
 type Monitor struct {
@@ -33,17 +39,36 @@ type Monitor struct {
 	client    *ethclient.Client
 	processor *processor.BlockProcessor
 	metrics   Metrics
+
+	// strict accounting: exact equality and per-address attribution on every block
+	strict bool
+
+	// source of the balances, and whether the call trace balances are compared with the prestateTracer ones
+	source  string
+	compare bool
 }
 
 func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIConfig) (*Monitor, error) {
+	switch cfg.BalanceSource {
+	case SourceCallTrace, SourcePrestate:
+	default:
+		return nil, fmt.Errorf("unknown balance source %q", cfg.BalanceSource)
+	}
+	if cfg.CompareSources && cfg.BalanceSource != SourcePrestate {
+		return nil, fmt.Errorf("the comparison of the balance sources requires the %s source", SourcePrestate)
+	}
+
 	client, err := ethclient.Dial(cfg.NodeUrl)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial node: %w", err)
 	}
 
 	mon := &Monitor{
-		log:    log,
-		client: client,
+		log:     log,
+		client:  client,
+		strict:  cfg.Strict,
+		source:  cfg.BalanceSource,
+		compare: cfg.CompareSources,
 		metrics: Metrics{
 			invariantHeld: m.NewCounterVec(
 				prometheus.CounterOpts{
@@ -61,6 +86,43 @@ func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIC
 				},
 				[]string{"violations"},
 			),
+			unexplainedChanges: m.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "unexplained_balance_changes",
+					Help:      "Total addresses whose balance change isn't explained by the execution of a block violating the invariant",
+				},
+				[]string{"direction"},
+			),
+			accountedEth: m.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "accounted_eth",
+					Help:      "Total ETH accounted by the strict mode, by component (mints, burns and fees credited to each vault)",
+				},
+				[]string{"component"},
+			),
+			prestateFallbacks: m.NewCounter(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "prestate_fallbacks",
+					Help:      "Total blocks checked with the call trace because the prestateTracer failed",
+				},
+			),
+			sourceComparisons: m.NewCounter(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "balance_source_comparisons",
+					Help:      "Total blocks whose balances from the prestateTracer were compared with the call trace ones",
+				},
+			),
+			sourceMismatches: m.NewCounter(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "balance_source_mismatches",
+					Help:      "Total addresses whose balance change differs between the prestateTracer and the call trace",
+				},
+			),
 		},
 	}
 
@@ -73,7 +135,7 @@ func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIC
 		mon.processBlock,
 		nil,
 		&processor.Config{
-			StartBlock: big.NewInt(int64(cfg.StartBlock)),
+			StartBlock: processor.StartCursor(cfg.StartBlock),
 			Interval:   cfg.PollingInterval,
 		},
 	)
@@ -97,92 +159,260 @@ func (m *Monitor) Run(ctx context.Context) {
 }
 
 func (m *Monitor) processBlock(block *types.Block, client *ethclient.Client) error {
-	// Call-trace the block to get every touched address.
-	var trace []txTraceResult
-	traceKind := "callTracer"
-	err := client.Client().Call(&trace, "debug_traceBlockByHash", block.Hash(), tracers.TraceConfig{Tracer: &traceKind})
-	if err != nil {
-		return fmt.Errorf("failed to trace block %s: %w", block.Hash().Hex(), err)
+	ctx := context.Background()
+
+	// The balances come from the prestateTracer if enabled, or from the call trace and eth_getBalance (the fallback).
+	var balances *blockBalances
+	var fallback bool
+	if m.source == SourcePrestate {
+		var err error
+		balances, err = m.prestateBalances(ctx, block)
+		if err != nil {
+			m.log.Warn("failed to get the balances from the prestateTracer, falling back to the call trace", "block", block.Number(), "err", err)
+			fallback = true
+		}
+	}
+	var mismatches []common.Address
+	if balances == nil || m.compare {
+		trace, err := m.traceCalls(ctx, block)
+		if err != nil {
+			return err
+		}
+		callBalances, err := m.callTraceBalances(ctx, block, trace)
+		if err != nil {
+			return err
+		}
+		if balances == nil {
+			balances = callBalances
+		} else {
+			mismatches = compareBalances(balances, callBalances)
+			balances.trace = trace
+		}
 	}
 
-	held, err := m.checkInvariantHeld(block, trace)
+	result, err := m.checkInvariantHeld(ctx, block, balances)
 	if err != nil {
 		return fmt.Errorf("failed to check invariant: %w", err)
 	}
 
-	if held {
+	if result.held {
 		m.metrics.invariantHeld.WithLabelValues("held").Inc()
 	} else {
 		m.metrics.invariantViolations.WithLabelValues("violations").Inc()
 	}
+	for _, finding := range result.findings {
+		direction := "gained"
+		if finding.Residual.Sign() < 0 {
+			direction = "lost"
+		}
+		m.metrics.unexplainedChanges.WithLabelValues(direction).Inc()
+	}
+	for component, amount := range result.components {
+		ether, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), big.NewFloat(params.Ether)).Float64()
+		m.metrics.accountedEth.WithLabelValues(component).Add(ether)
+	}
+	if fallback {
+		m.metrics.prestateFallbacks.Inc()
+	}
+	if m.compare && balances.source == SourcePrestate {
+		m.metrics.sourceComparisons.Inc()
+		for _, addr := range mismatches {
+			m.log.Warn("balance sources disagree", "block", block.Number(), "address", addr)
+			m.metrics.sourceMismatches.Inc()
+		}
+	}
 	return nil
 }
 
-func (m *Monitor) Close(ctx context.Context) error {
-	m.processor.Stop()
-	m.client.Close()
-	return nil
-}
-
-func (m *Monitor) checkInvariantHeld(block *types.Block, trace []txTraceResult) (bool, error) {
-	// Compute the total amount of ETH minted in the block
-	totalMinted := big.NewInt(0)
-	for _, tx := range block.Transactions() {
-		// Check if the transaction is a deposit
-		if tx.IsDepositTx() && tx.Mint() != nil {
-			totalMinted = totalMinted.Add(totalMinted, tx.Mint())
-		}
+// traceCalls call-traces the block to get every touched address.
+func (m *Monitor) traceCalls(ctx context.Context, block *types.Block) ([]txTraceResult, error) {
+	var trace []txTraceResult
+	traceKind := "callTracer"
+	err := m.client.Client().CallContext(ctx, &trace, "debug_traceBlockByHash", block.Hash(), tracers.TraceConfig{Tracer: &traceKind})
+	if err != nil {
+		return nil, fmt.Errorf("failed to trace block %s: %w", block.Hash().Hex(), err)
 	}
+	return trace, nil
+}
 
+// callTraceBalances returns the balances, at the parent block and at the block, of the addresses touched by the call trace and of the fee vaults.
+func (m *Monitor) callTraceBalances(ctx context.Context, block *types.Block, trace []txTraceResult) (*blockBalances, error) {
 	// Extract all addresses touched by the block's execution
 	addresses := extractAllTouchedAddresses(trace)
 
 	// Extend `addresses` to include fee vaults. These are accessed outside of execution, so they're not
 	// picked up in the call trace.
-	addresses = append(addresses, []common.Address{
-		predeploys.L1FeeVaultAddr,
-		predeploys.SequencerFeeVaultAddr,
-		predeploys.BaseFeeVaultAddr,
-		predeploys.OperatorFeeVaultAddr,
-	}...)
+	addresses = append(addresses, feeVaults...)
 
-	ctx := context.Background()
 	balancesParent, err := batchGetBalance(ctx, addresses, block.Number().Uint64()-1, m.client)
 	if err != nil {
-		return false, fmt.Errorf("failed to get parent block balances: %w", err)
+		return nil, fmt.Errorf("failed to get parent block balances: %w", err)
 	}
 	balancesCurrent, err := batchGetBalance(ctx, addresses, block.Number().Uint64(), m.client)
 	if err != nil {
-		return false, fmt.Errorf("failed to get current block balances: %w", err)
+		return nil, fmt.Errorf("failed to get current block balances: %w", err)
 	}
+	return &blockBalances{
+		source:  SourceCallTrace,
+		parent:  toBigInts(balancesParent),
+		current: toBigInts(balancesCurrent),
+		trace:   trace,
+	}, nil
+}
+
+func (m *Monitor) Close(ctx context.Context) error {
+	m.processor.Stop()
+	m.client.Close()
+	return nil
+}
+
+// invariantResult is the result of the check of a block.
+type invariantResult struct {
+	held       bool
+	findings   []Finding           // the addresses with an unexplained residual
+	components map[string]*big.Int // the ETH accounted by component, in strict mode
+}
+
+// checkInvariantHeld checks the invariant of a block. When it is violated, the balance changes of the touched addresses are explained with
+// the call trace and the receipts, and the addresses with an unexplained residual are returned as findings.
+func (m *Monitor) checkInvariantHeld(ctx context.Context, block *types.Block, balances *blockBalances) (invariantResult, error) {
+	// Compute the total amount of ETH minted in the block
+	totalMinted := DepositMint(block)
 
 	totalBalancesParent := big.NewInt(0)
 	totalBalancesCurrent := big.NewInt(0)
-	for _, balance := range balancesParent {
-		totalBalancesParent = totalBalancesParent.Add(totalBalancesParent, balance.ToInt())
+	for _, balance := range balances.parent {
+		totalBalancesParent = totalBalancesParent.Add(totalBalancesParent, balance)
 	}
-	for _, balance := range balancesCurrent {
-		totalBalancesCurrent = totalBalancesCurrent.Add(totalBalancesCurrent, balance.ToInt())
+	for _, balance := range balances.current {
+		totalBalancesCurrent = totalBalancesCurrent.Add(totalBalancesCurrent, balance)
+	}
+
+	if m.strict {
+		return m.checkStrictAccounting(ctx, block, balances, totalBalancesParent, totalBalancesCurrent)
 	}
 
 	// Check that the total ETH balance of all addresses in the block is conserved, relative to their balances
 	// at the end of the parent block.
-	invariantHeld := totalBalancesParent.Cmp(totalBalancesCurrent.Sub(totalBalancesCurrent, totalMinted)) >= 0
-	if !invariantHeld {
-		m.log.Warn(
-			fmt.Sprintf("ETH conservation invariant violated. %d != %d - %d", totalBalancesParent, totalBalancesCurrent, totalMinted),
-			"block", block.Number().Uint64(),
-		)
-	} else {
+	invariantHeld := totalBalancesParent.Cmp(new(big.Int).Sub(totalBalancesCurrent, totalMinted)) >= 0
+	if invariantHeld {
 		m.log.Info(
 			"ETH conservation invariant held",
 			"block", block.Number().Uint64(),
-			"num_touched_accounts", len(addresses),
+			"num_touched_accounts", len(balances.parent),
+			"source", balances.source,
 			"deposit_mint_amount", totalMinted,
 		)
+		return invariantResult{held: true}, nil
+	}
+
+	m.log.Warn(
+		fmt.Sprintf("ETH conservation invariant violated. %d != %d - %d", totalBalancesParent, totalBalancesCurrent, totalMinted),
+		"block", block.Number().Uint64(),
+	)
+
+	// Explain the balance change of each address to find the ones that gained ETH.
+	l, err := m.explainBlock(ctx, block, balances)
+	if err != nil {
+		return invariantResult{}, err
 	}
+	findings := l.findings(balances.parent, balances.current)
+	m.logFindings(block, findings)
+	return invariantResult{findings: findings}, nil
+}
 
-	return invariantHeld, nil
+// checkStrictAccounting checks that the change of the total balance of the touched addresses is exactly the ETH minted by the deposits minus the
+// ETH burned, and that the change of each address (the fee vaults included) is explained by the execution of the block.
+func (m *Monitor) checkStrictAccounting(
+	ctx context.Context,
+	block *types.Block,
+	balances *blockBalances,
+	totalBalancesParent, totalBalancesCurrent *big.Int,
+) (invariantResult, error) {
+	l, err := m.explainBlock(ctx, block, balances)
+	if err != nil {
+		return invariantResult{}, err
+	}
+	findings := l.findings(balances.parent, balances.current)
+
+	observed := new(big.Int).Sub(totalBalancesCurrent, totalBalancesParent)
+	expected := l.supplyChange()
+	held := observed.Cmp(expected) == 0 && len(findings) == 0
+
+	breakdown := []interface{}{"block", block.Number().Uint64(), "observed", observed, "expected", expected}
+	for _, component := range sortedComponents(l.components) {
+		breakdown = append(breakdown, component, l.components[component])
+	}
+	if held {
+		m.log.Info("ETH strict accounting held", breakdown...)
+	} else {
+		m.log.Warn("ETH strict accounting violated", breakdown...)
+		m.logFindings(block, findings)
+	}
+	return invariantResult{held: held, findings: findings, components: l.components}, nil
+}
+
+// explainBlock builds the ledger of a block, the block is call-traced if its balances come from the prestateTracer.
+func (m *Monitor) explainBlock(ctx context.Context, block *types.Block, balances *blockBalances) (*ledger, error) {
+	if balances.trace == nil {
+		trace, err := m.traceCalls(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		balances.trace = trace
+	}
+	receipts, err := m.client.BlockReceipts(ctx, rpc.BlockNumberOrHashWithHash(block.Hash(), false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block receipts: %w", err)
+	}
+	return explainBlock(block, balances.trace, receipts), nil
+}
+
+// logFindings logs the unexplained balance changes of a block.
+func (m *Monitor) logFindings(block *types.Block, findings []Finding) {
+	for _, finding := range findings {
+		m.log.Warn(
+			"unexplained balance change",
+			"block", block.Number().Uint64(),
+			"address", finding.Address,
+			"delta", finding.Delta,
+			"explained", finding.Explained,
+			"residual", finding.Residual,
+			"txs", finding.TxHashes,
+		)
+	}
+}
+
+// sortedComponents returns the names of the components in order.
+func sortedComponents(components map[string]*big.Int) []string {
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DepositMint returns the total amount of ETH minted by the deposit transactions of a block. The mint of a deposit is credited even if
+// the deposit fails.
+func DepositMint(block *types.Block) *big.Int {
+	totalMinted := big.NewInt(0)
+	for _, tx := range block.Transactions() {
+		// Check if the transaction is a deposit
+		if tx.IsDepositTx() && tx.Mint() != nil {
+			totalMinted = totalMinted.Add(totalMinted, tx.Mint())
+		}
+	}
+	return totalMinted
+}
+
+// toBigInts converts the balances returned by batchGetBalance.
+func toBigInts(balances map[common.Address]*hexutil.Big) map[common.Address]*big.Int {
+	converted := make(map[common.Address]*big.Int, len(balances))
+	for addr, balance := range balances {
+		converted[addr] = balance.ToInt()
+	}
+	return converted
 }
 
 // batchGetBalance retrieves the balance of multiple addresses at a specific block number in a single batch call.
@@ -0,0 +1,148 @@
+package conservation_monitor
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/predeploys"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	alice    = common.HexToAddress("0xa11ce")
+	bob      = common.HexToAddress("0xb0b")
+	contract = common.HexToAddress("0xc0de")
+	burner   = common.HexToAddress("0xb1")
+)
+
+func addr(a common.Address) *common.Address { return &a }
+
+func value(v int64) *hexutil.Big { return (*hexutil.Big)(big.NewInt(v)) }
+
+func testBlock(txs ...*types.Transaction) *types.Block {
+	header := &types.Header{Number: big.NewInt(10), BaseFee: big.NewInt(10)}
+	return types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: txs})
+}
+
+func TestExplainBlock(t *testing.T) {
+	deposit := types.NewTx(&types.DepositTx{From: alice, To: &contract, Mint: big.NewInt(1000), Value: big.NewInt(600)})
+	call := types.NewTx(&types.DynamicFeeTx{Nonce: 1, To: &contract, Value: big.NewInt(100)})
+	block := testBlock(deposit, call)
+
+	traces := []txTraceResult{
+		{TxHash: deposit.Hash(), Result: callTrace{Type: "CALL", From: alice, To: addr(contract), Value: value(600)}},
+		{TxHash: call.Hash(), Result: callTrace{Type: "CALL", From: bob, To: addr(contract), Value: value(100), Calls: []callTrace{
+			{Type: "CALL", From: contract, To: addr(alice), Value: value(50)},
+			{Type: "CALL", From: contract, To: addr(bob), Value: value(1), Error: "execution reverted"},
+			{Type: "CREATE", From: contract, To: addr(burner), Value: value(20), Calls: []callTrace{
+				{Type: "SELFDESTRUCT", From: burner, To: addr(burner), Value: value(20)},
+			}},
+		}}},
+	}
+	scalar, constant := uint64(2_000_000), uint64(5)
+	receipts := []*types.Receipt{
+		{TxHash: deposit.Hash(), Status: types.ReceiptStatusSuccessful},
+		{TxHash: call.Hash(), Status: types.ReceiptStatusSuccessful, GasUsed: 100, EffectiveGasPrice: big.NewInt(12), L1Fee: big.NewInt(7), OperatorFeeScalar: &scalar, OperatorFeeConstant: &constant},
+	}
+
+	l := explainBlock(block, traces, receipts)
+	require.Equal(t, big.NewInt(1000-600+50), l.explained(alice), "the mint and the transfers")
+	require.Equal(t, big.NewInt(-100-100*12-7-(100*2+5)), l.explained(bob), "the value and the fees")
+	require.Equal(t, big.NewInt(600+100-50-20), l.explained(contract), "the reverted call moved nothing")
+	require.Equal(t, big.NewInt(0), l.explained(burner), "the balance of the burner is destroyed")
+	require.Equal(t, big.NewInt(20), l.burned)
+	require.Equal(t, big.NewInt(100*10), l.explained(predeploys.BaseFeeVaultAddr))
+	require.Equal(t, big.NewInt(100*2), l.explained(predeploys.SequencerFeeVaultAddr))
+	require.Equal(t, big.NewInt(7), l.explained(predeploys.L1FeeVaultAddr))
+	require.Equal(t, big.NewInt(205), l.explained(predeploys.OperatorFeeVaultAddr))
+
+	require.Equal(t, big.NewInt(1000), l.components[ComponentMinted])
+	require.Equal(t, big.NewInt(20), l.components[ComponentOtherBurned])
+	require.Equal(t, big.NewInt(100*10), l.components[ComponentBaseFee])
+	require.Equal(t, big.NewInt(205), l.components[ComponentOperatorFee])
+	require.Equal(t, big.NewInt(1000-20), l.supplyChange())
+
+	// Bob gained 42 wei out of nowhere.
+	parent := map[common.Address]*big.Int{alice: big.NewInt(0), bob: big.NewInt(10_000), contract: big.NewInt(0)}
+	current := map[common.Address]*big.Int{
+		alice:    big.NewInt(450),
+		bob:      new(big.Int).Add(big.NewInt(10_000+42), l.explained(bob)),
+		contract: big.NewInt(630),
+	}
+	findings := l.findings(parent, current)
+	require.Len(t, findings, 1)
+	require.Equal(t, bob, findings[0].Address)
+	require.Equal(t, big.NewInt(42), findings[0].Residual)
+	require.Equal(t, []common.Hash{call.Hash()}, findings[0].TxHashes)
+}
+
+func TestExplainWithdrawalBurn(t *testing.T) {
+	withdrawal := types.NewTx(&types.DynamicFeeTx{To: &predeploys.L2ToL1MessagePasserAddr})
+	block := testBlock(withdrawal)
+	traces := []txTraceResult{
+		{TxHash: withdrawal.Hash(), Result: callTrace{Type: "CALL", From: alice, To: addr(predeploys.L2ToL1MessagePasserAddr), Value: value(0), Calls: []callTrace{
+			{Type: "CREATE", From: predeploys.L2ToL1MessagePasserAddr, To: addr(burner), Value: value(5000), Calls: []callTrace{
+				{Type: "SELFDESTRUCT", From: burner, To: addr(burner), Value: value(5000)},
+			}},
+		}}},
+	}
+
+	l := explainBlock(block, traces, nil)
+	require.Equal(t, big.NewInt(-5000), l.explained(predeploys.L2ToL1MessagePasserAddr))
+	require.Equal(t, big.NewInt(5000), l.components[ComponentWithdrawalsBurned])
+	require.Nil(t, l.components[ComponentOtherBurned])
+	require.Equal(t, big.NewInt(-5000), l.supplyChange())
+
+	// A self-destruct to itself outside of the creation transaction keeps the balance.
+	l = explainBlock(block, []txTraceResult{{TxHash: withdrawal.Hash(), Result: callTrace{Type: "SELFDESTRUCT", From: burner, To: addr(burner), Value: value(5000)}}}, nil)
+	require.Equal(t, big.NewInt(0), l.supplyChange())
+}
+
+func TestBalancesFromDiffs(t *testing.T) {
+	traces := []prestateTraceResult{
+		// alice pays bob, the contract is created.
+		{Result: prestateDiff{
+			Pre: map[common.Address]prestateAccount{
+				alice: {Balance: value(1000)},
+				bob:   {Balance: value(10)},
+			},
+			Post: map[common.Address]prestateAccount{
+				alice:    {Balance: value(800)},
+				bob:      {Balance: value(110)},
+				contract: {Balance: value(100)},
+			},
+		}},
+		// Only the nonce of alice changes, bob is deleted.
+		{Result: prestateDiff{
+			Pre: map[common.Address]prestateAccount{
+				alice: {Balance: value(800)},
+				bob:   {Balance: value(110)},
+			},
+			Post: map[common.Address]prestateAccount{
+				alice: {},
+			},
+		}},
+	}
+
+	balances := balancesFromDiffs(traces)
+	require.Equal(t, SourcePrestate, balances.source)
+	require.Equal(t, map[common.Address]*big.Int{alice: big.NewInt(1000), bob: big.NewInt(10), contract: big.NewInt(0)}, balances.parent)
+	require.Equal(t, map[common.Address]*big.Int{alice: big.NewInt(800), bob: big.NewInt(0), contract: big.NewInt(100)}, balances.current)
+
+	calltrace := &blockBalances{
+		source: SourceCallTrace,
+		// The call trace also sees burner, which didn't change.
+		parent:  map[common.Address]*big.Int{alice: big.NewInt(1000), bob: big.NewInt(10), contract: big.NewInt(0), burner: big.NewInt(7)},
+		current: map[common.Address]*big.Int{alice: big.NewInt(800), bob: big.NewInt(0), contract: big.NewInt(100), burner: big.NewInt(7)},
+	}
+	require.Empty(t, compareBalances(balances, calltrace))
+
+	calltrace.current[contract] = big.NewInt(90)
+	calltrace.current[burner] = big.NewInt(17)
+	mismatches := compareBalances(balances, calltrace)
+	require.ElementsMatch(t, []common.Address{contract, burner}, mismatches)
+	require.Len(t, mismatches, 2)
+}
@@ -0,0 +1,173 @@
+package conservation_monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum-optimism/optimism/op-service/predeploys"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+)
+
+const (
+	// SourceCallTrace gets the balances of the addresses of the call trace with eth_getBalance at the parent block and at the block.
+	SourceCallTrace = "calltrace"
+	// SourcePrestate gets the balances before and after each transaction from the prestateTracer in diff mode.
+	SourcePrestate = "prestate"
+)
+
+// feeVaults are credited outside of execution, they aren't picked up by the tracers.
+var feeVaults = []common.Address{
+	predeploys.L1FeeVaultAddr,
+	predeploys.SequencerFeeVaultAddr,
+	predeploys.BaseFeeVaultAddr,
+	predeploys.OperatorFeeVaultAddr,
+}
+
+// blockBalances are the balances of the addresses touched by a block, at the parent block and at the block.
+type blockBalances struct {
+	source  string
+	parent  map[common.Address]*big.Int
+	current map[common.Address]*big.Int
+	trace   []txTraceResult // the call trace of the block, nil until the block is call-traced
+}
+
+// prestateAccount is an account of the prestateTracer, only the balance is needed.
+type prestateAccount struct {
+	Balance *hexutil.Big `json:"balance,omitempty"`
+}
+
+// prestateDiff is the result of the prestateTracer in diff mode for a transaction: the modified accounts before and after it.
+type prestateDiff struct {
+	Pre  map[common.Address]prestateAccount `json:"pre"`
+	Post map[common.Address]prestateAccount `json:"post"`
+}
+
+// prestateTraceResult is the trace of a transaction returned by debug_traceBlockByHash with the prestateTracer.
+type prestateTraceResult struct {
+	TxHash common.Hash  `json:"txHash"`
+	Result prestateDiff `json:"result"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// prestateBalances returns the balances of the addresses modified by the block from a single prestateTracer trace. The fee vaults missing from the
+// trace are queried with eth_getBalance.
+func (m *Monitor) prestateBalances(ctx context.Context, block *types.Block) (*blockBalances, error) {
+	var traces []prestateTraceResult
+	tracer := "prestateTracer"
+	config := tracers.TraceConfig{Tracer: &tracer, TracerConfig: json.RawMessage(`{"diffMode":true}`)}
+	if err := m.client.Client().CallContext(ctx, &traces, "debug_traceBlockByHash", block.Hash(), config); err != nil {
+		return nil, fmt.Errorf("failed to trace block %s: %w", block.Hash().Hex(), err)
+	}
+	if len(traces) != len(block.Transactions()) {
+		return nil, fmt.Errorf("got %d traces for %d transactions", len(traces), len(block.Transactions()))
+	}
+	for _, trace := range traces {
+		if trace.Error != "" {
+			return nil, fmt.Errorf("failed to trace tx %s: %s", trace.TxHash, trace.Error)
+		}
+	}
+	balances := balancesFromDiffs(traces)
+
+	var missing []common.Address
+	for _, vault := range feeVaults {
+		if _, ok := balances.parent[vault]; !ok {
+			missing = append(missing, vault)
+		}
+	}
+	if len(missing) > 0 {
+		parent, err := batchGetBalance(ctx, missing, block.Number().Uint64()-1, m.client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent block balances: %w", err)
+		}
+		current, err := batchGetBalance(ctx, missing, block.Number().Uint64(), m.client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current block balances: %w", err)
+		}
+		for _, vault := range missing {
+			balances.parent[vault] = parent[vault].ToInt()
+			balances.current[vault] = current[vault].ToInt()
+		}
+	}
+	return balances, nil
+}
+
+// balancesFromDiffs chains the diffs of the transactions of a block: the balance at the parent block is the one before the first transaction
+// modifying the account, the balance at the block the one after the last.
+func balancesFromDiffs(traces []prestateTraceResult) *blockBalances {
+	balances := &blockBalances{
+		source:  SourcePrestate,
+		parent:  make(map[common.Address]*big.Int),
+		current: make(map[common.Address]*big.Int),
+	}
+	for _, trace := range traces {
+		for addr, pre := range trace.Result.Pre {
+			before := new(big.Int)
+			if pre.Balance != nil {
+				before = pre.Balance.ToInt()
+			}
+			if _, ok := balances.parent[addr]; !ok {
+				balances.parent[addr] = before
+			}
+			post, ok := trace.Result.Post[addr]
+			switch {
+			case !ok:
+				// The account was deleted.
+				balances.current[addr] = new(big.Int)
+			case post.Balance != nil:
+				balances.current[addr] = post.Balance.ToInt()
+			default:
+				// Only the other fields of the account changed.
+				balances.current[addr] = before
+			}
+		}
+		for addr, post := range trace.Result.Post {
+			if _, ok := trace.Result.Pre[addr]; ok {
+				continue
+			}
+			// The account was created by the transaction.
+			if _, ok := balances.parent[addr]; !ok {
+				balances.parent[addr] = new(big.Int)
+			}
+			balances.current[addr] = new(big.Int)
+			if post.Balance != nil {
+				balances.current[addr] = post.Balance.ToInt()
+			}
+		}
+	}
+	return balances
+}
+
+// compareBalances returns the addresses whose balance change differs between two sources, an address missing from a source didn't change.
+func compareBalances(a, b *blockBalances) []common.Address {
+	delta := func(balances *blockBalances, addr common.Address) *big.Int {
+		before, ok := balances.parent[addr]
+		if !ok {
+			return new(big.Int)
+		}
+		return new(big.Int).Sub(balances.current[addr], before)
+	}
+
+	var mismatches []common.Address
+	seen := make(map[common.Address]bool)
+	for _, balances := range []*blockBalances{a, b} {
+		for addr := range balances.parent {
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			if delta(a, addr).Cmp(delta(b, addr)) != 0 {
+				mismatches = append(mismatches, addr)
+			}
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Cmp(mismatches[j]) < 0
+	})
+	return mismatches
+}
@@ -2,6 +2,7 @@ package fault
 
 import (
 	"fmt"
+	"math"
 
 	opservice "github.com/ethereum-optimism/optimism/op-service"
 
@@ -14,18 +15,25 @@ const (
 	L1NodeURLFlagName = "l1.node.url"
 	L2NodeURLFlagName = "l2.node.url"
 
-	OptimismPortalAddressFlagName = "optimismportal.address"
-	L2OOAddressFlagName           = "l2oo.address"
-	StartOutputIndexFlagName      = "start.output.index"
+	OptimismPortalAddressFlagName     = "optimismportal.address"
+	L2OOAddressFlagName               = "l2oo.address"
+	DisputeGameFactoryAddressFlagName = "disputegamefactory.address"
+	StartOutputIndexFlagName          = "start.output.index"
+	StartGameIndexFlagName            = "start.game.index"
+	GameTypesFlagName                 = "game.types"
 )
 
 type CLIConfig struct {
 	L1NodeURL string
 	L2NodeURL string
 
-	OptimismPortalAddress common.Address
-	L2OOAddress           common.Address
-	StartOutputIndex      int64
+	OptimismPortalAddress     common.Address
+	L2OOAddress               common.Address
+	DisputeGameFactoryAddress common.Address
+	StartOutputIndex          int64
+	StartGameIndex            int64
+	// GameTypes are the dispute game types checked, all but the super root games if empty
+	GameTypes []uint32
 }
 
 func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
@@ -33,15 +41,38 @@ func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
 		L1NodeURL:        ctx.String(L1NodeURLFlagName),
 		L2NodeURL:        ctx.String(L2NodeURLFlagName),
 		StartOutputIndex: ctx.Int64(StartOutputIndexFlagName),
+		StartGameIndex:   ctx.Int64(StartGameIndexFlagName),
 	}
 
 	// Check if L2OO address is provided directly
 	l2OOAddress := ctx.String(L2OOAddressFlagName)
 	portalAddress := ctx.String(OptimismPortalAddressFlagName)
 
+	// Chains running fault proofs have no L2OutputOracle, their outputs are the root claims of the dispute games
+	if factoryAddress := ctx.String(DisputeGameFactoryAddressFlagName); factoryAddress != "" {
+		if l2OOAddress != "" || portalAddress != "" {
+			return cfg, fmt.Errorf("cannot provide --%s with --%s or --%s", DisputeGameFactoryAddressFlagName, L2OOAddressFlagName, OptimismPortalAddressFlagName)
+		}
+		if !common.IsHexAddress(factoryAddress) {
+			return cfg, fmt.Errorf("--%s is not a hex-encoded address", DisputeGameFactoryAddressFlagName)
+		}
+		cfg.DisputeGameFactoryAddress = common.HexToAddress(factoryAddress)
+
+		for _, gameType := range ctx.Uint64Slice(GameTypesFlagName) {
+			if gameType > math.MaxUint32 || isSuperGame(uint32(gameType)) {
+				return cfg, fmt.Errorf("--%s has an unsupported game type %d", GameTypesFlagName, gameType)
+			}
+			cfg.GameTypes = append(cfg.GameTypes, uint32(gameType))
+		}
+		return cfg, nil
+	}
+	if ctx.IsSet(GameTypesFlagName) {
+		return cfg, fmt.Errorf("--%s requires --%s", GameTypesFlagName, DisputeGameFactoryAddressFlagName)
+	}
+
 	// Validate that at least one address is provided
 	if l2OOAddress == "" && portalAddress == "" {
-		return cfg, fmt.Errorf("either --%s or --%s must be provided", L2OOAddressFlagName, OptimismPortalAddressFlagName)
+		return cfg, fmt.Errorf("either --%s, --%s or --%s must be provided", L2OOAddressFlagName, OptimismPortalAddressFlagName, DisputeGameFactoryAddressFlagName)
 	}
 
 	// Validate that both are not provided (to avoid confusion)
@@ -92,5 +123,21 @@ func CLIFlags(envVar string) []cli.Flag {
 			Usage:   "Address of the L2OutputOracle contract (alternative to optimismportal.address)",
 			EnvVars: opservice.PrefixEnvVar(envVar, "L2OO_ADDRESS"),
 		},
+		&cli.StringFlag{
+			Name:    DisputeGameFactoryAddressFlagName,
+			Usage:   "Address of the DisputeGameFactory contract, for chains running fault proofs (alternative to l2oo.address and optimismportal.address)",
+			EnvVars: opservice.PrefixEnvVar(envVar, "DISPUTE_GAME_FACTORY"),
+		},
+		&cli.Int64Flag{
+			Name:    StartGameIndexFlagName,
+			Usage:   "Dispute game index to start from. -1 to find the first game that may not be resolved",
+			Value:   -1,
+			EnvVars: opservice.PrefixEnvVar(envVar, "START_GAME_INDEX"),
+		},
+		&cli.Uint64SliceFlag{
+			Name:    GameTypesFlagName,
+			Usage:   "Dispute game types checked, the games of other types are skipped. Empty to check all but the super root games",
+			EnvVars: opservice.PrefixEnvVar(envVar, "GAME_TYPES"),
+		},
 	}
 }
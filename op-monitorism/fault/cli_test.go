@@ -0,0 +1,52 @@
+package fault
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func readFlags(t *testing.T, args ...string) (CLIConfig, error) {
+	set := flag.NewFlagSet("fault", flag.ContinueOnError)
+	for _, f := range CLIFlags("FAULT_MON_TEST") {
+		require.NoError(t, f.Apply(set))
+	}
+	require.NoError(t, set.Parse(args))
+	return ReadCLIFlags(cli.NewContext(cli.NewApp(), set, nil))
+}
+
+func TestReadCLIFlags(t *testing.T) {
+	address := "0x1111111111111111111111111111111111111111"
+
+	cfg, err := readFlags(t, "--l2oo.address", address)
+	require.NoError(t, err)
+	require.Equal(t, common.HexToAddress(address), cfg.L2OOAddress)
+	require.Equal(t, int64(-1), cfg.StartOutputIndex)
+
+	cfg, err = readFlags(t, "--disputegamefactory.address", address, "--game.types", "0,1", "--start.game.index", "3")
+	require.NoError(t, err)
+	require.Equal(t, common.HexToAddress(address), cfg.DisputeGameFactoryAddress)
+	require.Equal(t, []uint32{0, 1}, cfg.GameTypes)
+	require.Equal(t, int64(3), cfg.StartGameIndex)
+
+	for name, c := range map[string]struct {
+		args []string
+		err  string
+	}{
+		"no address":                 {nil, "must be provided"},
+		"l2oo and portal":            {[]string{"--l2oo.address", address, "--optimismportal.address", address}, "cannot provide both"},
+		"factory and l2oo":           {[]string{"--disputegamefactory.address", address, "--l2oo.address", address}, "cannot provide --disputegamefactory.address"},
+		"factory and portal":         {[]string{"--disputegamefactory.address", address, "--optimismportal.address", address}, "cannot provide --disputegamefactory.address"},
+		"invalid factory":            {[]string{"--disputegamefactory.address", "0x1234"}, "not a hex-encoded address"},
+		"invalid l2oo":               {[]string{"--l2oo.address", "0x1234"}, "not a hex-encoded address"},
+		"super root game type":       {[]string{"--disputegamefactory.address", address, "--game.types", "0,4"}, "unsupported game type 4"},
+		"game type above uint32":     {[]string{"--disputegamefactory.address", address, "--game.types", "4294967296"}, "unsupported game type"},
+		"game types without factory": {[]string{"--l2oo.address", address, "--game.types", "0"}, "--game.types requires --disputegamefactory.address"},
+	} {
+		_, err := readFlags(t, c.args...)
+		require.ErrorContains(t, err, c.err, name)
+	}
+}
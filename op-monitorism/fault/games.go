@@ -0,0 +1,364 @@
+package fault
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ethereum-optimism/monitorism/op-monitorism/faultproof_withdrawals/bindings/dispute"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Status of a dispute game, see GameStatus in the monorepo (src/dispute/lib/Types.sol).
+const (
+	gameStatusInProgress     uint8 = 0
+	gameStatusChallengerWins uint8 = 1
+	gameStatusDefenderWins   uint8 = 2
+)
+
+// Super-root game types. Their root claim commits to a super root spanning many chains, not to the output root of this chain. Kept in
+// sync with GameTypes.isSuperGame in the monorepo (src/dispute/lib/Types.sol).
+const (
+	gameTypeSuperCannon             uint32 = 4
+	gameTypeSuperPermissionedCannon uint32 = 5
+	gameTypeSuperAsteriscKona       uint32 = 7
+	gameTypeSuperCannonKona         uint32 = 9
+)
+
+// maxGameReadAttempts is the number of consecutive failed reads of a game after which it's skipped as unsupported, e.g. a custom game
+// type without l2BlockNumber or rootClaim.
+const maxGameReadAttempts = 10
+
+func isSuperGame(gameType uint32) bool {
+	switch gameType {
+	case gameTypeSuperCannon, gameTypeSuperPermissionedCannon, gameTypeSuperAsteriscKona, gameTypeSuperCannonKona:
+		return true
+	default:
+		return false
+	}
+}
+
+// mismatchedGame is a dispute game whose root claim doesn't match L2, tracked until it's resolved.
+type mismatchedGame struct {
+	index     uint64
+	gameType  uint32
+	deadlines gameDeadlines
+}
+
+// gameDeadlines are the times at which a game can resolve in favor of its root claim, zero if the game type doesn't expose a max clock
+// duration. An unchallenged root claim resolves once its clock runs out, while a challenged game can run until both clocks did.
+type gameDeadlines struct {
+	unchallenged time.Time
+	latest       time.Time
+}
+
+func newGameDeadlines(createdAt, maxClockDuration uint64) gameDeadlines {
+	return gameDeadlines{
+		unchallenged: time.Unix(int64(createdAt+maxClockDuration), 0),
+		latest:       time.Unix(int64(createdAt+2*maxClockDuration), 0),
+	}
+}
+
+// logContext returns the deadlines for the logs.
+func (d gameDeadlines) logContext() []interface{} {
+	return []interface{}{"unchallenged_deadline", formatDeadline(d.unchallenged), "latest_deadline", formatDeadline(d.latest)}
+}
+
+// formatDeadline formats the resolution deadline of a game for the logs.
+func formatDeadline(deadline time.Time) string {
+	if deadline.IsZero() {
+		return "unknown"
+	}
+	return deadline.String()
+}
+
+// initGames binds the DisputeGameFactory and finds the starting game index.
+func (m *Monitor) initGames(ctx context.Context, cfg CLIConfig) error {
+	dgf, err := dispute.NewDisputeGameFactoryCaller(cfg.DisputeGameFactoryAddress, m.l1Client)
+	if err != nil {
+		return fmt.Errorf("failed to bind to the DisputeGameFactory: %w", err)
+	}
+	m.dgf = dgf
+	m.gameTypes = cfg.GameTypes
+	m.unresolvedGames = make(map[common.Address]mismatchedGame)
+	m.log.Info("using provided DisputeGameFactory address", "address", cfg.DisputeGameFactoryAddress.String(), "game_types", cfg.GameTypes)
+
+	startingGameIndex := cfg.StartGameIndex
+	if startingGameIndex < 0 {
+		firstUnresolvedIndex, err := m.findFirstUnresolvedGameIndex(ctx)
+		if err != nil {
+			m.nodeConnectionFailures.WithLabelValues("l1", "firstUnresolvedGameIndex").Inc()
+			return fmt.Errorf("failed to find first unresolved game index: %w", err)
+		}
+		startingGameIndex = int64(firstUnresolvedIndex)
+	}
+
+	m.log.Info("configured starting game index", "index", startingGameIndex)
+	m.currGameIndex = uint64(startingGameIndex)
+	return nil
+}
+
+// runGames checks the root claim of the next dispute game against L2.
+func (m *Monitor) runGames(ctx context.Context) {
+	callOpts := &bind.CallOpts{Context: ctx}
+	m.refreshMismatchedGames(ctx)
+
+	// Check for available games to validate
+
+	gameCount, err := m.dgf.GameCount(callOpts)
+	if err != nil {
+		m.log.Error("failed to query game count", "err", err)
+		m.nodeConnectionFailures.WithLabelValues("l1", "gameCount").Inc()
+		return
+	}
+	if m.currGameIndex >= gameCount.Uint64() {
+		m.log.Info("waiting for next game", "index", m.currGameIndex, "game_count", gameCount)
+		return
+	}
+
+	m.highestGameIndex.WithLabelValues("known").Set(float64(gameCount.Int64()))
+	m.log.Info("checking game", "index", m.currGameIndex)
+
+	// Fetch Game
+
+	gameInfo, err := m.dgf.GameAtIndex(callOpts, new(big.Int).SetUint64(m.currGameIndex))
+	if err != nil {
+		m.log.Error("failed to query game", "index", m.currGameIndex, "err", err)
+		m.nodeConnectionFailures.WithLabelValues("l1", "gameAtIndex").Inc()
+		return
+	}
+	if isSuperGame(gameInfo.GameType) || (len(m.gameTypes) > 0 && !slices.Contains(m.gameTypes, gameInfo.GameType)) {
+		m.log.Warn("skipping unsupported game", "index", m.currGameIndex, "game_type", gameInfo.GameType, "game", gameInfo.Proxy.String(), "super_root", isSuperGame(gameInfo.GameType))
+		m.nextGame()
+		return
+	}
+
+	game, err := dispute.NewFaultDisputeGameCaller(gameInfo.Proxy, m.l1Client)
+	if err != nil {
+		m.gameReadFailed(gameInfo.GameType, gameInfo.Proxy, "failed to bind to the game", "bindGame", err)
+		return
+	}
+	l2BlockNumber, err := game.L2BlockNumber(callOpts)
+	if err != nil {
+		m.gameReadFailed(gameInfo.GameType, gameInfo.Proxy, "failed to query game l2 block number", "l2BlockNumber", err)
+		return
+	}
+	rootClaim, err := game.RootClaim(callOpts)
+	if err != nil {
+		m.gameReadFailed(gameInfo.GameType, gameInfo.Proxy, "failed to query game root claim", "rootClaim", err)
+		return
+	}
+	// The games that aren't FaultDisputeGames (e.g. OP Succinct) have no max clock duration, their deadlines are unknown.
+	var deadlines gameDeadlines
+	if maxClockDuration, err := game.MaxClockDuration(callOpts); err != nil {
+		m.log.Warn("failed to query game max clock duration, the resolution deadline is unknown", "game", gameInfo.Proxy.String(), "game_type", gameInfo.GameType, "err", err)
+	} else {
+		deadlines = newGameDeadlines(gameInfo.Timestamp, maxClockDuration)
+	}
+
+	l2Head, err := m.l2Client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		m.log.Error("failed to query latest l2 header", "err", err)
+		m.nodeConnectionFailures.WithLabelValues("l2", "headerByNumber").Inc()
+		return
+	}
+	gameType := strconv.FormatUint(uint64(gameInfo.GameType), 10)
+	if l2Head.Number.Cmp(l2BlockNumber) < 0 {
+		// A game can only be created for an L2 block that existed at its creation. Once the L2 head is past the creation of the game, a
+		// block number still above the head can't be checked and the root claim isn't trusted.
+		if l2Head.Time <= gameInfo.Timestamp {
+			m.log.Warn("l2 node is behind, waiting for sync...")
+			return
+		}
+		m.log.Error("game root claim for a future l2 block!!!", append([]interface{}{
+			"index", m.currGameIndex,
+			"game_type", gameType,
+			"game", gameInfo.Proxy.String(),
+			"l2_block_number", l2BlockNumber,
+			"l2_head", l2Head.Number,
+			"actual_root_claim", common.Hash(rootClaim).String(),
+		}, deadlines.logContext()...)...)
+		m.trackMismatchedGame(gameInfo.Proxy, mismatchedGame{index: m.currGameIndex, gameType: gameInfo.GameType, deadlines: deadlines})
+		return
+	}
+
+	// Fetch pre-image information for the output root from L2 to reconstruct
+
+	block, err := m.l2Client.BlockByNumber(ctx, l2BlockNumber)
+	if err != nil {
+		m.log.Error("failed to query l2 block", "height", l2BlockNumber, "err", err)
+		m.nodeConnectionFailures.WithLabelValues("l2", "blockByNumber").Inc()
+		return
+	}
+	outputRoot, err := m.outputRoot(ctx, block)
+	if err != nil {
+		m.log.Error("failed to query for proof response of l2ToL1MP contract", "err", err)
+		m.nodeConnectionFailures.WithLabelValues("l2", "getProof").Inc()
+		return
+	}
+
+	// Verify
+
+	if outputRoot != eth.Bytes32(rootClaim) {
+		m.log.Error("game root claim mismatch!!!", append([]interface{}{
+			"index", m.currGameIndex,
+			"game_type", gameType,
+			"game", gameInfo.Proxy.String(),
+			"l2_block_number", l2BlockNumber,
+			"expected_output_root", outputRoot.String(),
+			"actual_root_claim", common.Hash(rootClaim).String(),
+		}, deadlines.logContext()...)...)
+		m.trackMismatchedGame(gameInfo.Proxy, mismatchedGame{index: m.currGameIndex, gameType: gameInfo.GameType, deadlines: deadlines})
+		return
+	}
+
+	// Continue
+
+	m.log.Info("validated game", append([]interface{}{"index", m.currGameIndex, "game_type", gameType, "game", gameInfo.Proxy.String(), "root_claim", outputRoot.String()}, deadlines.logContext()...)...)
+	m.nextGame()
+}
+
+// nextGame moves to the next game once the current game is checked or skipped.
+func (m *Monitor) nextGame() {
+	m.highestGameIndex.WithLabelValues("checked").Set(float64(m.currGameIndex))
+	m.currGameIndex++
+	m.gameReadAttempts = 0
+}
+
+// gameReadFailed reports a failed read of the current game, which is retried at the next loop. After maxGameReadAttempts consecutive
+// failures the game is skipped as unsupported, so a game that always reverts doesn't block the games after it.
+func (m *Monitor) gameReadFailed(gameType uint32, address common.Address, msg string, section string, err error) {
+	m.gameReadAttempts++
+	m.log.Error(msg, "index", m.currGameIndex, "game_type", gameType, "game", address.String(), "attempt", m.gameReadAttempts, "err", err)
+	m.nodeConnectionFailures.WithLabelValues("l1", section).Inc()
+	if m.gameReadAttempts < maxGameReadAttempts {
+		return
+	}
+	m.log.Error("skipping unreadable game", "index", m.currGameIndex, "game_type", gameType, "game", address.String(), "attempts", m.gameReadAttempts)
+	m.unsupportedGames.WithLabelValues(strconv.FormatUint(uint64(gameType), 10)).Inc()
+	m.nextGame()
+}
+
+// trackMismatchedGame reports a game whose root claim doesn't match L2, tracks it until it's resolved and moves to the next game.
+func (m *Monitor) trackMismatchedGame(address common.Address, mismatched mismatchedGame) {
+	m.gameMismatches.WithLabelValues(strconv.FormatUint(uint64(mismatched.gameType), 10)).Inc()
+	m.unresolvedGames[address] = mismatched
+	m.nextGame()
+	m.updateMismatchedGames()
+}
+
+// refreshMismatchedGames stops tracking the mismatched games that are resolved, a game resolved in favor of its root claim is reported.
+func (m *Monitor) refreshMismatchedGames(ctx context.Context) {
+	callOpts := &bind.CallOpts{Context: ctx}
+	for address, mismatched := range m.unresolvedGames {
+		game, err := dispute.NewFaultDisputeGameCaller(address, m.l1Client)
+		if err != nil {
+			m.log.Error("failed to bind to the game", "game", address.String(), "err", err)
+			continue
+		}
+		status, err := game.Status(callOpts)
+		if err != nil {
+			m.log.Error("failed to query game status", "game", address.String(), "err", err)
+			m.nodeConnectionFailures.WithLabelValues("l1", "status").Inc()
+			continue
+		}
+
+		gameType := strconv.FormatUint(uint64(mismatched.gameType), 10)
+		switch status {
+		case gameStatusInProgress:
+			continue
+		case gameStatusDefenderWins:
+			m.log.Error("mismatched root claim won its game!!!", "index", mismatched.index, "game_type", gameType, "game", address.String())
+			m.mismatchedGamesDefended.WithLabelValues(gameType).Inc()
+		case gameStatusChallengerWins:
+			m.log.Info("mismatched root claim lost its game", "index", mismatched.index, "game_type", gameType, "game", address.String())
+		}
+		delete(m.unresolvedGames, address)
+	}
+	m.updateMismatchedGames()
+}
+
+// updateMismatchedGames reports the mismatched games that aren't resolved yet.
+func (m *Monitor) updateMismatchedGames() {
+	m.mismatchedGames.Reset()
+	for _, mismatched := range m.unresolvedGames {
+		m.mismatchedGames.WithLabelValues(strconv.FormatUint(uint64(mismatched.gameType), 10)).Inc()
+	}
+	if len(m.unresolvedGames) > 0 {
+		m.isCurrentlyMismatched.Set(1)
+	} else {
+		m.isCurrentlyMismatched.Set(0)
+	}
+}
+
+// findFirstUnresolvedGameIndex returns the index of the first game that may not be resolved yet. A game can't last longer than the clocks
+// of both parties, so the games created more than twice the max clock duration ago are resolvable.
+func (m *Monitor) findFirstUnresolvedGameIndex(ctx context.Context) (uint64, error) {
+	m.log.Info("searching for first unresolved game")
+	callOpts := &bind.CallOpts{Context: ctx}
+
+	latestHeader, err := m.l1Client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query latest header: %w", err)
+	}
+	gameCountBig, err := m.dgf.GameCount(callOpts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query game count: %w", err)
+	}
+	gameCount := gameCountBig.Uint64()
+	if gameCount == 0 {
+		return 0, nil
+	}
+
+	latestGame, err := m.dgf.GameAtIndex(callOpts, new(big.Int).SetUint64(gameCount-1))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query game index %d: %w", gameCount-1, err)
+	}
+	game, err := dispute.NewFaultDisputeGameCaller(latestGame.Proxy, m.l1Client)
+	if err != nil {
+		return 0, fmt.Errorf("failed to bind to the game: %w", err)
+	}
+	maxClockDuration, err := game.MaxClockDuration(callOpts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query max clock duration of the latest game (type %d), set --%s: %w", latestGame.GameType, StartGameIndexFlagName, err)
+	}
+
+	index, err := firstUnresolvedGameIndex(gameCount, 2*maxClockDuration, latestHeader.Time, func(index uint64) (uint64, error) {
+		gameInfo, err := m.dgf.GameAtIndex(callOpts, new(big.Int).SetUint64(index))
+		if err != nil {
+			return 0, fmt.Errorf("failed to query game index %d: %w", index, err)
+		}
+		return gameInfo.Timestamp, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	m.log.Info("first unresolved game index", "index", index)
+	return index, nil
+}
+
+// firstUnresolvedGameIndex binary searches the games, ordered by creation, for the first one created less than `window` seconds before
+// `now`. It returns `gameCount` if all the games are older.
+func firstUnresolvedGameIndex(gameCount, window, now uint64, timestampAt func(index uint64) (uint64, error)) (uint64, error) {
+	low, high := uint64(0), gameCount
+	for low < high {
+		mid := (low + high) / 2
+		timestamp, err := timestampAt(mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if timestamp+window < now {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
@@ -0,0 +1,285 @@
+package fault
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/monitorism/op-monitorism/faultproof_withdrawals/bindings/dispute"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var factoryAddress = common.HexToAddress("0xfac7")
+
+type callArgs struct {
+	To   common.Address `json:"to"`
+	Data hexutil.Bytes  `json:"input"`
+}
+
+// testGame is a dispute game served by the gameService, a nil max clock duration reverts like the games that aren't FaultDisputeGames
+type testGame struct {
+	gameType         uint32
+	timestamp        uint64
+	l2BlockNumber    uint64
+	rootClaim        common.Hash
+	maxClockDuration *uint64
+	status           *uint8 // nil reverts
+	unreadable       bool   // l2BlockNumber and rootClaim revert, like a custom game type
+}
+
+// gameService serves the calls to the DisputeGameFactory and its games on L1, and the head of L2
+type gameService struct {
+	factoryABI *abi.ABI
+	gameABI    *abi.ABI
+	games      []common.Address
+	byAddress  map[common.Address]*testGame
+	l2Head     *types.Header
+}
+
+func newGameService(t *testing.T) *gameService {
+	factoryABI, err := dispute.DisputeGameFactoryMetaData.GetAbi()
+	require.NoError(t, err)
+	gameABI, err := dispute.FaultDisputeGameMetaData.GetAbi()
+	require.NoError(t, err)
+	return &gameService{factoryABI: factoryABI, gameABI: gameABI, byAddress: make(map[common.Address]*testGame)}
+}
+
+func (s *gameService) addGame(game *testGame) common.Address {
+	address := common.BigToAddress(big.NewInt(int64(0x1000 + len(s.games))))
+	s.games = append(s.games, address)
+	s.byAddress[address] = game
+	return address
+}
+
+func (s *gameService) Call(args callArgs, block string) (hexutil.Bytes, error) {
+	if args.To == factoryAddress {
+		method, err := s.factoryABI.MethodById(args.Data[:4])
+		if err != nil {
+			return nil, err
+		}
+		switch method.Name {
+		case "gameCount":
+			return method.Outputs.Pack(big.NewInt(int64(len(s.games))))
+		case "gameAtIndex":
+			inputs, err := method.Inputs.Unpack(args.Data[4:])
+			if err != nil {
+				return nil, err
+			}
+			address := s.games[inputs[0].(*big.Int).Uint64()]
+			game := s.byAddress[address]
+			return method.Outputs.Pack(game.gameType, game.timestamp, address)
+		}
+		return nil, errors.New("execution reverted")
+	}
+
+	game, ok := s.byAddress[args.To]
+	if !ok {
+		return nil, errors.New("execution reverted")
+	}
+	method, err := s.gameABI.MethodById(args.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case game.unreadable && (method.Name == "l2BlockNumber" || method.Name == "rootClaim"):
+		return nil, errors.New("execution reverted")
+	case method.Name == "l2BlockNumber":
+		return method.Outputs.Pack(new(big.Int).SetUint64(game.l2BlockNumber))
+	case method.Name == "rootClaim":
+		return method.Outputs.Pack(game.rootClaim)
+	case method.Name == "maxClockDuration" && game.maxClockDuration != nil:
+		return method.Outputs.Pack(*game.maxClockDuration)
+	case method.Name == "status" && game.status != nil:
+		return method.Outputs.Pack(*game.status)
+	}
+	return nil, errors.New("execution reverted")
+}
+
+func (s *gameService) GetBlockByNumber(number string, full bool) (*types.Header, error) {
+	return s.l2Head, nil
+}
+
+func newTestMonitor(t *testing.T, service *gameService) *Monitor {
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("eth", service))
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	t.Cleanup(client.Close)
+
+	dgf, err := dispute.NewDisputeGameFactoryCaller(factoryAddress, client)
+	require.NoError(t, err)
+	return &Monitor{
+		log:                     log.New(),
+		l1Client:                client,
+		l2Client:                client,
+		dgf:                     dgf,
+		unresolvedGames:         make(map[common.Address]mismatchedGame),
+		isCurrentlyMismatched:   prometheus.NewGauge(prometheus.GaugeOpts{Name: "isCurrentlyMismatched"}),
+		nodeConnectionFailures:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "nodeConnectionFailures"}, []string{"layer", "section"}),
+		highestGameIndex:        prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "highestGameIndex"}, []string{"type"}),
+		mismatchedGames:         prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "mismatchedGames"}, []string{"game_type"}),
+		gameMismatches:          prometheus.NewCounterVec(prometheus.CounterOpts{Name: "gameMismatches"}, []string{"game_type"}),
+		mismatchedGamesDefended: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mismatchedGamesDefended"}, []string{"game_type"}),
+		unsupportedGames:        prometheus.NewCounterVec(prometheus.CounterOpts{Name: "unsupportedGames"}, []string{"game_type"}),
+	}
+}
+
+func status(s uint8) *uint8 {
+	return &s
+}
+
+func TestFirstUnresolvedGameIndex(t *testing.T) {
+	timestamps := []uint64{100, 200, 300, 400}
+	timestampAt := func(index uint64) (uint64, error) {
+		return timestamps[index], nil
+	}
+	for now, expected := range map[uint64]uint64{
+		0:    0, // all the games may be in progress
+		150:  0, // 100+50 isn't before now, the first game may still be in progress
+		151:  1,
+		350:  2, // the boundary: a game created exactly a window ago isn't resolvable
+		351:  3,
+		1000: 4, // all the games are resolvable, the next game is the first one to check
+	} {
+		index, err := firstUnresolvedGameIndex(uint64(len(timestamps)), 50, now, timestampAt)
+		require.NoError(t, err)
+		require.Equal(t, expected, index, "now %d", now)
+	}
+
+	index, err := firstUnresolvedGameIndex(0, 50, 1000, timestampAt)
+	require.NoError(t, err)
+	require.Zero(t, index, "no game")
+
+	_, err = firstUnresolvedGameIndex(4, 50, 1000, func(uint64) (uint64, error) { return 0, errors.New("rpc error") })
+	require.ErrorContains(t, err, "rpc error")
+}
+
+func TestFindFirstUnresolvedGameIndex(t *testing.T) {
+	service := newGameService(t)
+	clock := uint64(100)
+	for _, timestamp := range []uint64{1000, 1200, 1400} {
+		service.addGame(&testGame{gameType: 0, timestamp: timestamp, maxClockDuration: &clock})
+	}
+	service.l2Head = &types.Header{Number: big.NewInt(1), Time: 1300, Difficulty: new(big.Int)}
+	monitor := newTestMonitor(t, service)
+
+	// The games created more than twice the max clock duration ago are resolvable.
+	index, err := monitor.findFirstUnresolvedGameIndex(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), index)
+
+	// The window is unknown if the latest game has no max clock duration.
+	service.addGame(&testGame{gameType: 42, timestamp: 1500})
+	_, err = monitor.findFirstUnresolvedGameIndex(t.Context())
+	require.ErrorContains(t, err, "--start.game.index")
+}
+
+func TestRefreshMismatchedGames(t *testing.T) {
+	service := newGameService(t)
+	inProgress := service.addGame(&testGame{gameType: 0, status: status(gameStatusInProgress)})
+	defended := service.addGame(&testGame{gameType: 1, status: status(gameStatusDefenderWins)})
+	challenged := service.addGame(&testGame{gameType: 0, status: status(gameStatusChallengerWins)})
+	failing := service.addGame(&testGame{gameType: 0})
+	monitor := newTestMonitor(t, service)
+	for index, address := range service.games {
+		monitor.unresolvedGames[address] = mismatchedGame{index: uint64(index), gameType: service.byAddress[address].gameType}
+	}
+
+	// The resolved games are no longer tracked, the games in progress and the games whose status can't be read are kept.
+	monitor.refreshMismatchedGames(t.Context())
+	require.Len(t, monitor.unresolvedGames, 2)
+	require.Contains(t, monitor.unresolvedGames, inProgress)
+	require.Contains(t, monitor.unresolvedGames, failing)
+	require.NotContains(t, monitor.unresolvedGames, defended)
+	require.NotContains(t, monitor.unresolvedGames, challenged)
+	require.Equal(t, 1.0, testutil.ToFloat64(monitor.mismatchedGamesDefended.WithLabelValues("1")), "a mismatched root claim won its game")
+	require.Equal(t, 0.0, testutil.ToFloat64(monitor.mismatchedGamesDefended.WithLabelValues("0")))
+	require.Equal(t, 1.0, testutil.ToFloat64(monitor.nodeConnectionFailures.WithLabelValues("l1", "status")))
+	require.Equal(t, 2.0, testutil.ToFloat64(monitor.mismatchedGames.WithLabelValues("0")))
+	require.Equal(t, 1.0, testutil.ToFloat64(monitor.isCurrentlyMismatched))
+
+	// Once all the games are resolved, the state is no longer mismatched.
+	service.byAddress[inProgress].status = status(gameStatusChallengerWins)
+	service.byAddress[failing].status = status(gameStatusChallengerWins)
+	monitor.refreshMismatchedGames(t.Context())
+	require.Empty(t, monitor.unresolvedGames)
+	require.Equal(t, 0, testutil.CollectAndCount(monitor.mismatchedGames))
+	require.Equal(t, 0.0, testutil.ToFloat64(monitor.isCurrentlyMismatched))
+	require.Equal(t, 1.0, testutil.ToFloat64(monitor.mismatchedGamesDefended.WithLabelValues("1")))
+}
+
+func TestRunGamesSkipsAndFutureBlocks(t *testing.T) {
+	service := newGameService(t)
+	service.addGame(&testGame{gameType: gameTypeSuperCannon, timestamp: 1000})
+	service.addGame(&testGame{gameType: 42, timestamp: 1000})
+	// A game without a max clock duration, whose l2 block number is above the l2 head.
+	future := service.addGame(&testGame{gameType: 1, timestamp: 1000, l2BlockNumber: 100, rootClaim: common.HexToHash("0x01")})
+	service.l2Head = &types.Header{Number: big.NewInt(50), Time: 900, Difficulty: new(big.Int)}
+	monitor := newTestMonitor(t, service)
+	monitor.gameTypes = []uint32{0, 1}
+
+	// The super root game and the game type that isn't checked are skipped.
+	monitor.runGames(t.Context())
+	monitor.runGames(t.Context())
+	require.Equal(t, uint64(2), monitor.currGameIndex)
+	require.Equal(t, 0.0, testutil.ToFloat64(monitor.gameMismatches.WithLabelValues("42")))
+
+	// The l2 node hasn't reached the creation of the game yet, it may be behind.
+	monitor.runGames(t.Context())
+	require.Equal(t, uint64(2), monitor.currGameIndex)
+	require.Empty(t, monitor.unresolvedGames)
+
+	// Past the creation of the game, the block can't be checked: the game is tracked as mismatched with an unknown deadline.
+	service.l2Head = &types.Header{Number: big.NewInt(60), Time: 1001, Difficulty: new(big.Int)}
+	service.byAddress[future].status = status(gameStatusInProgress)
+	monitor.runGames(t.Context())
+	require.Equal(t, uint64(3), monitor.currGameIndex)
+	require.Contains(t, monitor.unresolvedGames, future)
+	require.True(t, monitor.unresolvedGames[future].deadlines.unchallenged.IsZero())
+	require.True(t, monitor.unresolvedGames[future].deadlines.latest.IsZero())
+	require.Equal(t, 1.0, testutil.ToFloat64(monitor.gameMismatches.WithLabelValues("1")))
+	require.Equal(t, 1.0, testutil.ToFloat64(monitor.isCurrentlyMismatched))
+	require.Equal(t, 2.0, testutil.ToFloat64(monitor.highestGameIndex.WithLabelValues("checked")))
+
+	// The game is resolved against its root claim.
+	service.byAddress[future].status = status(gameStatusChallengerWins)
+	monitor.runGames(t.Context())
+	require.Empty(t, monitor.unresolvedGames)
+	require.Equal(t, 0.0, testutil.ToFloat64(monitor.isCurrentlyMismatched))
+}
+
+func TestRunGamesSkipsUnreadableGames(t *testing.T) {
+	service := newGameService(t)
+	clock := uint64(100)
+	service.addGame(&testGame{gameType: 42, timestamp: 1000, unreadable: true})
+	future := service.addGame(&testGame{gameType: 0, timestamp: 1000, l2BlockNumber: 100, maxClockDuration: &clock, status: status(gameStatusInProgress)})
+	service.l2Head = &types.Header{Number: big.NewInt(50), Time: 1001, Difficulty: new(big.Int)}
+	monitor := newTestMonitor(t, service)
+
+	// The game is retried, then skipped as unsupported so the next games are still checked.
+	for attempt := 1; attempt < maxGameReadAttempts; attempt++ {
+		monitor.runGames(t.Context())
+		require.Zero(t, monitor.currGameIndex)
+		require.Equal(t, attempt, monitor.gameReadAttempts)
+	}
+	monitor.runGames(t.Context())
+	require.Equal(t, uint64(1), monitor.currGameIndex)
+	require.Zero(t, monitor.gameReadAttempts)
+	require.Equal(t, 1.0, testutil.ToFloat64(monitor.unsupportedGames.WithLabelValues("42")))
+	require.Equal(t, float64(maxGameReadAttempts), testutil.ToFloat64(monitor.nodeConnectionFailures.WithLabelValues("l1", "l2BlockNumber")))
+
+	// A challenged game can run for twice its max clock duration.
+	monitor.runGames(t.Context())
+	require.Equal(t, uint64(2), monitor.currGameIndex)
+	require.Equal(t, gameDeadlines{unchallenged: time.Unix(1100, 0), latest: time.Unix(1200, 0)}, monitor.unresolvedGames[future].deadlines)
+}
@@ -6,6 +6,7 @@ import (
 	"math/big"
 	"time"
 
+	"github.com/ethereum-optimism/monitorism/op-monitorism/faultproof_withdrawals/bindings/dispute"
 	"github.com/ethereum-optimism/monitorism/op-monitorism/multisig/bindings"
 	"github.com/ethereum-optimism/optimism/op-bindings/predeploys"
 	"github.com/ethereum-optimism/optimism/op-service/eth"
@@ -15,6 +16,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/log"
 )
@@ -34,10 +36,24 @@ type Monitor struct {
 
 	l2OO *bindings.L2OutputOracleCaller
 
+	// dispute games, on chains running fault proofs
+	dgf           *dispute.DisputeGameFactoryCaller
+	gameTypes     []uint32 // the game types checked, all but the super root games if empty
+	currGameIndex uint64
+	// the consecutive failed reads of the current game
+	gameReadAttempts int
+	unresolvedGames  map[common.Address]mismatchedGame
+
 	// metrics
 	highestOutputIndex     *prometheus.GaugeVec
 	isCurrentlyMismatched  prometheus.Gauge
 	nodeConnectionFailures *prometheus.CounterVec
+	highestGameIndex       *prometheus.GaugeVec
+	mismatchedGames        *prometheus.GaugeVec
+	gameMismatches         *prometheus.CounterVec
+	// a mismatched root claim that wins its game can be used to prove withdrawals
+	mismatchedGamesDefended *prometheus.CounterVec
+	unsupportedGames        *prometheus.CounterVec
 }
 
 func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIConfig) (*Monitor, error) {
@@ -52,6 +68,61 @@ func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIC
 		return nil, fmt.Errorf("failed to dial l2: %w", err)
 	}
 
+	monitor := &Monitor{
+		log: log,
+
+		l1Client: l1Client,
+		l2Client: l2Client,
+
+		highestOutputIndex: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "highestOutputIndex",
+			Help:      "Highest output indices (checked and known)",
+		}, []string{"type"}),
+		isCurrentlyMismatched: m.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "isCurrentlyMismatched",
+			Help:      "0 if state is ok, 1 if state is mismatched",
+		}),
+		nodeConnectionFailures: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "nodeConnectionFailures",
+			Help:      "number of times node connection has failed",
+		}, []string{"layer", "section"}),
+		highestGameIndex: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "highestGameIndex",
+			Help:      "Highest dispute game indices (checked and known)",
+		}, []string{"type"}),
+		mismatchedGames: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "mismatchedGames",
+			Help:      "Number of unresolved dispute games whose root claim doesn't match L2, by game type",
+		}, []string{"game_type"}),
+		gameMismatches: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "gameMismatches",
+			Help:      "Number of dispute games whose root claim doesn't match L2, by game type",
+		}, []string{"game_type"}),
+		mismatchedGamesDefended: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "mismatchedGamesDefended",
+			Help:      "Number of dispute games resolved in favor of a root claim that doesn't match L2, by game type",
+		}, []string{"game_type"}),
+		unsupportedGames: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "unsupportedGames",
+			Help:      "Number of dispute games skipped as their root claim couldn't be read, by game type",
+		}, []string{"game_type"}),
+	}
+
+	if cfg.DisputeGameFactoryAddress != (common.Address{}) {
+		if err := monitor.initGames(ctx, cfg); err != nil {
+			return nil, err
+		}
+		return monitor, nil
+	}
+
 	var l2OOAddress common.Address
 	var l2OO *bindings.L2OutputOracleCaller
 
@@ -81,32 +152,8 @@ func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIC
 	if err != nil {
 		return nil, fmt.Errorf("failed to query for finalization window: %w", err)
 	}
-
-	monitor := &Monitor{
-		log: log,
-
-		l1Client: l1Client,
-		l2Client: l2Client,
-
-		l2OO:             l2OO,
-		faultProofWindow: faultProofWindow.Uint64(),
-
-		highestOutputIndex: m.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: MetricsNamespace,
-			Name:      "highestOutputIndex",
-			Help:      "Highest output indices (checked and known)",
-		}, []string{"type"}),
-		isCurrentlyMismatched: m.NewGauge(prometheus.GaugeOpts{
-			Namespace: MetricsNamespace,
-			Name:      "isCurrentlyMismatched",
-			Help:      "0 if state is ok, 1 if state is mismatched",
-		}),
-		nodeConnectionFailures: m.NewCounterVec(prometheus.CounterOpts{
-			Namespace: MetricsNamespace,
-			Name:      "nodeConnectionFailures",
-			Help:      "number of times node connection has failed",
-		}, []string{"layer", "section"}),
-	}
+	monitor.l2OO = l2OO
+	monitor.faultProofWindow = faultProofWindow.Uint64()
 
 	startingOutputIndex := cfg.StartOutputIndex
 	if startingOutputIndex < 0 {
@@ -124,6 +171,11 @@ func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIC
 }
 
 func (m *Monitor) Run(ctx context.Context) {
+	if m.dgf != nil {
+		m.runGames(ctx)
+		return
+	}
+
 	callOpts := &bind.CallOpts{Context: ctx}
 
 	// Check for available outputs to validate
@@ -169,9 +221,8 @@ func (m *Monitor) Run(ctx context.Context) {
 		m.nodeConnectionFailures.WithLabelValues("l2", "blockByNumber").Inc()
 		return
 	}
-	proof := struct{ StorageHash common.Hash }{}
-	if err := m.l2Client.Client().CallContext(ctx, &proof, "eth_getProof",
-		predeploys.L2ToL1MessagePasserAddr, nil, hexutil.EncodeBig(block.Number())); err != nil {
+	outputRoot, err := m.outputRoot(ctx, block)
+	if err != nil {
 		m.log.Error("failed to query for proof response of l2ToL1MP contract", "err", err)
 		m.nodeConnectionFailures.WithLabelValues("l2", "getProof").Inc()
 		return
@@ -179,7 +230,6 @@ func (m *Monitor) Run(ctx context.Context) {
 
 	// Reconstruct & verify
 
-	outputRoot := eth.OutputRoot(&eth.OutputV0{StateRoot: eth.Bytes32(block.Root()), MessagePasserStorageRoot: eth.Bytes32(proof.StorageHash), BlockHash: block.Hash()})
 	if outputRoot != eth.Bytes32(output.OutputRoot) {
 		m.log.Error("output root mismatch!!!",
 			"index", m.currOutputIndex,
@@ -201,6 +251,16 @@ func (m *Monitor) Run(ctx context.Context) {
 	m.isCurrentlyMismatched.Set(0)
 }
 
+// outputRoot reconstructs the output root of an L2 block.
+func (m *Monitor) outputRoot(ctx context.Context, block *types.Block) (eth.Bytes32, error) {
+	proof := struct{ StorageHash common.Hash }{}
+	if err := m.l2Client.Client().CallContext(ctx, &proof, "eth_getProof",
+		predeploys.L2ToL1MessagePasserAddr, nil, hexutil.EncodeBig(block.Number())); err != nil {
+		return eth.Bytes32{}, err
+	}
+	return eth.OutputRoot(&eth.OutputV0{StateRoot: eth.Bytes32(block.Root()), MessagePasserStorageRoot: eth.Bytes32(proof.StorageHash), BlockHash: block.Hash()}), nil
+}
+
 func (m *Monitor) Close(_ context.Context) error {
 	m.l1Client.Close()
 	m.l2Client.Close()
@@ -0,0 +1,174 @@
+package global_events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// DedupTxHash deduplicates the matches of a rule by transaction.
+	DedupTxHash = "tx_hash"
+	// DedupAddress deduplicates the matches of a rule by address (the emitter of the log or the address called).
+	DedupAddress = "address"
+
+	// maxSummaryTxHashes is the maximum number of transactions listed by the summary of a block.
+	maxSummaryTxHashes = 10
+)
+
+// Alert controls how the matches of a rule are alerted (logged and counted by `alertsEmitted`), the `eventEmitted` and `callDetected` metrics still count every match.
+// The matches suppressed by the deduplication or the cooldown are only logged at the debug level.
+type Alert struct {
+	DedupKey string        `yaml:"dedup_key,omitempty"` // `tx_hash`, `address` or the name of a decoded field of the events: a single alert per block (or per `cooldown`) for each key.
+	Cooldown time.Duration `yaml:"cooldown,omitempty"`  // the block time during which the other matches of the rule (with the same key if `dedup_key` is set) are suppressed after an alert (e.g: "30m").
+	Summary  bool          `yaml:"summary,omitempty"`   // aggregate the alerts of a block into a single alert.
+}
+
+// Validate ensures the alert is usable.
+func (a Alert) Validate() error {
+	if a.Cooldown < 0 {
+		return fmt.Errorf("the alert cooldown %s can't be negative", a.Cooldown)
+	}
+	if a.DedupKey == "" && a.Cooldown == 0 && !a.Summary {
+		return fmt.Errorf("the alert requires a dedup_key, a cooldown or the summary")
+	}
+	return nil
+}
+
+// ValidateDedupKey ensures a `dedup_key` naming a decoded field is a parameter of every event of the rule. The calls are not decoded, so the rules with calls can't be deduplicated by field.
+func (a Alert) ValidateDedupKey(config Configuration) error {
+	if a.DedupKey == "" || a.DedupKey == DedupTxHash || a.DedupKey == DedupAddress {
+		return nil
+	}
+	if len(config.Calls) > 0 {
+		return fmt.Errorf("the dedup_key %q is a decoded field but the calls are not decoded, use %q or %q", a.DedupKey, DedupTxHash, DedupAddress)
+	}
+	if len(config.Events) == 0 {
+		return fmt.Errorf("the dedup_key %q is a decoded field but the rule has no event", a.DedupKey)
+	}
+	for _, event := range config.Events {
+		if event.abiEvent == nil {
+			return fmt.Errorf("the dedup_key %q is a decoded field but the signature %q can't be decoded", a.DedupKey, event.Signature)
+		}
+		found := false
+		for _, argument := range event.abiEvent.Inputs {
+			if argument.Name == a.DedupKey {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("the dedup_key %q is not a field of the event %s (expected %q, %q or a parameter name)", a.DedupKey, event.Signature, DedupTxHash, DedupAddress)
+		}
+	}
+	return nil
+}
+
+// Key returns the deduplication key of a match. A match whose field can't be decoded is keyed by its transaction, so it is never merged with the other matches.
+func (a Alert) Key(txHash common.Hash, address common.Address, decoded DecodedLog) string {
+	switch a.DedupKey {
+	case "":
+		return ""
+	case DedupTxHash:
+		return txHash.Hex()
+	case DedupAddress:
+		return address.Hex()
+	}
+	if value, ok := decoded.Values[a.DedupKey]; ok {
+		return formatValue(value)
+	}
+	return txHash.Hex()
+}
+
+// AlertState is the last alert of a deduplication key, stored in the checkpoint so the cooldowns survive the restarts.
+type AlertState struct {
+	Block uint64 `json:"block"` // the block number of the alert.
+	Time  uint64 `json:"time"`  // the block timestamp of the alert.
+}
+
+// Suppressed returns true if a match with a key last alerted at `last` is suppressed in the block `number` at the block timestamp `timestamp`.
+func (a Alert) Suppressed(last *AlertState, number uint64, timestamp uint64) bool {
+	if last == nil || (a.DedupKey == "" && a.Cooldown == 0) {
+		return false
+	}
+	return last.Block == number || timestamp < last.Time+uint64(a.Cooldown/time.Second)
+}
+
+// alertSummary aggregates the alerts of a rule in a block.
+type alertSummary struct {
+	config   Configuration
+	alerts   int
+	txHashes []common.Hash
+}
+
+// alert reports a match of a rule: it is logged with `msg` and `ctx` (or aggregated into the summary of the block) unless the `alert` of the rule suppresses it.
+func (c *chainMonitor) alert(block *types.Block, config Configuration, key string, txHash common.Hash, msg string, ctx ...interface{}) {
+	if config.Alert == nil {
+		c.log.Info(msg, ctx...)
+		c.alertsEmitted.WithLabelValues(c.nickname, c.chain, config.Name, config.Priority).Inc()
+		return
+	}
+
+	keys := c.alerts[config.Name]
+	if config.Alert.Suppressed(keys[key], block.NumberU64(), block.Time()) {
+		c.log.Debug(msg, append(ctx, "Suppressed", true, "DedupKey", key)...)
+		c.alertsSuppressed.WithLabelValues(c.nickname, c.chain, config.Name, config.Priority).Inc()
+		return
+	}
+	if config.Alert.DedupKey != "" || config.Alert.Cooldown > 0 {
+		if keys == nil {
+			keys = make(map[string]*AlertState)
+			c.alerts[config.Name] = keys
+		}
+		keys[key] = &AlertState{Block: block.NumberU64(), Time: block.Time()}
+	}
+
+	if !config.Alert.Summary {
+		c.log.Info(msg, ctx...)
+		c.alertsEmitted.WithLabelValues(c.nickname, c.chain, config.Name, config.Priority).Inc()
+		return
+	}
+	c.log.Debug(msg, ctx...)
+	summary, ok := c.summaries[config.Name]
+	if !ok {
+		summary = &alertSummary{config: config}
+		c.summaries[config.Name] = summary
+	}
+	summary.alerts++
+	if len(summary.txHashes) < maxSummaryTxHashes && (len(summary.txHashes) == 0 || summary.txHashes[len(summary.txHashes)-1] != txHash) {
+		summary.txHashes = append(summary.txHashes, txHash)
+	}
+}
+
+// flushAlerts logs the summaries of the block and forgets the deduplication keys whose cooldown is over.
+func (c *chainMonitor) flushAlerts(block *types.Block) {
+	for name, summary := range c.summaries {
+		c.log.Info("Alert Summary", "RuleName", name, "Priority", summary.config.Priority, "CurrentBlock", block.Number().String(), "Matches", summary.alerts, "TxHashes", summary.txHashes)
+		c.alertsEmitted.WithLabelValues(c.nickname, c.chain, name, summary.config.Priority).Inc()
+		delete(c.summaries, name)
+	}
+	for _, config := range c.globalconfig.Configuration {
+		if config.Alert == nil {
+			continue
+		}
+		for key, last := range c.alerts[config.Name] {
+			if !config.Alert.Suppressed(last, block.NumberU64()+1, block.Time()) {
+				delete(c.alerts[config.Name], key)
+			}
+		}
+	}
+}
+
+// restoreAlerts restores the last alerts of the rules from the checkpoint, the alerts of the rules without `alert` are dropped.
+func (c *chainMonitor) restoreAlerts(checkpoint *Checkpoint) {
+	if checkpoint == nil {
+		return
+	}
+	for _, config := range c.globalconfig.Configuration {
+		if keys, ok := checkpoint.Alerts[config.Name]; ok && config.Alert != nil && keys != nil {
+			c.alerts[config.Name] = keys
+		}
+	}
+}
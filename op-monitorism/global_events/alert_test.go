@@ -0,0 +1,138 @@
+package global_events
+
+import (
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertValidate(t *testing.T) {
+	require.NoError(t, Alert{DedupKey: DedupTxHash}.Validate())
+	require.NoError(t, Alert{Cooldown: time.Hour}.Validate())
+	require.NoError(t, Alert{Summary: true}.Validate())
+	require.Error(t, Alert{}.Validate(), "an alert without effect")
+	require.Error(t, Alert{Cooldown: -time.Second}.Validate())
+}
+
+func TestAlertKey(t *testing.T) {
+	txHash := common.HexToHash("0x01")
+	decoded := DecodedLog{Names: []string{"owner"}, Values: map[string]interface{}{"owner": aliceAddress}}
+
+	require.Equal(t, "", Alert{Cooldown: time.Hour}.Key(txHash, safeAddress, decoded))
+	require.Equal(t, txHash.Hex(), Alert{DedupKey: DedupTxHash}.Key(txHash, safeAddress, decoded))
+	require.Equal(t, safeAddress.Hex(), Alert{DedupKey: DedupAddress}.Key(txHash, safeAddress, decoded))
+	require.Equal(t, aliceAddress.Hex(), Alert{DedupKey: "owner"}.Key(txHash, safeAddress, decoded))
+	require.Equal(t, txHash.Hex(), Alert{DedupKey: "owner"}.Key(txHash, safeAddress, DecodedLog{}), "a match without the field isn't merged with the others")
+}
+
+func TestAlertValidateDedupKey(t *testing.T) {
+	rule := func(signatures ...string) Configuration {
+		config := Configuration{Name: "Owner changes"}
+		for _, signature := range signatures {
+			config.Events = append(config.Events, Event{Signature: signature})
+		}
+		require.NoError(t, config.ResolveEvents())
+		return config
+	}
+	ownerChanged := rule("AddedOwner(address indexed owner)", "RemovedOwner(address owner)")
+
+	require.NoError(t, Alert{DedupKey: "owner"}.ValidateDedupKey(ownerChanged))
+	require.NoError(t, Alert{DedupKey: DedupTxHash}.ValidateDedupKey(ownerChanged))
+	require.NoError(t, Alert{Cooldown: time.Hour}.ValidateDedupKey(ownerChanged))
+	require.ErrorContains(t, Alert{DedupKey: "ownr"}.ValidateDedupKey(ownerChanged), "not a field", "a typo")
+	require.ErrorContains(t, Alert{DedupKey: "owner"}.ValidateDedupKey(rule("AddedOwner(address indexed owner)", "ChangedThreshold(uint256 threshold)")), "ChangedThreshold", "a field missing from an event")
+	require.ErrorContains(t, Alert{DedupKey: "owner"}.ValidateDedupKey(rule("AddedOwner(address)")), "not a field", "the parameters aren't named")
+
+	calls := Configuration{Name: "Upgrades", Calls: []Call{{Signature: "upgradeTo(address implementation)"}}}
+	require.NoError(t, Alert{DedupKey: DedupAddress}.ValidateDedupKey(calls))
+	require.ErrorContains(t, Alert{DedupKey: "implementation"}.ValidateDedupKey(calls), "calls are not decoded")
+}
+
+func TestAlertSuppressed(t *testing.T) {
+	last := &AlertState{Block: 10, Time: 1000}
+
+	dedup := Alert{DedupKey: DedupTxHash}
+	require.False(t, dedup.Suppressed(nil, 10, 1000))
+	require.True(t, dedup.Suppressed(last, 10, 1000), "same key in the same block")
+	require.False(t, dedup.Suppressed(last, 11, 1012))
+
+	cooldown := Alert{Cooldown: time.Minute}
+	require.True(t, cooldown.Suppressed(last, 11, 1059))
+	require.False(t, cooldown.Suppressed(last, 16, 1060))
+
+	require.False(t, Alert{Summary: true}.Suppressed(last, 10, 1000), "the summary alone doesn't suppress")
+}
+
+func newAlertTestMonitor(rules ...Configuration) *chainMonitor {
+	mon := &Monitor{
+		log:      oplog.NewLogger(io.Discard, oplog.DefaultCLIConfig()),
+		nickname: "test",
+		alertsEmitted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "alertsEmitted",
+		}, []string{"nickname", "chain", "rulename", "priority"}),
+		alertsSuppressed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "alertsSuppressed",
+		}, []string{"nickname", "chain", "rulename", "priority"}),
+	}
+	return &chainMonitor{
+		Monitor:      mon,
+		log:          mon.log,
+		chain:        L1Chain,
+		globalconfig: GlobalConfiguration{Configuration: rules},
+		alerts:       make(map[string]map[string]*AlertState),
+		summaries:    make(map[string]*alertSummary),
+	}
+}
+
+func TestAlertCooldownAndSummary(t *testing.T) {
+	noisy := Configuration{Name: "noisy", Priority: "P3", Alert: &Alert{DedupKey: DedupTxHash, Cooldown: time.Minute, Summary: true}}
+	plain := Configuration{Name: "plain", Priority: "P1"}
+	c := newAlertTestMonitor(noisy, plain)
+	emitted := func(config Configuration) float64 {
+		return testutil.ToFloat64(c.alertsEmitted.WithLabelValues("test", L1Chain, config.Name, config.Priority))
+	}
+	suppressed := func(config Configuration) float64 {
+		return testutil.ToFloat64(c.alertsSuppressed.WithLabelValues("test", L1Chain, config.Name, config.Priority))
+	}
+	block := func(number uint64, timestamp uint64) *types.Block {
+		return types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number), Time: timestamp})
+	}
+	tx1, tx2 := common.HexToHash("0x01"), common.HexToHash("0x02")
+
+	b := block(10, 1000)
+	for i := 0; i < 100; i++ {
+		c.alert(b, noisy, tx1.Hex(), tx1, "Event Detected")
+		c.alert(b, plain, "", tx1, "Event Detected")
+	}
+	c.alert(b, noisy, tx2.Hex(), tx2, "Event Detected")
+	require.Equal(t, float64(0), emitted(noisy), "the summary is emitted at the end of the block")
+	require.Equal(t, float64(100), emitted(plain), "the rules without alert alert on each match")
+	require.Equal(t, float64(99), suppressed(noisy))
+	require.Equal(t, []common.Hash{tx1, tx2}, c.summaries[noisy.Name].txHashes)
+
+	c.flushAlerts(b)
+	require.Equal(t, float64(1), emitted(noisy), "a single alert for the block")
+	require.Empty(t, c.summaries)
+	require.Len(t, c.alerts[noisy.Name], 2, "the keys are kept for the cooldown")
+
+	b = block(11, 1012)
+	c.alert(b, noisy, tx1.Hex(), tx1, "Event Detected")
+	c.flushAlerts(b)
+	require.Equal(t, float64(1), emitted(noisy), "no summary when every match is suppressed")
+	require.Equal(t, float64(100), suppressed(noisy))
+
+	b = block(16, 1072)
+	c.flushAlerts(b)
+	require.Empty(t, c.alerts[noisy.Name], "the keys are forgotten after the cooldown")
+	c.alert(b, noisy, tx1.Hex(), tx1, "Event Detected")
+	c.flushAlerts(b)
+	require.Equal(t, float64(2), emitted(noisy))
+}
@@ -0,0 +1,186 @@
+package global_events
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// rpcTimeout is the timeout of the rpc requests made while processing a block (receipts and traces).
+const rpcTimeout = 30 * time.Second
+
+// ResolveCalls computes the selectors of the `calls` of the configuration.
+func (c *Configuration) ResolveCalls() error {
+	for i, call := range c.Calls {
+		formatted := formatSignature(call.Signature)
+		if formatted == "" {
+			return fmt.Errorf("invalid function signature %q", call.Signature)
+		}
+		copy(c.Calls[i].Selector[:], crypto.Keccak256([]byte(formatted))[:4])
+	}
+	return nil
+}
+
+// HasCalls returns true if a rule monitors calls, and true for `internal` if a rule also monitors the internal calls.
+func (G GlobalConfiguration) HasCalls() (calls bool, internal bool) {
+	for _, config := range G.Configuration {
+		for _, call := range config.Calls {
+			calls = true
+			internal = internal || call.Internal
+		}
+	}
+	return calls, internal
+}
+
+// CallMatch is a call of a rule matched by a transaction or an internal call.
+type CallMatch struct {
+	Config Configuration
+	Call   Call
+}
+
+// ReturnMatchesFromCall returns all the rules (and their call) matched by a call to `to` with the calldata `input`.
+// Like for the logs, the rules calling the address explicitly take precedence over the rules monitoring all the addresses.
+func (G GlobalConfiguration) ReturnMatchesFromCall(to common.Address, input []byte, internal bool) []CallMatch {
+	if len(input) < 4 {
+		return nil
+	}
+	var matches, wildcardMatches []CallMatch
+	for _, config := range G.Configuration {
+		for _, call := range config.Calls {
+			if internal && !call.Internal {
+				continue
+			}
+			if !bytes.Equal(call.Selector[:], input[:4]) {
+				continue
+			}
+			addresses := call.Addresses
+			if len(addresses) == 0 {
+				addresses = config.Addresses
+			}
+			switch {
+			case len(addresses) == 0:
+				wildcardMatches = append(wildcardMatches, CallMatch{Config: config, Call: call})
+			case slices.Contains(addresses, to):
+				matches = append(matches, CallMatch{Config: config, Call: call})
+			}
+		}
+	}
+	if len(matches) > 0 {
+		return matches
+	}
+	return wildcardMatches
+}
+
+// callFrame is the shape returned by geth's callTracer (recursive).
+type callFrame struct {
+	Type  string         `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Input hexutil.Bytes  `json:"input"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+// blockTraceResult is an entry of the `debug_traceBlockByHash` result, one per transaction.
+type blockTraceResult struct {
+	TxHash common.Hash `json:"txHash"`
+	Result callFrame   `json:"result"`
+}
+
+// internalCall is a call made by a contract during a transaction.
+type internalCall struct {
+	frame    *callFrame
+	reverted bool // the frame or one of its parents reverted, so the call has no effect.
+}
+
+// collectInternalCalls walks the call tree below `frame` (the root frame is the transaction itself) and returns every call.
+// The contract creations are skipped since their input is the init code.
+func collectInternalCalls(frame *callFrame, reverted bool, out *[]internalCall) {
+	for i := range frame.Calls {
+		child := &frame.Calls[i]
+		childReverted := reverted || child.Error != ""
+		if child.Type != "CREATE" && child.Type != "CREATE2" {
+			*out = append(*out, internalCall{frame: child, reverted: childReverted})
+		}
+		collectInternalCalls(child, childReverted, out)
+	}
+}
+
+// processTx matches the top-level call of a transaction against the `calls` of the rules.
+// The receipt is only fetched for the matched transactions, to report the reverted attempts.
+func (c *chainMonitor) processTx(block *types.Block, tx *types.Transaction, client *ethclient.Client) error {
+	if tx.To() == nil {
+		return nil
+	}
+	matches := c.globalconfig.ReturnMatchesFromCall(*tx.To(), tx.Data(), false)
+	if len(matches) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+	if err != nil {
+		c.unexpectedRpcErrors.WithLabelValues(c.chain, "TransactionReceipt").Inc()
+		return fmt.Errorf("failed to get the receipt of %s: %w", tx.Hash(), err)
+	}
+	from, err := types.Sender(c.signer, tx)
+	if err != nil {
+		c.log.Warn("Failed to recover the sender of the transaction", "TxHash", tx.Hash().String(), "error", err.Error())
+	}
+	for _, match := range matches {
+		c.reportCall(block, tx.Hash(), from, *tx.To(), match, false, receipt.Status != types.ReceiptStatusSuccessful)
+	}
+	return nil
+}
+
+// processBlockTrace matches the internal calls of all the transactions of a block against the `calls` of the rules monitoring them.
+func (c *chainMonitor) processBlockTrace(block *types.Block, client *ethclient.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	var results []blockTraceResult
+	if err := client.Client().CallContext(ctx, &results, "debug_traceBlockByHash", block.Hash(), map[string]interface{}{"tracer": "callTracer"}); err != nil {
+		c.unexpectedRpcErrors.WithLabelValues(c.chain, "debug_traceBlockByHash").Inc()
+		return fmt.Errorf("failed to trace the block %s: %w", block.Number(), err)
+	}
+	txs := block.Transactions()
+	for i := range results {
+		txHash := results[i].TxHash
+		if txHash == (common.Hash{}) && i < len(txs) { // older nodes don't return the hash.
+			txHash = txs[i].Hash()
+		}
+		root := &results[i].Result
+		var calls []internalCall
+		collectInternalCalls(root, root.Error != "", &calls)
+		for _, call := range calls {
+			for _, match := range c.globalconfig.ReturnMatchesFromCall(call.frame.To, call.frame.Input, true) {
+				c.reportCall(block, txHash, call.frame.From, call.frame.To, match, true, call.reverted)
+			}
+		}
+	}
+	return nil
+}
+
+// reportCall logs and counts a call matched by a rule.
+func (c *chainMonitor) reportCall(block *types.Block, txHash common.Hash, from common.Address, to common.Address, match CallMatch, internal bool, reverted bool) {
+	status := "success"
+	if reverted {
+		status = "reverted"
+	}
+	selector := hexutil.Encode(match.Call.Selector[:])
+	c.callDetected.WithLabelValues(c.nickname, c.chain, match.Config.Name, match.Config.Priority, match.Call.Signature, selector, status).Inc()
+	c.recordOccurrence(match.Config, block)
+
+	var key string
+	if match.Config.Alert != nil {
+		key = match.Config.Alert.Key(txHash, to, DecodedLog{})
+	}
+	c.alert(block, match.Config, key, txHash, "Call Detected", "TxHash", txHash.String(), "From", from, "To", to, "RuleName", match.Config.Name, "Priority", match.Config.Priority, "CurrentBlock", block.Number().String(), "Signature", match.Call.Signature, "Selector", selector, "Internal", internal, "Status", status)
+}
@@ -0,0 +1,101 @@
+package global_events
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const callsData = `
+version: "1.0"
+name: "Proxy upgrades"
+priority: "P0"
+addresses:
+  - 0x95222290DD7278Aa3Ddd389Cc1E1d165CC4BAfe5
+calls:
+  - signature: "upgradeTo(address newImplementation)"
+    internal: true
+  - signature: "pause()"
+    addresses:
+      - 0x0000000000000000000000000000000000000B0B
+`
+
+func loadCallsConfig(t *testing.T) Configuration {
+	var config Configuration
+	require.NoError(t, yaml.Unmarshal([]byte(callsData), &config))
+	config, err := StringFunctionToHex(config, oplog.NewLogger(io.Discard, oplog.DefaultCLIConfig()))
+	require.NoError(t, err)
+	require.NoError(t, config.ResolveCalls())
+	return config
+}
+
+func TestResolveCalls(t *testing.T) {
+	config := loadCallsConfig(t)
+	require.Len(t, config.Calls, 2, "the calls are kept when the events are resolved")
+	require.Equal(t, "0x3659cfe6", hexutil.Encode(config.Calls[0].Selector[:]))
+	require.Equal(t, "0x8456cb59", hexutil.Encode(config.Calls[1].Selector[:]))
+
+	invalid := Configuration{Calls: []Call{{Signature: "upgradeTo"}}}
+	require.Error(t, invalid.ResolveCalls())
+}
+
+func TestReturnMatchesFromCall(t *testing.T) {
+	config := GlobalConfiguration{Configuration: []Configuration{loadCallsConfig(t)}}
+	upgradeTo := append(hexutil.MustDecode("0x3659cfe6"), common.LeftPadBytes(aliceAddress.Bytes(), 32)...)
+	pause := hexutil.MustDecode("0x8456cb59")
+
+	matches := config.ReturnMatchesFromCall(safeAddress, upgradeTo, false)
+	require.Len(t, matches, 1, "the call defaults to the addresses of the rule")
+	require.Equal(t, "Proxy upgrades", matches[0].Config.Name)
+	require.Len(t, config.ReturnMatchesFromCall(safeAddress, upgradeTo, true), 1)
+	require.Empty(t, config.ReturnMatchesFromCall(bobAddress, upgradeTo, false))
+
+	require.Len(t, config.ReturnMatchesFromCall(bobAddress, pause, false), 1, "the call has its own addresses")
+	require.Empty(t, config.ReturnMatchesFromCall(safeAddress, pause, false))
+	require.Empty(t, config.ReturnMatchesFromCall(bobAddress, pause, true), "the internal calls are not monitored")
+	require.Empty(t, config.ReturnMatchesFromCall(bobAddress, pause[:3], false), "no selector")
+
+	// The rules calling the address explicitly take precedence.
+	config.Configuration = append(config.Configuration, Configuration{Name: "Every pause", Calls: []Call{config.Configuration[0].Calls[1]}})
+	config.Configuration[1].Calls[0].Addresses = nil
+	matches = config.ReturnMatchesFromCall(bobAddress, pause, false)
+	require.Len(t, matches, 1)
+	require.Equal(t, "Proxy upgrades", matches[0].Config.Name)
+	matches = config.ReturnMatchesFromCall(aliceAddress, pause, false)
+	require.Len(t, matches, 1)
+	require.Equal(t, "Every pause", matches[0].Config.Name)
+}
+
+const blockTrace = `[{
+	"txHash": "0x1111111111111111111111111111111111111111111111111111111111111111",
+	"result": {
+		"type": "CALL", "from": "0x0000000000000000000000000000000000000001", "to": "0x0000000000000000000000000000000000000002", "input": "0x",
+		"calls": [
+			{"type": "CREATE", "from": "0x0000000000000000000000000000000000000002", "to": "0x0000000000000000000000000000000000000003", "input": "0x6080"},
+			{"type": "CALL", "from": "0x0000000000000000000000000000000000000002", "to": "0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5", "input": "0x3659cfe6", "error": "execution reverted",
+				"calls": [{"type": "DELEGATECALL", "from": "0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5", "to": "0x0000000000000000000000000000000000000004", "input": "0x3659cfe6"}]},
+			{"type": "STATICCALL", "from": "0x0000000000000000000000000000000000000002", "to": "0x0000000000000000000000000000000000000005", "input": "0x8456cb59"}
+		]
+	}
+}]`
+
+func TestCollectInternalCalls(t *testing.T) {
+	var results []blockTraceResult
+	require.NoError(t, json.Unmarshal([]byte(blockTrace), &results))
+	require.Len(t, results, 1)
+
+	var calls []internalCall
+	collectInternalCalls(&results[0].Result, false, &calls)
+	require.Len(t, calls, 3, "the root frame and the creations are skipped")
+	require.Equal(t, safeAddress, calls[0].frame.To)
+	require.Equal(t, hexutil.Bytes(hexutil.MustDecode("0x3659cfe6")), calls[0].frame.Input)
+	require.True(t, calls[0].reverted)
+	require.True(t, calls[1].reverted, "the sub-calls of a reverted call are reverted")
+	require.False(t, calls[2].reverted)
+}
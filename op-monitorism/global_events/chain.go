@@ -0,0 +1,196 @@
+package global_events
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum-optimism/monitorism/op-monitorism/processor"
+	"github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// L1Chain is the name of the chain of the `--l1.node.url`, it is the chain of the rules without a `chain` field.
+const L1Chain = "l1"
+
+// chainMonitor monitors the rules of a single chain with its own block processor.
+// The metrics and the nickname are shared with the other chains through the embedded `Monitor`.
+type chainMonitor struct {
+	*Monitor
+
+	log          log.Logger // the logger of the monitor with the chain in its context.
+	chain        string
+	client       *ethclient.Client
+	processor    *processor.BlockProcessor
+	signer       types.Signer // recovers the sender of the transactions matched by a call.
+	globalconfig GlobalConfiguration
+
+	// checkpointFile is the path of the file storing the last processed block, empty if the checkpoints are disabled.
+	checkpointFile string
+	// windows is the state of the windowed rules by rule name.
+	windows map[string]*WindowState
+	// alerts are the last alerts of the rules with an `alert` by rule name and deduplication key.
+	alerts map[string]map[string]*AlertState
+	// summaries are the alerts of the current block aggregated by rule name.
+	summaries map[string]*alertSummary
+}
+
+// newChainMonitor creates the monitor of the rules of the chain `chain` served by the node at `url`.
+func newChainMonitor(ctx context.Context, mon *Monitor, m metrics.Factory, cfg CLIConfig, chain string, url string, rules GlobalConfiguration) (*chainMonitor, error) {
+	log := mon.log.New("chain", chain)
+	client, err := ethclient.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial the %s rpc: %w", chain, err)
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to retrieve the chain ID of %s: %w", chain, err)
+	}
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to fetch the latest block header of %s: %w", chain, err)
+	}
+	// display the infos at the start to ensure everything is correct.
+	log.Info("", "chainId", ChainIDToName(chainID.Int64()), "latestBlockNumber", header.Number, "Rules", len(rules.Configuration))
+
+	c := &chainMonitor{
+		Monitor:      mon,
+		log:          log,
+		chain:        chain,
+		client:       client,
+		signer:       types.LatestSignerForChainID(chainID),
+		globalconfig: rules,
+		windows:      make(map[string]*WindowState),
+		alerts:       make(map[string]map[string]*AlertState),
+		summaries:    make(map[string]*alertSummary),
+	}
+
+	var checkpoint *Checkpoint
+	if cfg.CheckpointFile != "" {
+		c.checkpointFile = checkpointPath(cfg.CheckpointFile, chain)
+		checkpoint, err = ReadCheckpoint(c.checkpointFile)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	var startBlock uint64
+	if chain == L1Chain { // the block numbers of the other chains are unrelated.
+		startBlock = cfg.StartBlock
+	}
+	c.restoreWindows(checkpoint)
+	c.restoreAlerts(checkpoint)
+	metricsAllEventsRegistered(rules, mon.eventEmitted, mon.nickname, chain) // Emit all the events
+	metricsAllCallsRegistered(rules, mon.callDetected, mon.nickname, chain)
+	metricsAllAlertsRegistered(rules, mon.alertsEmitted, mon.alertsSuppressed, mon.nickname, chain)
+
+	// The transactions are only checked (and the blocks traced) if some rules monitor the calls.
+	var txProcessFunc processor.TxProcessingFunc
+	var blockProcessFunc processor.BlockProcessingFunc
+	if calls, internal := rules.HasCalls(); calls {
+		txProcessFunc = c.processTx
+		if internal {
+			blockProcessFunc = c.processBlockTrace
+		}
+	}
+
+	proc, err := processor.NewBlockProcessor(
+		chainFactory{Factory: m, chain: chain},
+		log,
+		url,
+		txProcessFunc,
+		blockProcessFunc,
+		c.processLog,
+		&processor.Config{
+			StartBlock:       startCursor(startBlock, checkpoint, log),
+			Interval:         cfg.PollingInterval,
+			BlockTag:         cfg.Head,
+			OnBlockProcessed: c.onBlockProcessed,
+			// Only the logs that can match a rule are returned by the node: the union of the addresses of the rules
+			// (every address if a rule has none) and the events signatures (and their topics values when every rule filters them).
+			LogFilterAddresses: rules.FilterAddresses(),
+			LogFilterTopics:    rules.FilterTopics(),
+		},
+	)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create the block processor of %s: %w", chain, err)
+	}
+	c.processor = proc
+	return c, nil
+}
+
+// checkpointPath returns the checkpoint file of a chain: the `--checkpoint.file` for the l1 and e.g. "checkpoint.base.json" for the chain `base`.
+func checkpointPath(path string, chain string) string {
+	if chain == L1Chain {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + chain + ext
+}
+
+// processLog checks a log returned by the block processor against the rules. If the log matches a rule defined in the yaml files, then we will display the event.
+// It never returns an error since nothing can be retried here.
+func (c *chainMonitor) processLog(block *types.Block, vLog types.Log, _ *ethclient.Client) error {
+	for _, match := range c.globalconfig.ReturnMatchesFromLog(vLog) {
+		// We matched an alert!
+		config, event_config := match.Config, match.Event
+		if match.DecodeErr != nil && len(event_config.Conditions) > 0 {
+			c.log.Warn("Failed to decode the event, the conditions are not evaluated", "TxHash", vLog.TxHash.String(), "RuleName", config.Name, "error", match.DecodeErr.Error())
+		}
+		c.eventEmitted.WithLabelValues(c.nickname, c.chain, config.Name, config.Priority, event_config.Signature, event_config.Keccak256_Signature.Hex()).Inc()
+		c.recordOccurrence(config, block)
+
+		var key string
+		if config.Alert != nil {
+			key = config.Alert.Key(vLog.TxHash, vLog.Address, match.Decoded)
+		}
+		c.alert(block, config, key, vLog.TxHash, "Event Detected", "TxHash", vLog.TxHash.String(), "Address", vLog.Address, "RuleName", config.Name, "Priority", config.Priority, "CurrentBlock", block.Number().String(), "Topics", vLog.Topics, "Fields", match.Decoded.String(), "Signature", event_config.Signature, "Keccak256_Signature", event_config.Keccak256_Signature.Hex())
+	}
+	return nil
+}
+
+// onBlockProcessed is called by the block processor once all the logs of a block were checked, it logs the summaries of the alerts, evaluates the windowed rules and stores the checkpoint.
+func (c *chainMonitor) onBlockProcessed(block *types.Block) {
+	c.CurrentBlock.WithLabelValues(c.nickname, c.chain).Set(float64(block.NumberU64())) //metrics for the current block monitored.
+	c.flushAlerts(block)
+	c.evaluateWindows(block)
+	if c.checkpointFile == "" {
+		return
+	}
+	if err := WriteCheckpoint(c.checkpointFile, Checkpoint{LastProcessedBlock: block.NumberU64(), Windows: c.windows, Alerts: c.alerts}); err != nil {
+		// The block is not reprocessed, a restart resumes from the previous checkpoint.
+		c.log.Warn("Failed to store the checkpoint", "block", block.NumberU64(), "error", err.Error())
+	}
+}
+
+// chainFactory adds the `chain` label to the metrics of the block processors, so a processor per chain can be registered.
+// Only the constructors used by the block processor are wrapped.
+type chainFactory struct {
+	metrics.Factory
+	chain string
+}
+
+func (f chainFactory) NewGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	opts.ConstLabels = f.labels(opts.ConstLabels)
+	return f.Factory.NewGauge(opts)
+}
+
+func (f chainFactory) NewCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	opts.ConstLabels = f.labels(opts.ConstLabels)
+	return f.Factory.NewCounter(opts)
+}
+
+func (f chainFactory) labels(labels prometheus.Labels) prometheus.Labels {
+	merged := prometheus.Labels{"chain": f.chain}
+	for name, value := range labels {
+		merged[name] = value
+	}
+	return merged
+}
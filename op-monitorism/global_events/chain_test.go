@@ -0,0 +1,30 @@
+package global_events
+
+import (
+	"testing"
+
+	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainFactory(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	factory := opmetrics.With(registry)
+
+	// The block processors of two chains register the same metrics.
+	for _, chain := range []string{L1Chain, "base"} {
+		require.NotPanics(t, func() {
+			chainFactory{Factory: factory, chain: chain}.NewGauge(prometheus.GaugeOpts{Name: "highest_block_seen"}).Set(1)
+			chainFactory{Factory: factory, chain: chain}.NewCounter(prometheus.CounterOpts{Name: "processing_errors_total"}).Inc()
+		})
+	}
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 2)
+	for _, family := range families {
+		require.Len(t, family.GetMetric(), 2, family.GetName())
+		require.Equal(t, "chain", family.GetMetric()[0].GetLabel()[0].GetName())
+	}
+}
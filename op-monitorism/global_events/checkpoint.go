@@ -0,0 +1,56 @@
+package global_events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Checkpoint is the state of the monitor persisted on the disk so a restart resumes where the previous run stopped.
+type Checkpoint struct {
+	LastProcessedBlock uint64                            `json:"lastProcessedBlock"` // the last block fully processed (all its logs were checked against the rules).
+	Windows            map[string]*WindowState           `json:"windows,omitempty"`  // the states of the windowed rules by rule name, as of the `LastProcessedBlock`.
+	Alerts             map[string]map[string]*AlertState `json:"alerts,omitempty"`   // the last alerts of the rules with a cooldown by rule name and deduplication key.
+}
+
+// ReadCheckpoint reads the checkpoint stored at `path`. It returns nil (and no error) if the file doesn't exist yet.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the checkpoint %s: %w", path, err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode the checkpoint %s: %w", path, err)
+	}
+	return &checkpoint, nil
+}
+
+// WriteCheckpoint stores the checkpoint at `path`. The file is written next to the destination then renamed so a crash never leaves a truncated checkpoint.
+func WriteCheckpoint(path string, checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode the checkpoint: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create the checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed.
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write the checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write the checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store the checkpoint %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package global_events
+
+import (
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	checkpoint, err := ReadCheckpoint(path)
+	require.NoError(t, err)
+	require.Nil(t, checkpoint, "a missing checkpoint is not an error")
+
+	require.NoError(t, WriteCheckpoint(path, Checkpoint{LastProcessedBlock: 42}))
+	require.NoError(t, WriteCheckpoint(path, Checkpoint{LastProcessedBlock: 43, Windows: map[string]*WindowState{"Safe failures": {Occurrences: []uint64{10, 20}, LastSeen: 20}}}))
+	checkpoint, err = ReadCheckpoint(path)
+	require.NoError(t, err)
+	require.Equal(t, uint64(43), checkpoint.LastProcessedBlock)
+	require.Equal(t, &WindowState{Occurrences: []uint64{10, 20}, LastSeen: 20}, checkpoint.Windows["Safe failures"])
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "no temporary file is left behind")
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	_, err = ReadCheckpoint(path)
+	require.Error(t, err)
+}
+
+func TestStartCursor(t *testing.T) {
+	logger := oplog.NewLogger(io.Discard, oplog.DefaultCLIConfig())
+
+	require.Nil(t, startCursor(0, nil, logger), "start from the head")
+	require.Equal(t, big.NewInt(99), startCursor(100, nil, logger), "the start block is checked")
+	require.Equal(t, big.NewInt(150), startCursor(100, &Checkpoint{LastProcessedBlock: 150}, logger), "the checkpoint takes precedence")
+	require.Equal(t, big.NewInt(0), startCursor(1, nil, logger), "block 1 is checked")
+	require.Equal(t, big.NewInt(0), startCursor(0, &Checkpoint{LastProcessedBlock: 0}, logger), "block 0 was processed")
+}
+
+func TestCheckpointPath(t *testing.T) {
+	require.Equal(t, "/data/checkpoint.json", checkpointPath("/data/checkpoint.json", L1Chain))
+	require.Equal(t, "/data/checkpoint.base.json", checkpointPath("/data/checkpoint.json", "base"))
+	require.Equal(t, "/data/checkpoint.op", checkpointPath("/data/checkpoint", "op"))
+}
@@ -1,34 +1,75 @@
 package global_events
 
 import (
-	// "fmt"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
 
 	opservice "github.com/ethereum-optimism/optimism/op-service"
 
-	// "github.com/ethereum/go-ethereum/common"
-
 	"github.com/urfave/cli/v2"
 )
 
 // args in CLI have to be standardized and clean.
 const (
-	L1NodeURLFlagName     = "l1.node.url"
-	NicknameFlagName      = "nickname"
-	PathYamlRulesFlagName = "PathYamlRules"
+	L1NodeURLFlagName       = "l1.node.url"
+	NicknameFlagName        = "nickname"
+	PathYamlRulesFlagName   = "PathYamlRules"
+	StartBlockFlagName      = "start.block"
+	PollingIntervalFlagName = "poll.interval"
+	HeadFlagName            = "head"
+	CheckpointFileFlagName  = "checkpoint.file"
+	ChainsFlagName          = "chains"
+	DumpRulesFileFlagName   = "dump.rules"
 )
 
+// chainNameRegex is the format of the chain names of `--chains`.
+var chainNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 type CLIConfig struct {
 	L1NodeURL     string
 	Nickname      string
 	PathYamlRules string
 	// Optional
+	StartBlock      uint64
+	PollingInterval time.Duration
+	Head            string
+	CheckpointFile  string
+	// Chains is the node url of each chain monitored by name, including the `l1` (`--l1.node.url`).
+	Chains        map[string]string
+	DumpRulesFile string
 }
 
 func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
 	cfg := CLIConfig{
-		L1NodeURL:     ctx.String(L1NodeURLFlagName),
-		Nickname:      ctx.String(NicknameFlagName),
-		PathYamlRules: ctx.String(PathYamlRulesFlagName),
+		L1NodeURL:       ctx.String(L1NodeURLFlagName),
+		Nickname:        ctx.String(NicknameFlagName),
+		PathYamlRules:   ctx.String(PathYamlRulesFlagName),
+		StartBlock:      ctx.Uint64(StartBlockFlagName),
+		PollingInterval: ctx.Duration(PollingIntervalFlagName),
+		Head:            ctx.String(HeadFlagName),
+		CheckpointFile:  ctx.String(CheckpointFileFlagName),
+		DumpRulesFile:   ctx.String(DumpRulesFileFlagName),
+	}
+
+	cfg.Chains = map[string]string{L1Chain: cfg.L1NodeURL}
+	for _, chain := range ctx.StringSlice(ChainsFlagName) {
+		name, url, ok := strings.Cut(chain, "=")
+		name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+		if !ok || !chainNameRegex.MatchString(name) || url == "" {
+			return cfg, fmt.Errorf("invalid --%s %q, expected `name=url`", ChainsFlagName, chain)
+		}
+		if _, ok := cfg.Chains[name]; ok {
+			return cfg, fmt.Errorf("the chain %q is defined more than once (the %q chain is the --%s)", name, L1Chain, L1NodeURLFlagName)
+		}
+		cfg.Chains[name] = url
+	}
+
+	switch cfg.Head {
+	case "latest", "safe", "finalized":
+	default:
+		return cfg, fmt.Errorf("invalid --%s %q, expected one of latest, safe or finalized", HeadFlagName, cfg.Head)
 	}
 
 	return cfg, nil
@@ -54,5 +95,37 @@ func CLIFlags(envVar string) []cli.Flag {
 			EnvVars:  opservice.PrefixEnvVar(envVar, "PATH_YAML"), //need to change the name to BLOCKCHAIN_NAME
 			Required: true,
 		},
+		&cli.Uint64Flag{
+			Name:    StartBlockFlagName,
+			Usage:   "First block to check (inclusive). Ignored when a checkpoint exists, omit to start from the head",
+			EnvVars: opservice.PrefixEnvVar(envVar, "START_BLOCK"),
+		},
+		&cli.DurationFlag{
+			Name:    PollingIntervalFlagName,
+			Usage:   "Polling interval for new blocks",
+			Value:   12 * time.Second,
+			EnvVars: opservice.PrefixEnvVar(envVar, "POLL_INTERVAL"),
+		},
+		&cli.StringFlag{
+			Name:    HeadFlagName,
+			Usage:   "Block followed as the head of the chain: latest (not reorg safe), safe or finalized",
+			Value:   "safe",
+			EnvVars: opservice.PrefixEnvVar(envVar, "HEAD"),
+		},
+		&cli.StringFlag{
+			Name:    CheckpointFileFlagName,
+			Usage:   "Path of the file storing the last processed block, used to resume after a restart (disabled if empty)",
+			EnvVars: opservice.PrefixEnvVar(envVar, "CHECKPOINT_FILE"),
+		},
+		&cli.StringSliceFlag{
+			Name:    ChainsFlagName,
+			Usage:   "Other chains monitored by the rules with a `chain` field, as name=url (e.g: op=https://mainnet.optimism.io). The chain of --l1.node.url is named l1",
+			EnvVars: opservice.PrefixEnvVar(envVar, "CHAINS"),
+		},
+		&cli.StringFlag{
+			Name:    DumpRulesFileFlagName,
+			Usage:   "Path of a yaml file where the rules loaded are written, for debugging (disabled if empty)",
+			EnvVars: opservice.PrefixEnvVar(envVar, "DUMP_RULES"),
+		},
 	}
 }
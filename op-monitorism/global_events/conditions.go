@@ -0,0 +1,329 @@
+package global_events
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// conditionRegex parses a condition like "amount > 1000e18" or "newOwner not in [0x..., 0x...]".
+var conditionRegex = regexp.MustCompile(`^\s*(\w+)(?:\s*(==|!=|>=|<=|>|<)\s*|\s+(not\s+in|in)\s+)(.+?)\s*$`)
+
+// condition is a parsed condition over a decoded field of an event.
+type condition struct {
+	raw      string
+	field    string
+	argument abi.Argument
+	operator string        // one of `==`, `!=`, `>`, `>=`, `<`, `<=`, `in`, `not in`.
+	values   []interface{} // normalized values: *big.Int, common.Address, bool, []byte, string or common.Hash (for the indexed dynamic types).
+}
+
+// DecodedLog is the fields of a log decoded with the signature of the event, in the order of the signature.
+type DecodedLog struct {
+	Names  []string
+	Values map[string]interface{}
+}
+
+// String formats the decoded fields like "from=0x... to=0x... value=1000".
+func (d DecodedLog) String() string {
+	fields := make([]string, 0, len(d.Names))
+	for _, name := range d.Names {
+		fields = append(fields, fmt.Sprintf("%s=%s", name, formatValue(d.Values[name])))
+	}
+	return strings.Join(fields, " ")
+}
+
+// formatValue formats a decoded value for the logs (the byte arrays are hex encoded).
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return hexutil.Encode(v)
+	case common.Hash:
+		return v.Hex()
+	case common.Address:
+		return v.Hex()
+	}
+	if b, ok := fixedBytes(value); ok {
+		return hexutil.Encode(b)
+	}
+	return fmt.Sprint(value)
+}
+
+// resolveDecoding parses the signature of the event to decode its logs and parses its `Conditions`.
+// A signature that can't be parsed only prevents the decoding, unless conditions are defined.
+func (e *Event) resolveDecoding() error {
+	e.abiEvent, e.conditions = nil, nil
+	abiEvent, err := parseEventSignature(e.Signature)
+	if err != nil {
+		if len(e.Conditions) > 0 {
+			return err
+		}
+		return nil
+	}
+	e.abiEvent = &abiEvent
+	for _, raw := range e.Conditions {
+		cond, err := parseCondition(abiEvent, raw)
+		if err != nil {
+			return fmt.Errorf("condition %q: %w", raw, err)
+		}
+		e.conditions = append(e.conditions, cond)
+	}
+	return nil
+}
+
+// parseCondition parses a condition and validates it against the type of the field in the event.
+func parseCondition(event abi.Event, raw string) (condition, error) {
+	matches := conditionRegex.FindStringSubmatch(raw)
+	if matches == nil {
+		return condition{}, fmt.Errorf("invalid syntax, expected `<field> <operator> <value>` with the operators ==, !=, >, >=, <, <=, in, not in")
+	}
+	cond := condition{raw: raw, field: matches[1], operator: matches[2]}
+	if cond.operator == "" {
+		cond.operator = strings.Join(strings.Fields(matches[3]), " ")
+	}
+
+	found := false
+	for _, argument := range event.Inputs {
+		if argument.Name == cond.field {
+			cond.argument, found = argument, true
+			break
+		}
+	}
+	if !found {
+		return condition{}, fmt.Errorf("unknown field %q in the event %s", cond.field, event.Sig)
+	}
+
+	rawValues := []string{matches[4]}
+	if cond.operator == "in" || cond.operator == "not in" {
+		list := strings.TrimSpace(matches[4])
+		if !strings.HasPrefix(list, "[") || !strings.HasSuffix(list, "]") {
+			return condition{}, fmt.Errorf("the operator %q expects a list like [a, b]", cond.operator)
+		}
+		rawValues = strings.Split(list[1:len(list)-1], ",")
+	}
+
+	ordered := cond.operator == ">" || cond.operator == ">=" || cond.operator == "<" || cond.operator == "<="
+	typ := cond.argument.Type
+	if ordered && typ.T != abi.UintTy && typ.T != abi.IntTy {
+		return condition{}, fmt.Errorf("the operator %q is only supported on integers, %s is a %s", cond.operator, cond.field, typ.String())
+	}
+	for _, rawValue := range rawValues {
+		value, err := parseConditionValue(cond.argument, rawValue)
+		if err != nil {
+			return condition{}, err
+		}
+		cond.values = append(cond.values, value)
+	}
+	return cond, nil
+}
+
+// parseConditionValue parses a value of a condition into the normalized type of the argument.
+func parseConditionValue(argument abi.Argument, raw string) (interface{}, error) {
+	value := strings.Trim(strings.TrimSpace(raw), `"'`)
+	typ := argument.Type
+	if argument.Indexed && isHashedTopic(typ) {
+		// Only the hash of the value is in the log.
+		return encodeTopicValue(typ, value)
+	}
+	switch typ.T {
+	case abi.UintTy, abi.IntTy:
+		return parseInteger(typ, value)
+	case abi.AddressTy:
+		if !common.IsHexAddress(value) {
+			return nil, fmt.Errorf("%q is not an address", value)
+		}
+		return common.HexToAddress(value), nil
+	case abi.BoolTy:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return b, nil
+	case abi.FixedBytesTy, abi.BytesTy:
+		data, err := hexutil.Decode(value)
+		if err != nil || (typ.T == abi.FixedBytesTy && len(data) != typ.Size) {
+			return nil, fmt.Errorf("%q is not a valid %s hex value", value, typ.String())
+		}
+		return data, nil
+	case abi.StringTy:
+		return value, nil
+	}
+	return nil, fmt.Errorf("conditions are not supported on the type %s", typ.String())
+}
+
+// isHashedTopic returns true if an indexed parameter of this type is stored as the keccak256 hash of its value.
+func isHashedTopic(typ abi.Type) bool {
+	switch typ.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return true
+	}
+	return false
+}
+
+// evaluate returns true if the decoded value of the field satisfies the condition.
+func (c condition) evaluate(decoded DecodedLog) (bool, error) {
+	value, ok := decoded.Values[c.field]
+	if !ok {
+		return false, fmt.Errorf("field %q is not decoded", c.field)
+	}
+	switch c.operator {
+	case "in", "not in":
+		found := false
+		for _, expected := range c.values {
+			cmp, err := compareValues(value, expected)
+			if err != nil {
+				return false, err
+			}
+			if cmp == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (c.operator == "in"), nil
+	}
+	cmp, err := compareValues(value, c.values[0])
+	if err != nil {
+		return false, err
+	}
+	switch c.operator {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", c.operator)
+}
+
+// compareValues compares a decoded value with a normalized value of a condition. The result is 0 if they are equal, the order is only defined for integers.
+func compareValues(decoded interface{}, expected interface{}) (int, error) {
+	switch expected := expected.(type) {
+	case *big.Int:
+		number, ok := toBigInt(decoded)
+		if !ok {
+			return 0, fmt.Errorf("decoded value %v (%T) is not an integer", decoded, decoded)
+		}
+		return number.Cmp(expected), nil
+	case common.Address:
+		address, ok := decoded.(common.Address)
+		if !ok {
+			return 0, fmt.Errorf("decoded value %v (%T) is not an address", decoded, decoded)
+		}
+		return bytes.Compare(address.Bytes(), expected.Bytes()), nil
+	case common.Hash:
+		hash, ok := decoded.(common.Hash)
+		if !ok {
+			return 0, fmt.Errorf("decoded value %v (%T) is not a topic hash", decoded, decoded)
+		}
+		return bytes.Compare(hash.Bytes(), expected.Bytes()), nil
+	case bool:
+		b, ok := decoded.(bool)
+		if !ok {
+			return 0, fmt.Errorf("decoded value %v (%T) is not a boolean", decoded, decoded)
+		}
+		if b == expected {
+			return 0, nil
+		}
+		return 1, nil
+	case []byte:
+		data, ok := fixedBytes(decoded)
+		if !ok {
+			return 0, fmt.Errorf("decoded value %v (%T) is not a byte array", decoded, decoded)
+		}
+		return bytes.Compare(data, expected), nil
+	case string:
+		s, ok := decoded.(string)
+		if !ok {
+			return 0, fmt.Errorf("decoded value %v (%T) is not a string", decoded, decoded)
+		}
+		return strings.Compare(s, expected), nil
+	}
+	return 0, fmt.Errorf("unsupported condition value %v (%T)", expected, expected)
+}
+
+// toBigInt converts the integers decoded by the abi package (native types up to 64 bits, *big.Int above) to a *big.Int.
+func toBigInt(value interface{}) (*big.Int, bool) {
+	if number, ok := value.(*big.Int); ok {
+		return number, true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(v.Uint()), true
+	}
+	return nil, false
+}
+
+// fixedBytes converts the byte slices and arrays (e.g: `[32]uint8` for a `bytes32`) decoded by the abi package to a byte slice.
+func fixedBytes(value interface{}) ([]byte, bool) {
+	if data, ok := value.([]byte); ok {
+		return data, true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Array || v.Type().Elem().Kind() != reflect.Uint8 {
+		return nil, false
+	}
+	data := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(data), v)
+	return data, true
+}
+
+// DecodeLog decodes the indexed (topics) and non-indexed (data) fields of a log with the signature of the event.
+func (e Event) DecodeLog(vLog types.Log) (DecodedLog, error) {
+	if e.abiEvent == nil {
+		return DecodedLog{}, fmt.Errorf("the signature %q can't be decoded", e.Signature)
+	}
+	var indexed abi.Arguments
+	for _, argument := range e.abiEvent.Inputs {
+		if argument.Indexed {
+			indexed = append(indexed, argument)
+		}
+	}
+	if len(vLog.Topics) != len(indexed)+1 {
+		return DecodedLog{}, fmt.Errorf("the log has %d topics but the signature %q has %d indexed parameters (missing `indexed` markers?)", len(vLog.Topics), e.Signature, len(indexed))
+	}
+	values := make(map[string]interface{}, len(e.abiEvent.Inputs))
+	if err := abi.ParseTopicsIntoMap(values, indexed, vLog.Topics[1:]); err != nil {
+		return DecodedLog{}, fmt.Errorf("failed to decode the topics: %w", err)
+	}
+	if err := e.abiEvent.Inputs.NonIndexed().UnpackIntoMap(values, vLog.Data); err != nil {
+		return DecodedLog{}, fmt.Errorf("failed to decode the data: %w", err)
+	}
+	names := make([]string, 0, len(e.abiEvent.Inputs))
+	for _, argument := range e.abiEvent.Inputs {
+		names = append(names, argument.Name)
+	}
+	return DecodedLog{Names: names, Values: values}, nil
+}
+
+// MatchConditions returns true if the decoded log satisfies all the conditions of the event.
+func (e Event) MatchConditions(decoded DecodedLog) (bool, error) {
+	for _, cond := range e.conditions {
+		ok, err := cond.evaluate(decoded)
+		if err != nil {
+			return false, fmt.Errorf("condition %q: %w", cond.raw, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,115 @@
+package global_events
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+const ownershipSignature = "OwnershipTransferred(address indexed previousOwner, address indexed newOwner)"
+
+func resolvedEvent(t *testing.T, signature string, conditions ...string) Event {
+	event := Event{Signature: signature, Keccak256_Signature: FormatAndHash(signature), Conditions: conditions}
+	require.NoError(t, event.resolveTopicFilters())
+	require.NoError(t, event.resolveDecoding())
+	return event
+}
+
+func transferLog(from, to common.Address, value *big.Int) types.Log {
+	return types.Log{
+		Address: safeAddress,
+		Topics:  []common.Hash{FormatAndHash(transferSignature), addressTopic(from), addressTopic(to)},
+		Data:    common.LeftPadBytes(value.Bytes(), 32),
+	}
+}
+
+func TestDecodeLog(t *testing.T) {
+	event := resolvedEvent(t, transferSignature)
+	decoded, err := event.DecodeLog(transferLog(aliceAddress, bobAddress, big.NewInt(1000)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"from", "to", "value"}, decoded.Names)
+	require.Equal(t, aliceAddress, decoded.Values["from"])
+	require.Equal(t, bobAddress, decoded.Values["to"])
+	require.Equal(t, big.NewInt(1000), decoded.Values["value"])
+	require.Equal(t, "from="+aliceAddress.Hex()+" to="+bobAddress.Hex()+" value=1000", decoded.String())
+
+	// Without the `indexed` markers, the topics can't be matched with the parameters.
+	legacy := resolvedEvent(t, "Transfer(address,address,uint256)")
+	_, err = legacy.DecodeLog(transferLog(aliceAddress, bobAddress, big.NewInt(1000)))
+	require.Error(t, err)
+}
+
+func TestMatchConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []string
+		expected   bool
+	}{
+		{name: "no conditions", expected: true},
+		{name: "greater than (scientific notation)", conditions: []string{"value > 1000e18"}, expected: true},
+		{name: "lower or equal", conditions: []string{"value <= 1000e18"}, expected: false},
+		{name: "equality", conditions: []string{"value == 2000000000000000000000"}, expected: true},
+		{name: "address in", conditions: []string{"to in [" + bobAddress.Hex() + ", " + safeAddress.Hex() + "]"}, expected: true},
+		{name: "address not in", conditions: []string{"to not in [" + bobAddress.Hex() + "]"}, expected: false},
+		{name: "all the conditions must hold", conditions: []string{"value > 1", "from == " + bobAddress.Hex()}, expected: false},
+	}
+
+	log := transferLog(aliceAddress, bobAddress, new(big.Int).Mul(big.NewInt(2000), big.NewInt(1e18)))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := resolvedEvent(t, transferSignature, test.conditions...)
+			decoded, err := event.DecodeLog(log)
+			require.NoError(t, err)
+			ok, err := event.MatchConditions(decoded)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, ok)
+		})
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	for _, conditions := range [][]string{
+		{"amount > 1"},            // unknown field
+		{"to > 1"},                // ordering on an address
+		{"value > 1.5"},           // not an integer
+		{"to in 0x1"},             // not a list
+		{"value >"},               // no value
+		{"to == 0x1234"},          // invalid address
+		{"value is 1"},            // unknown operator
+		{"from in [0x1234, bob]"}, // invalid addresses in the list
+	} {
+		event := Event{Signature: transferSignature, Conditions: conditions}
+		require.Error(t, event.resolveDecoding(), "conditions %v", conditions)
+	}
+
+	// The conditions need the names of the parameters.
+	event := Event{Signature: "Transfer(address,address,uint256)", Conditions: []string{"value > 1"}}
+	require.Error(t, event.resolveDecoding())
+}
+
+func TestReturnMatchesFromLogWithConditions(t *testing.T) {
+	config := GlobalConfiguration{Configuration: []Configuration{{
+		Name:      "Ownership transferred to an unknown owner",
+		Addresses: []common.Address{safeAddress},
+		Events:    []Event{resolvedEvent(t, ownershipSignature, "newOwner not in ["+aliceAddress.Hex()+", "+bobAddress.Hex()+"]")},
+	}}}
+	ownershipLog := func(newOwner common.Address) types.Log {
+		return types.Log{Address: safeAddress, Topics: []common.Hash{FormatAndHash(ownershipSignature), addressTopic(aliceAddress), addressTopic(newOwner)}}
+	}
+
+	require.Empty(t, config.ReturnMatchesFromLog(ownershipLog(bobAddress)))
+	matches := config.ReturnMatchesFromLog(ownershipLog(safeAddress))
+	require.Len(t, matches, 1)
+	require.NoError(t, matches[0].DecodeErr)
+	require.Equal(t, safeAddress, matches[0].Decoded.Values["newOwner"])
+
+	// A log that can't be decoded matches without evaluating the conditions.
+	undecodable := ownershipLog(bobAddress)
+	undecodable.Topics = undecodable.Topics[:2]
+	matches = config.ReturnMatchesFromLog(undecodable)
+	require.Len(t, matches, 1)
+	require.Error(t, matches[0].DecodeErr)
+}
@@ -0,0 +1,338 @@
+package global_events
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"gopkg.in/yaml.v3"
+)
+
+// VariablesFileName is the name of the files defining the variables of the rules of their directory (and sub-directories).
+const VariablesFileName = "variables.yaml"
+
+// variableRegex matches a `${NAME}` placeholder in a rule file.
+var variableRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// RuleError is an error of a rule file.
+type RuleError struct {
+	Path string
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("rule %s: %v", e.Path, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// ruleHeader is the part of a rule file that is not a `Configuration`.
+type ruleHeader struct {
+	Include   string            `yaml:"include"`   // a template rule file (relative to the rule file) the rule file is merged into.
+	Variables map[string]string `yaml:"variables"` // the values of the `${NAME}` placeholders of the rule file and of its template.
+}
+
+// ReadYamlFile read a yaml rule file and return a Configuration struct.
+// Its `include` and its `variables` are resolved, but not the variables of the `variables.yaml` files (see ReadAllYamlRules).
+func ReadYamlFile(filename string) (Configuration, error) {
+	return readRuleFile(filename, nil)
+}
+
+// readRuleFile reads a rule file with the variables inherited from the `variables.yaml` files.
+// With an `include`, the template is decoded first and the fields of the rule file replace the fields of the template.
+func readRuleFile(filename string, inherited map[string]string) (Configuration, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Configuration{}, err
+	}
+	var header ruleHeader
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return Configuration{}, fmt.Errorf("invalid yaml: %w", err)
+	}
+	variables := maps.Clone(inherited)
+	if variables == nil {
+		variables = make(map[string]string)
+	}
+	maps.Copy(variables, header.Variables)
+
+	var config Configuration
+	if header.Include != "" {
+		template := filepath.Join(filepath.Dir(filename), header.Include)
+		templateData, err := os.ReadFile(template)
+		if err != nil {
+			return Configuration{}, fmt.Errorf("failed to read the include: %w", err)
+		}
+		var templateHeader ruleHeader
+		if err := yaml.Unmarshal(templateData, &templateHeader); err != nil {
+			return Configuration{}, fmt.Errorf("invalid yaml in the include %s: %w", template, err)
+		}
+		if templateHeader.Include != "" {
+			return Configuration{}, fmt.Errorf("the include %s includes another file, nested includes are not supported", template)
+		}
+		if err := decodeWithVariables(templateData, variables, &config); err != nil {
+			return Configuration{}, fmt.Errorf("include %s: %w", template, err)
+		}
+	}
+	if err := decodeWithVariables(data, variables, &config); err != nil {
+		return Configuration{}, err
+	}
+	return config, nil
+}
+
+// decodeWithVariables decodes the yaml into `config` (only the fields defined by the yaml are replaced), with the `${NAME}` placeholders of its values replaced.
+// The placeholders are replaced in the parsed values, so the comments are ignored and a value can't change the structure of the document.
+func decodeWithVariables(data []byte, variables map[string]string, config *Configuration) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("invalid yaml: %w", err)
+	}
+	var missing []string
+	expandVariables(&document, variables, &missing)
+	if len(missing) > 0 {
+		return fmt.Errorf("undefined variables %s", strings.Join(missing, ", "))
+	}
+	if document.Kind == 0 {
+		return nil // an empty file.
+	}
+	if err := document.Decode(config); err != nil {
+		return fmt.Errorf("invalid yaml: %w", err)
+	}
+	return nil
+}
+
+// expandVariables replaces the `${NAME}` placeholders of the scalars under `node`, the names without a value are appended to `missing`.
+func expandVariables(node *yaml.Node, variables map[string]string, missing *[]string) {
+	if node.Kind == yaml.ScalarNode && variableRegex.MatchString(node.Value) {
+		node.Value = variableRegex.ReplaceAllStringFunc(node.Value, func(placeholder string) string {
+			name := variableRegex.FindStringSubmatch(placeholder)[1]
+			value, ok := variables[name]
+			if !ok {
+				*missing = append(*missing, name)
+			}
+			return value
+		})
+		// The type of an unquoted value without an explicit tag is resolved from the replaced value (e.g: a number).
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+	}
+	for _, child := range node.Content {
+		expandVariables(child, variables, missing)
+	}
+}
+
+// readVariablesFile reads the variables of a `variables.yaml` file, a missing file has no variables.
+func readVariablesFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var variables map[string]string
+	if err := yaml.Unmarshal(data, &variables); err != nil {
+		return nil, fmt.Errorf("invalid yaml: %w", err)
+	}
+	return variables, nil
+}
+
+// StringFunctionToHex take the configuration yaml and resolve a solidity event like "Transfer(address)" to the keccak256 hash of the event signature and UPDATE the configuration with the keccak256 hash.
+func StringFunctionToHex(config Configuration, log log.Logger) (Configuration, error) {
+	if len(config.Addresses) == 0 && len(config.Events) > 0 {
+		log.Warn("No addresses to monitor, but some events are defined (this means we are monitoring all the addresses), probably for debugging purposes.", "Name", config.Name)
+	}
+	for i, event := range config.Events {
+		if formatSignature(event.Signature) == "" {
+			return Configuration{}, fmt.Errorf("invalid event signature %q", event.Signature)
+		}
+		config.Events[i].Keccak256_Signature = FormatAndHash(event.Signature)
+		if len(config.Addresses) == 0 {
+			log.Info("", "Keccak256", config.Events[i].Keccak256_Signature)
+		}
+	}
+	if config.Addresses == nil {
+		config.Addresses = []common.Address{}
+	}
+	return config, nil
+}
+
+// isIgnoredPath returns true for the files and directories that are not rules: hidden or starting with `_` (e.g: the `_templates` directory of the includes).
+func isIgnoredPath(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// ReadAllYamlRules Read all the yaml rules under the directory given by the command line `--PathYamlRules`, recursively.
+// The hidden files and directories and the ones starting with `_` are skipped. The `variables.yaml` files define the variables of the rules of their directory and sub-directories (the closest one wins).
+// All the invalid rules are reported in the returned error.
+func ReadAllYamlRules(PathYamlRules string, log log.Logger) (GlobalConfiguration, error) {
+	var GlobalConfig GlobalConfiguration
+	var errs []error
+	variablesByDir := make(map[string]map[string]string)
+
+	err := filepath.WalkDir(PathYamlRules, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != PathYamlRules && isIgnoredPath(entry.Name()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			// The variables of a directory are the variables of its parent and of its `variables.yaml`.
+			variables := maps.Clone(variablesByDir[filepath.Dir(path)])
+			own, err := readVariablesFile(filepath.Join(path, VariablesFileName))
+			if err != nil {
+				errs = append(errs, &RuleError{Path: filepath.Join(path, VariablesFileName), Err: err})
+			}
+			if variables == nil {
+				variables = make(map[string]string)
+			}
+			maps.Copy(variables, own)
+			variablesByDir[path] = variables
+			return nil
+		}
+		if entry.Name() == VariablesFileName || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+
+		log.Info("Reading a new rule", "Rule", path)
+		config, err := loadRule(path, variablesByDir[filepath.Dir(path)], log)
+		if err != nil {
+			errs = append(errs, &RuleError{Path: path, Err: err})
+			return nil
+		}
+		GlobalConfig.Configuration = append(GlobalConfig.Configuration, config)
+		return nil
+	})
+	if err != nil {
+		return GlobalConfiguration{}, fmt.Errorf("failed to read the rules directory %s: %w", PathYamlRules, err)
+	}
+	if len(errs) > 0 {
+		return GlobalConfiguration{}, errors.Join(errs...)
+	}
+	if len(GlobalConfig.Configuration) == 0 {
+		return GlobalConfiguration{}, fmt.Errorf("no YAML files found in the directory %s", PathYamlRules)
+	}
+	if err := GlobalConfig.CheckDuplicates(); err != nil {
+		return GlobalConfiguration{}, err
+	}
+	return GlobalConfig, nil
+}
+
+// loadRule reads and validates a rule file.
+func loadRule(path string, variables map[string]string, log log.Logger) (Configuration, error) {
+	yamlconfig, err := readRuleFile(path, variables) // Read the yaml file
+	if err != nil {
+		return Configuration{}, err
+	}
+	yamlconfig, err = StringFunctionToHex(yamlconfig, log) // Modify the yaml config to have the common.hash of the event signature.
+	if err != nil {
+		return Configuration{}, err
+	}
+	if err := yamlconfig.ResolveEvents(); err != nil {
+		return Configuration{}, fmt.Errorf("invalid events: %w", err)
+	}
+	if err := yamlconfig.ResolveCalls(); err != nil {
+		return Configuration{}, fmt.Errorf("invalid calls: %w", err)
+	}
+	if yamlconfig.Window != nil {
+		if err := yamlconfig.Window.Validate(); err != nil {
+			return Configuration{}, fmt.Errorf("invalid window: %w", err)
+		}
+	}
+	if yamlconfig.Alert != nil {
+		if err := yamlconfig.Alert.Validate(); err != nil {
+			return Configuration{}, fmt.Errorf("invalid alert: %w", err)
+		}
+		if err := yamlconfig.Alert.ValidateDedupKey(yamlconfig); err != nil {
+			return Configuration{}, fmt.Errorf("invalid alert: %w", err)
+		}
+	}
+	yamlconfig.source = path
+	return yamlconfig, nil
+}
+
+// monitoredPair is an address (the zero address for all the addresses) of a chain monitored for an event or a call, with its filters.
+type monitoredPair struct {
+	chain   string
+	address common.Address
+	target  string // the event signature hash or the call selector.
+	filters string // the topics and the conditions of the event, or the `internal` flag of the call.
+}
+
+// CheckDuplicates returns an error if two rules (or a rule twice) monitor the same event or call on the same address with the same filters: every match would be reported twice.
+// If the rules have different priorities, the pair is conflicting as the priority of the match is undefined.
+// The names must be unique too, the windows, the alerts and their cooldowns are kept by rule name.
+func (G GlobalConfiguration) CheckDuplicates() error {
+	seen := make(map[monitoredPair]Configuration)
+	names := make(map[string]Configuration)
+	var errs []error
+	check := func(config Configuration, pair monitoredPair, what string) {
+		previous, ok := seen[pair]
+		if !ok {
+			seen[pair] = config
+			return
+		}
+		where := "all the addresses"
+		if pair.address != (common.Address{}) {
+			where = pair.address.Hex()
+		}
+		if previous.Priority != config.Priority {
+			errs = append(errs, fmt.Errorf("conflicting rules %q (%s, %s) and %q (%s, %s): %s on %s of the chain %s with different priorities", previous.Name, previous.source, previous.Priority, config.Name, config.source, config.Priority, what, where, pair.chain))
+			return
+		}
+		errs = append(errs, fmt.Errorf("duplicate rules %q (%s) and %q (%s): %s on %s of the chain %s", previous.Name, previous.source, config.Name, config.source, what, where, pair.chain))
+	}
+
+	for _, config := range G.Configuration {
+		if previous, ok := names[config.Name]; ok {
+			errs = append(errs, fmt.Errorf("duplicate rule name %q (%s and %s)", config.Name, previous.source, config.source))
+		}
+		names[config.Name] = config
+
+		addresses := config.Addresses
+		if len(addresses) == 0 {
+			addresses = []common.Address{{}}
+		}
+		for _, event := range config.Events {
+			filters := fmt.Sprintf("%v %v", event.Topics, event.Conditions)
+			for _, address := range addresses {
+				check(config, monitoredPair{chain: config.ChainName(), address: address, target: event.Keccak256_Signature.Hex(), filters: filters}, "the event "+event.Signature)
+			}
+		}
+		for _, call := range config.Calls {
+			callAddresses := call.Addresses
+			if len(callAddresses) == 0 {
+				callAddresses = addresses
+			}
+			for _, address := range callAddresses {
+				check(config, monitoredPair{chain: config.ChainName(), address: address, target: fmt.Sprintf("%x", call.Selector), filters: fmt.Sprint(call.Internal)}, "the call "+call.Signature)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Dump writes the rules loaded into a yaml file, to know what is monitored when debugging.
+func (G GlobalConfiguration) Dump(path string) error {
+	data, err := yaml.Marshal(G)
+	if err != nil {
+		return fmt.Errorf("failed to encode the rules: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write the rules to %s: %w", path, err)
+	}
+	return nil
+}
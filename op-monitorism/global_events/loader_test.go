@@ -0,0 +1,160 @@
+package global_events
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// writeRules writes the rule files (by path relative to the directory) into a temporary directory.
+func writeRules(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+const safeTemplate = `
+version: "1.0"
+name: "${NETWORK} Safe failures"
+priority: "P3"
+addresses:
+  - ${SAFE}
+events:
+  - signature: "ExecutionFailure(bytes32,uint256)"
+`
+
+func TestReadAllYamlRules(t *testing.T) {
+	dir := writeRules(t, map[string]string{
+		"_templates/safe.yaml":    safeTemplate,
+		".hidden/broken.yaml":     "not: [valid",
+		"mainnet/variables.yaml":  "NETWORK: mainnet\nSAFE: " + safeAddress.Hex() + "\n",
+		"mainnet/safe.yaml":       "include: ../_templates/safe.yaml\npriority: P0\n",
+		"sepolia/variables.yaml":  "NETWORK: sepolia\nSAFE: " + aliceAddress.Hex() + "\n",
+		"sepolia/nested/safe.yml": "include: ../../_templates/safe.yaml\nvariables:\n  SAFE: " + bobAddress.Hex() + "\n",
+		"sepolia/README.md":       "not a rule",
+	})
+
+	config, err := ReadAllYamlRules(dir, oplog.NewLogger(io.Discard, oplog.DefaultCLIConfig()))
+	require.NoError(t, err)
+	require.Len(t, config.Configuration, 2)
+
+	mainnet := config.Configuration[0]
+	require.Equal(t, "mainnet Safe failures", mainnet.Name)
+	require.Equal(t, "P0", mainnet.Priority, "the rule file overrides the template")
+	require.Equal(t, []common.Address{safeAddress}, mainnet.Addresses)
+	require.Equal(t, FormatAndHash("ExecutionFailure(bytes32,uint256)"), mainnet.Events[0].Keccak256_Signature)
+	require.Equal(t, filepath.Join(dir, "mainnet/safe.yaml"), mainnet.source)
+
+	sepolia := config.Configuration[1]
+	require.Equal(t, "sepolia Safe failures", sepolia.Name, "the variables are inherited from the parent directories")
+	require.Equal(t, "P3", sepolia.Priority)
+	require.Equal(t, []common.Address{bobAddress}, sepolia.Addresses, "the variables of the rule file win")
+}
+
+func TestDecodeWithVariables(t *testing.T) {
+	rule := `
+# The rule of the ${UNDEFINED} network.
+name: "${NAME}"
+priority: ${PRIORITY}
+window:
+  type: rate
+  duration: 1h
+  threshold: ${THRESHOLD} # at most ${THRESHOLD} matches.
+`
+	variables := map[string]string{"NAME": "Safe: failures\npriority: P0", "PRIORITY": "P3 # not a comment", "THRESHOLD": "5"}
+	var config Configuration
+	require.NoError(t, decodeWithVariables([]byte(rule), variables, &config), "the placeholders of the comments are ignored")
+	require.Equal(t, "Safe: failures\npriority: P0", config.Name, "a value can't change the structure of the document")
+	require.Equal(t, "P3 # not a comment", config.Priority)
+	require.Equal(t, 5, config.Window.Threshold, "the type of an unquoted value is resolved after the replacement")
+
+	err := decodeWithVariables([]byte("name: ${NETWORK} ${SAFE}\n"), nil, &config)
+	require.ErrorContains(t, err, "undefined variables NETWORK, SAFE")
+	require.NoError(t, decodeWithVariables(nil, nil, &config), "an empty file")
+}
+
+func TestReadAllYamlRulesErrors(t *testing.T) {
+	logger := oplog.NewLogger(io.Discard, oplog.DefaultCLIConfig())
+	dir := writeRules(t, map[string]string{
+		"undefined.yaml":  "include: _safe.yaml\n",
+		"_safe.yaml":      safeTemplate,
+		"signature.yaml":  "name: invalid\nevents:\n  - signature: ExecutionFailure\n",
+		"address.yaml":    "name: invalid\naddresses:\n  - 0x1234\n",
+		"window.yaml":     "name: invalid\nwindow:\n  type: burst\n  duration: 1h\n",
+		"dedup.yaml":      "name: invalid\nevents:\n  - signature: AddedOwner(address owner)\nalert:\n  dedup_key: ownr\n",
+		"missing.yaml":    "include: _missing.yaml\n",
+		"valid_rule.yaml": "name: valid\naddresses:\n  - " + safeAddress.Hex() + "\n",
+	})
+
+	_, err := ReadAllYamlRules(dir, logger)
+	require.Error(t, err)
+	var paths []string
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var ruleErr *RuleError
+		require.True(t, errors.As(err, &ruleErr), "%v", err)
+		paths = append(paths, filepath.Base(ruleErr.Path))
+	}
+	require.Equal(t, []string{"address.yaml", "dedup.yaml", "missing.yaml", "signature.yaml", "undefined.yaml", "window.yaml"}, paths, "every invalid rule is reported")
+	require.ErrorContains(t, err, "undefined variables NETWORK, SAFE")
+	require.ErrorContains(t, err, `the dedup_key "ownr" is not a field of the event AddedOwner(address owner)`)
+
+	_, err = ReadAllYamlRules(t.TempDir(), logger)
+	require.ErrorContains(t, err, "no YAML files")
+	_, err = ReadAllYamlRules(filepath.Join(t.TempDir(), "missing"), logger)
+	require.Error(t, err)
+}
+
+func TestCheckDuplicates(t *testing.T) {
+	transfer := Event{Signature: transferSignature, Keccak256_Signature: FormatAndHash(transferSignature)}
+	filtered := transfer
+	filtered.Topics = []EventTopic{{Index: 1, Values: []string{aliceAddress.Hex()}}}
+
+	rule := func(name, priority, chain string, events ...Event) Configuration {
+		return Configuration{Name: name, Priority: priority, Chain: chain, Addresses: []common.Address{safeAddress}, Events: events}
+	}
+
+	require.NoError(t, GlobalConfiguration{Configuration: []Configuration{
+		rule("transfers", "P1", "", transfer),
+		rule("transfers from alice", "P1", "", filtered),
+		rule("base transfers", "P1", "base", transfer),
+	}}.CheckDuplicates(), "different filters or chains")
+
+	err := GlobalConfiguration{Configuration: []Configuration{rule("a", "P1", "", transfer), rule("b", "P1", L1Chain, transfer)}}.CheckDuplicates()
+	require.ErrorContains(t, err, "duplicate rules")
+	err = GlobalConfiguration{Configuration: []Configuration{rule("a", "P1", "", transfer), rule("b", "P0", "", transfer)}}.CheckDuplicates()
+	require.ErrorContains(t, err, "conflicting rules")
+	err = GlobalConfiguration{Configuration: []Configuration{rule("twice", "P1", "", transfer, transfer)}}.CheckDuplicates()
+	require.ErrorContains(t, err, "duplicate rules")
+
+	calls := Configuration{Name: "calls", Addresses: []common.Address{safeAddress}, Calls: []Call{{Signature: "pause()"}, {Signature: "pause()", Addresses: []common.Address{safeAddress}}}}
+	require.NoError(t, calls.ResolveCalls())
+	require.ErrorContains(t, GlobalConfiguration{Configuration: []Configuration{calls}}.CheckDuplicates(), "the call pause()")
+
+	// Two rules named alike would share their windows, alerts and cooldowns.
+	err = GlobalConfiguration{Configuration: []Configuration{rule("transfers", "P1", "", transfer), rule("transfers", "P1", "", filtered)}}.CheckDuplicates()
+	require.ErrorContains(t, err, `duplicate rule name "transfers"`)
+	require.NotContains(t, err.Error(), "duplicate rules")
+}
+
+func TestDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	config := GlobalConfiguration{Configuration: []Configuration{{Name: "Safe", Addresses: []common.Address{safeAddress}}}}
+	require.NoError(t, config.Dump(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var dumped GlobalConfiguration
+	require.NoError(t, yaml.Unmarshal(data, &dumped))
+	require.Equal(t, "Safe", dumped.Configuration[0].Name)
+}
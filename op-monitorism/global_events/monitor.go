@@ -3,16 +3,18 @@ package global_events
 import (
 	"context"
 	"fmt"
+	"maps"
 	"math/big"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum-optimism/optimism/op-service/metrics"
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -21,82 +23,129 @@ const (
 	MetricsNamespace = "global_events_mon"
 )
 
-var counter int = 0
-
 // Monitor is the main struct of the monitor.
 type Monitor struct {
 	log log.Logger
 
-	l1Client     *ethclient.Client
-	globalconfig GlobalConfiguration
+	// chains are the chains monitored, each one with its rules, its client and its block processor.
+	chains []*chainMonitor
 	// nickname is the nickname of the monitor (we need to change the name this is not an ideal one here).
 	nickname string
 	//safeAddress *bindings.OptimismPortalCaller
 
-	LiveAddress                *common.Address
-	LastSuccessfullBlockNumber *big.Int
-
-	//filename   string //filename of the yaml rules
-	//yamlconfig Configuration
+	LiveAddress *common.Address
 
 	// Prometheus metrics
 	eventEmitted        *prometheus.CounterVec
+	callDetected        *prometheus.CounterVec
+	alertsEmitted       *prometheus.CounterVec
+	alertsSuppressed    *prometheus.CounterVec
 	unexpectedRpcErrors *prometheus.CounterVec
 	CurrentBlock        *prometheus.GaugeVec
+
+	windowOccurrences      *prometheus.GaugeVec
+	windowSecondsSinceLast *prometheus.GaugeVec
+	windowViolation        *prometheus.GaugeVec
 }
 
 // ChainIDToName() allows to convert the chainID to a human readable name.
-// For now only ethereum + Sepolia are supported.
+// Ethereum, its testnets and the main OP Stack chains are supported.
 func ChainIDToName(chainID int64) string {
 	switch chainID {
 	case 1:
 		return "Ethereum [Mainnet]"
 	case 11155111:
 		return "Sepolia [Testnet]"
+	case 17000:
+		return "Holesky [Testnet]"
+	case 560048:
+		return "Hoodi [Testnet]"
+	case 10:
+		return "OP Mainnet [Mainnet]"
+	case 8453:
+		return "Base [Mainnet]"
+	case 34443:
+		return "Mode [Mainnet]"
+	case 7777777:
+		return "Zora [Mainnet]"
+	case 130:
+		return "Unichain [Mainnet]"
+	case 57073:
+		return "Ink [Mainnet]"
+	case 1868:
+		return "Soneium [Mainnet]"
+	case 480:
+		return "World Chain [Mainnet]"
+	case 1135:
+		return "Lisk [Mainnet]"
+	case 252:
+		return "Fraxtal [Mainnet]"
+	case 60808:
+		return "BOB [Mainnet]"
+	case 11155420:
+		return "OP Sepolia [Testnet]"
+	case 84532:
+		return "Base Sepolia [Testnet]"
+	case 919:
+		return "Mode Sepolia [Testnet]"
+	case 999999999:
+		return "Zora Sepolia [Testnet]"
+	case 1301:
+		return "Unichain Sepolia [Testnet]"
+	case 763373:
+		return "Ink Sepolia [Testnet]"
+	case 1946:
+		return "Soneium Minato [Testnet]"
+	case 4801:
+		return "World Chain Sepolia [Testnet]"
+	case 4202:
+		return "Lisk Sepolia [Testnet]"
 	}
 	return "The `ChainID` is Not defined into the `chaindIDToName` function, this is probably a custom chain otherwise something is going wrong!"
 }
 
 // NewMonitor creates a new Monitor instance.
 func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIConfig) (*Monitor, error) {
-	l1Client, err := ethclient.Dial(cfg.L1NodeURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial l1 rpc: %w", err)
-	}
 	log.Info("--------------------------------------- Global_events_mon (Infos) -----------------------------\n")
-	ChainID, err := l1Client.ChainID(context.Background())
-	if err != nil {
-		log.Crit("Failed to retrieve chain ID: %v", err)
-	}
-	header, err := l1Client.HeaderByNumber(context.Background(), nil)
-	if err != nil {
-		log.Crit("Failed to fetch the latest block header", "error", err)
-	}
-	// display the infos at the start to ensure everything is correct.
-	log.Info("", "latestBlockNumber", header.Number)
-	log.Info("", "chainId", ChainIDToName(ChainID.Int64()))
 	log.Info("", "PathYaml", cfg.PathYamlRules)
 	log.Info("", "Nickname", cfg.Nickname)
-	log.Info("", "L1NodeURL", cfg.L1NodeURL)
+	log.Info("", "Head", cfg.Head)
 	globalConfig, err := ReadAllYamlRules(cfg.PathYamlRules, log)
 	if err != nil {
-		log.Crit("Failed to read the yaml rules", "error", err.Error())
+		return nil, fmt.Errorf("failed to read the yaml rules: %w", err)
 	}
 
 	globalConfig.DisplayMonitorAddresses(log) //Display all the addresses that are monitored.
-	log.Info("--------------------------------------- End of Infos -----------------------------\n")
-	time.Sleep(10 * time.Second) // sleep for 10 seconds useful to read the information before the prod.
-	return &Monitor{
-		log:          log,
-		l1Client:     l1Client,
-		globalconfig: globalConfig,
+	// Storing the configuration if we need to debug and knows what is monitored.
+	if cfg.DumpRulesFile != "" {
+		if err := globalConfig.Dump(cfg.DumpRulesFile); err != nil {
+			log.Warn("Failed to dump the rules", "error", err.Error())
+		}
+	}
 
+	mon := &Monitor{
+		log:      log,
 		nickname: cfg.Nickname,
 		eventEmitted: m.NewCounterVec(prometheus.CounterOpts{
 			Namespace: MetricsNamespace,
 			Name:      "eventEmitted",
 			Help:      "Event monitored emitted an log",
-		}, []string{"nickname", "rulename", "priority", "functionName", "topics"}),
+		}, []string{"nickname", "chain", "rulename", "priority", "functionName", "topics"}),
+		callDetected: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "callDetected",
+			Help:      "Function monitored called by a transaction or an internal call",
+		}, []string{"nickname", "chain", "rulename", "priority", "functionName", "selector", "status"}),
+		alertsEmitted: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "alertsEmitted",
+			Help:      "Alerts of a rule after the deduplication, the cooldown and the summary of its `alert`",
+		}, []string{"nickname", "chain", "rulename", "priority"}),
+		alertsSuppressed: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "alertsSuppressed",
+			Help:      "Matches of a rule not alerted because of the deduplication or the cooldown of its `alert`",
+		}, []string{"nickname", "chain", "rulename", "priority"}),
 		unexpectedRpcErrors: m.NewCounterVec(prometheus.CounterOpts{
 			Namespace: MetricsNamespace,
 			Name:      "unexpectedRpcErrors",
@@ -106,8 +155,62 @@ func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIC
 			Namespace: MetricsNamespace,
 			Name:      "CurrentBlock",
 			Help:      "This metric return the current blockNumber Monitored.",
-		}, []string{"nickname"}),
-	}, nil
+		}, []string{"nickname", "chain"}),
+		windowOccurrences: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "windowOccurrences",
+			Help:      "Number of matches of a windowed rule within its window",
+		}, []string{"nickname", "chain", "rulename", "priority", "type"}),
+		windowSecondsSinceLast: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "windowSecondsSinceLast",
+			Help:      "Seconds of block time since the last match of a windowed rule",
+		}, []string{"nickname", "chain", "rulename", "priority", "type"}),
+		windowViolation: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "windowViolation",
+			Help:      "1 if a windowed rule is violated (too many matches for `rate`, no match for `absence`), 0 otherwise",
+		}, []string{"nickname", "chain", "rulename", "priority", "type"}),
+	}
+
+	// Every chain of the rules needs a node, the chains without rules are not monitored.
+	rulesByChain := globalConfig.SplitByChain()
+	for chain := range rulesByChain {
+		if _, ok := cfg.Chains[chain]; !ok {
+			return nil, fmt.Errorf("rules are defined for the chain %q but it has no node url (use --%s %s=<url>)", chain, ChainsFlagName, chain)
+		}
+	}
+	for _, chain := range slices.Sorted(maps.Keys(cfg.Chains)) {
+		rules, ok := rulesByChain[chain]
+		if !ok {
+			log.Warn("No rule is defined for the chain, it is not monitored", "chain", chain)
+			continue
+		}
+		chainMon, err := newChainMonitor(ctx, mon, m, cfg, chain, cfg.Chains[chain], rules)
+		if err != nil {
+			mon.Close(ctx)
+			return nil, err
+		}
+		mon.chains = append(mon.chains, chainMon)
+	}
+
+	log.Info("--------------------------------------- End of Infos -----------------------------\n")
+	time.Sleep(10 * time.Second) // sleep for 10 seconds useful to read the information before the prod.
+	return mon, nil
+}
+
+// startCursor returns the last block already processed for the block processor (nil to start from the head).
+// A checkpoint takes precedence over the start block, which is inclusive (the block is checked).
+func startCursor(startBlock uint64, checkpoint *Checkpoint, log log.Logger) *big.Int {
+	if checkpoint != nil {
+		log.Info("Resuming from the checkpoint", "LastProcessedBlock", checkpoint.LastProcessedBlock, "IgnoredStartBlock", startBlock)
+		return new(big.Int).SetUint64(checkpoint.LastProcessedBlock)
+	}
+	if startBlock > 0 {
+		// The processor treats the cursor as already processed, the start block is the first block checked.
+		return new(big.Int).SetUint64(startBlock - 1)
+	}
+	return nil
 }
 
 // formatSignature allows to format the signature of a function to be able to hash it.
@@ -137,96 +240,74 @@ func formatSignature(signature string) string {
 
 // FormatAndHash allow to Format the signature (e.g: "transfer(address,uint256)") to create the keccak256 hash associated with it.
 // Formatting allows use to use "transfer(address owner, uint256 amount)" instead of "transfer(address,uint256)"
+// The zero hash is returned if the signature is invalid (see `formatSignature`).
 func FormatAndHash(signature string) common.Hash {
 	formattedSignature := formatSignature(signature)
 	if formattedSignature == "" {
-		panic("Invalid signature")
+		return common.Hash{}
 	}
 	hash := crypto.Keccak256([]byte(formattedSignature))
 	return common.BytesToHash(hash)
 
 }
 
-// Run the monitor functions declared as a monitor method.
+// Run starts the block processors of all the chains until the context is cancelled.
 func (m *Monitor) Run(ctx context.Context) {
-	m.checkEvents(ctx)
+	go func() {
+		<-ctx.Done()
+		for _, chain := range m.chains {
+			chain.processor.Stop()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, chain := range m.chains {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := chain.processor.Start(); err != nil {
+				chain.log.Error("processor error", "err", err)
+			}
+		}()
+	}
+	wg.Wait()
 }
 
 // metricsAllEventsRegistered allows to emit all the events at the start of the program with the values set to `0`.
-func metricsAllEventsRegistered(globalconfig GlobalConfiguration, eventEmitted *prometheus.CounterVec, nickname string) {
+func metricsAllEventsRegistered(globalconfig GlobalConfiguration, eventEmitted *prometheus.CounterVec, nickname string, chain string) {
 	for _, config := range globalconfig.Configuration {
 		if len(config.Addresses) == 0 {
 			for _, event := range config.Events {
-				eventEmitted.WithLabelValues(nickname, config.Name, config.Priority, event.Signature, event.Keccak256_Signature.Hex()).Add(0)
+				eventEmitted.WithLabelValues(nickname, chain, config.Name, config.Priority, event.Signature, event.Keccak256_Signature.Hex()).Add(0)
 			}
 			continue //pass to the next config so the [] any are not displayed as metrics here.
 		}
 		for _, address := range config.Addresses {
 			for _, event := range globalconfig.ReturnEventsMonitoredForAnAddressFromAConfig(address, config) {
-				eventEmitted.WithLabelValues(nickname, config.Name, config.Priority, event.Signature, event.Keccak256_Signature.Hex()).Add(0)
+				eventEmitted.WithLabelValues(nickname, chain, config.Name, config.Priority, event.Signature, event.Keccak256_Signature.Hex()).Add(0)
 			}
 		}
 	}
 
 }
 
-// checkEvents function to check the events. If an events is emitted onchain and match the rules defined in the yaml file, then we will display the event.
-func (m *Monitor) checkEvents(ctx context.Context) { //TODO: Ensure the logs crit are not causing panic in runtime!
-
-	if counter == 0 { //meaning we are at the start of the program.
-		metricsAllEventsRegistered(m.globalconfig, m.eventEmitted, m.nickname) // Emit all the events
-	}
-
-	counter++
-	header, err := m.l1Client.HeaderByNumber(context.Background(), nil)
-	if err != nil {
-		m.unexpectedRpcErrors.WithLabelValues("L1", "HeaderByNumber").Inc()
-		m.log.Warn("Failed to retrieve latest block header", "error", err.Error()) //TODO:need to wait 12 and retry here!
-		return
-	}
-
-	latestBlockNumber := header.Number
-	blocknumber, _ := latestBlockNumber.Float64()
-
-	if m.LastSuccessfullBlockNumber == nil { // only during initialisation.
-		m.LastSuccessfullBlockNumber = latestBlockNumber
-	}
-
-	m.CurrentBlock.WithLabelValues(m.nickname).Set(float64(blocknumber)) //metrics for the current block monitored.
-	query := ethereum.FilterQuery{
-		FromBlock: m.LastSuccessfullBlockNumber,
-		ToBlock:   latestBlockNumber,
-		// Addresses: []common.Address{}, //if empty means that all addresses are monitored should be this value for optimisation and avoiding to take every logs every time -> m.globalconfig.GetUniqueMonitoredAddresses
-	}
-
-	logs, err := m.l1Client.FilterLogs(context.Background(), query)
-	if err != nil { //TODO:need to wait 12 and retry here!
-		m.unexpectedRpcErrors.WithLabelValues("L1", "FilterLogs").Inc()
-		m.log.Warn("Failed to retrieve logs:", "error", err.Error())
-		return
-	}
-
-	for _, vLog := range logs {
-		if len(vLog.Topics) > 0 { // Ensure no anonymous event is here.
-			configs := m.globalconfig.ReturnConfigsFromTopic(vLog.Topics[0])
-			if len(configs) > 0 {
-				config := ReturnConfigFromConfigsAndAddress(vLog.Address, configs)
-				if len(config.Events) == 0 {
-					continue
-				}
-				// We matched an alert!
-				event_config := ReturnAndEventForAnTopic(vLog.Topics[0], config)
-				m.log.Info("Event Detected", "TxHash", vLog.TxHash.String(), "Address", vLog.Address, "RuleName", config.Name, "CurrentBlock", latestBlockNumber.String(), "Topics", vLog.Topics, "Config", config, "event_config.Signature", event_config.Signature, "event_config.Keccak256_Signature", event_config.Keccak256_Signature.Hex())
-				// m.eventEmitted.WithLabelValues(m.nickname, config.Name, config.Priority, event_config.Signature, event_config.Keccak256_Signature.Hex(), vLog.Address.String(), latestBlockNumber.String(), vLog.TxHash.String()).Set(float64(1)) //inc
-
-				m.eventEmitted.WithLabelValues(m.nickname, config.Name, config.Priority, event_config.Signature, event_config.Keccak256_Signature.Hex()).Inc()
+// metricsAllCallsRegistered allows to emit all the calls at the start of the program with the values set to `0`.
+func metricsAllCallsRegistered(globalconfig GlobalConfiguration, callDetected *prometheus.CounterVec, nickname string, chain string) {
+	for _, config := range globalconfig.Configuration {
+		for _, call := range config.Calls {
+			for _, status := range []string{"success", "reverted"} {
+				callDetected.WithLabelValues(nickname, chain, config.Name, config.Priority, call.Signature, hexutil.Encode(call.Selector[:]), status).Add(0)
 			}
 		}
 	}
+}
 
-	m.log.Info("Checking events..", "From block", m.LastSuccessfullBlockNumber, "To block", latestBlockNumber)
-	m.LastSuccessfullBlockNumber = latestBlockNumber
-
+// metricsAllAlertsRegistered allows to emit the alerts of all the rules at the start of the program with the values set to `0`.
+func metricsAllAlertsRegistered(globalconfig GlobalConfiguration, alertsEmitted *prometheus.CounterVec, alertsSuppressed *prometheus.CounterVec, nickname string, chain string) {
+	for _, config := range globalconfig.Configuration {
+		alertsEmitted.WithLabelValues(nickname, chain, config.Name, config.Priority).Add(0)
+		alertsSuppressed.WithLabelValues(nickname, chain, config.Name, config.Priority).Add(0)
+	}
 }
 
 // ReturnConfigFromConfigsAndAddress allows to return the config from the configs and the address.
@@ -258,6 +339,9 @@ func ReturnAndEventForAnTopic(topic common.Hash, config Configuration) Event {
 
 // Close closes the monitor.
 func (m *Monitor) Close(_ context.Context) error {
-	m.l1Client.Close()
+	for _, chain := range m.chains {
+		chain.processor.Stop()
+		chain.client.Close()
+	}
 	return nil
 }
@@ -0,0 +1,270 @@
+package global_events
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// maxIndexedTopics is the maximum number of indexed parameters of a non-anonymous event (`Topic[1]` to `Topic[3]`).
+const maxIndexedTopics = 3
+
+var eventSignatureRegex = regexp.MustCompile(`^\s*(\w+)\s*\(([^)]*)\)\s*$`)
+
+// parseEventSignature parses a solidity event signature like "Transfer(address indexed from, address indexed to, uint256 value)" into an `abi.Event`.
+// The `indexed` markers and the names are optional, the types have to be canonical (e.g: `uint256` and not `uint`).
+func parseEventSignature(signature string) (abi.Event, error) {
+	matches := eventSignatureRegex.FindStringSubmatch(signature)
+	if len(matches) != 3 {
+		return abi.Event{}, fmt.Errorf("invalid event signature %q", signature)
+	}
+	name := matches[1]
+	inputs := abi.Arguments{}
+	if strings.TrimSpace(matches[2]) != "" {
+		for i, param := range strings.Split(matches[2], ",") {
+			parts := strings.Fields(param)
+			if len(parts) == 0 || len(parts) > 3 {
+				return abi.Event{}, fmt.Errorf("invalid parameter %d %q in event signature %q", i, param, signature)
+			}
+			typ, err := abi.NewType(parts[0], "", nil)
+			if err != nil {
+				return abi.Event{}, fmt.Errorf("invalid type of parameter %d in event signature %q: %w", i, signature, err)
+			}
+			argument := abi.Argument{Type: typ}
+			rest := parts[1:]
+			if len(rest) > 0 && rest[0] == "indexed" {
+				argument.Indexed = true
+				rest = rest[1:]
+			}
+			switch len(rest) {
+			case 0:
+			case 1:
+				argument.Name = rest[0]
+			default:
+				return abi.Event{}, fmt.Errorf("invalid parameter %d %q in event signature %q", i, param, signature)
+			}
+			inputs = append(inputs, argument)
+		}
+	}
+	event := abi.NewEvent(name, name, false, inputs)
+	if indexed := countIndexed(event.Inputs); indexed > maxIndexedTopics {
+		return abi.Event{}, fmt.Errorf("event signature %q has %d indexed parameters, the maximum is %d", signature, indexed, maxIndexedTopics)
+	}
+	return event, nil
+}
+
+// countIndexed returns the number of indexed arguments.
+func countIndexed(arguments abi.Arguments) int {
+	count := 0
+	for _, argument := range arguments {
+		if argument.Indexed {
+			count++
+		}
+	}
+	return count
+}
+
+// ResolveEvents validates the `topics` and the `conditions` of every event of the configuration against the parameters of the event signature.
+// The topics values are encoded into the topics hashes used for the matching and the signature is parsed to decode the logs.
+func (c *Configuration) ResolveEvents() error {
+	for i := range c.Events {
+		if err := c.Events[i].resolveTopicFilters(); err != nil {
+			return fmt.Errorf("event %q: %w", c.Events[i].Signature, err)
+		}
+		if err := c.Events[i].resolveDecoding(); err != nil {
+			return fmt.Errorf("event %q: %w", c.Events[i].Signature, err)
+		}
+	}
+	return nil
+}
+
+// resolveTopicFilters fills `topicFilters` from the `Topics` of the event.
+func (e *Event) resolveTopicFilters() error {
+	e.topicFilters = nil
+	if len(e.Topics) == 0 {
+		return nil
+	}
+	abiEvent, err := parseEventSignature(e.Signature)
+	if err != nil {
+		return err
+	}
+	indexed := make([]abi.Argument, 0, maxIndexedTopics)
+	for _, argument := range abiEvent.Inputs {
+		if argument.Indexed {
+			indexed = append(indexed, argument)
+		}
+	}
+	if len(indexed) == 0 {
+		return fmt.Errorf("topics are filtered but the signature has no `indexed` parameter")
+	}
+
+	filters := make([][]common.Hash, len(indexed)+1)
+	for _, topic := range e.Topics {
+		if topic.Index < 1 || topic.Index > len(indexed) {
+			return fmt.Errorf("topic index %d is out of range, the signature has %d indexed parameters (valid indexes are 1 to %d)", topic.Index, len(indexed), len(indexed))
+		}
+		if filters[topic.Index] != nil {
+			return fmt.Errorf("topic index %d is defined more than once", topic.Index)
+		}
+		if len(topic.Values) == 0 {
+			return fmt.Errorf("topic index %d has no values", topic.Index)
+		}
+		argument := indexed[topic.Index-1]
+		hashes := make([]common.Hash, 0, len(topic.Values))
+		for _, value := range topic.Values {
+			hash, err := encodeTopicValue(argument.Type, value)
+			if err != nil {
+				return fmt.Errorf("topic index %d (%s %s): %w", topic.Index, argument.Type.String(), argument.Name, err)
+			}
+			hashes = append(hashes, hash)
+		}
+		filters[topic.Index] = hashes
+	}
+	e.topicFilters = filters
+	return nil
+}
+
+// encodeTopicValue encodes a value from the yaml rules into the topic of an indexed parameter of type `typ`.
+// Dynamic types (string, bytes) are hashed like solidity does, arrays and tuples have to be given as the 32 bytes hash directly.
+func encodeTopicValue(typ abi.Type, value string) (common.Hash, error) {
+	value = strings.TrimSpace(value)
+	var rule interface{}
+	switch typ.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(value) {
+			return common.Hash{}, fmt.Errorf("%q is not an address", value)
+		}
+		rule = common.HexToAddress(value)
+	case abi.UintTy, abi.IntTy:
+		number, err := parseInteger(typ, value)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		rule = number
+	case abi.BoolTy:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("%q is not a boolean", value)
+		}
+		rule = b
+	case abi.FixedBytesTy:
+		data, err := hexutil.Decode(value)
+		if err != nil || len(data) != typ.Size {
+			return common.Hash{}, fmt.Errorf("%q is not a %d bytes hex value", value, typ.Size)
+		}
+		var hash common.Hash
+		copy(hash[:], data)
+		return hash, nil
+	case abi.StringTy:
+		rule = value
+	case abi.BytesTy:
+		data, err := hexutil.Decode(value)
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("%q is not a hex value", value)
+		}
+		rule = data
+	default:
+		data, err := hexutil.Decode(value)
+		if err != nil || len(data) != common.HashLength {
+			return common.Hash{}, fmt.Errorf("%q is not the 32 bytes hash of the %s value", value, typ.String())
+		}
+		return common.BytesToHash(data), nil
+	}
+	topics, err := abi.MakeTopics([]interface{}{rule})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return topics[0][0], nil
+}
+
+// parseInteger parses a decimal, `0x` prefixed or scientific (e.g: "1000e18", "1.5e18") value and ensures it fits into the integer type `typ`.
+func parseInteger(typ abi.Type, value string) (*big.Int, error) {
+	number, ok := new(big.Int).SetString(value, 0)
+	if !ok {
+		rat, ok := new(big.Rat).SetString(value)
+		if !ok || !rat.IsInt() {
+			return nil, fmt.Errorf("%q is not an integer", value)
+		}
+		number = rat.Num()
+	}
+	if typ.T == abi.UintTy {
+		if number.Sign() < 0 || number.BitLen() > typ.Size {
+			return nil, fmt.Errorf("%s does not fit into %s", value, typ.String())
+		}
+		return number, nil
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(typ.Size-1))
+	if number.Cmp(limit) >= 0 || number.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return nil, fmt.Errorf("%s does not fit into %s", value, typ.String())
+	}
+	return number, nil
+}
+
+// MatchTopics returns true if the topics of a log are accepted by every topic filter of the event.
+// The `Topic[0]` (the signature) is not checked here.
+func (e Event) MatchTopics(topics []common.Hash) bool {
+	for index, accepted := range e.topicFilters {
+		if len(accepted) == 0 {
+			continue
+		}
+		if index >= len(topics) || !containsHash(accepted, topics[index]) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsHash(hashes []common.Hash, target common.Hash) bool {
+	for _, hash := range hashes {
+		if hash == target {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterTopics returns the topics of the `FilterLogs` query for all the rules.
+// `Topic[0]` is the union of all the event signatures. A position after it is only restricted if every event monitored filters it, otherwise it is left empty (any value) so no log matching a rule is dropped by the node.
+func (G GlobalConfiguration) FilterTopics() [][]common.Hash {
+	var events []Event
+	for _, config := range G.Configuration {
+		events = append(events, config.Events...)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	topics := make([][]common.Hash, maxIndexedTopics+1)
+	for index := range topics {
+		var union []common.Hash
+		for _, event := range events {
+			var accepted []common.Hash
+			if index == 0 {
+				accepted = []common.Hash{event.Keccak256_Signature}
+			} else if index < len(event.topicFilters) {
+				accepted = event.topicFilters[index]
+			}
+			if len(accepted) == 0 { // this event accepts any value at this position.
+				union = nil
+				break
+			}
+			for _, hash := range accepted {
+				if !containsHash(union, hash) {
+					union = append(union, hash)
+				}
+			}
+		}
+		topics[index] = union
+	}
+	// Trailing wildcards are implicit in a filter query.
+	for len(topics) > 0 && len(topics[len(topics)-1]) == 0 {
+		topics = topics[:len(topics)-1]
+	}
+	return topics
+}
@@ -0,0 +1,196 @@
+package global_events
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const transferSignature = "Transfer(address indexed from, address indexed to, uint256 value)"
+
+var (
+	safeAddress  = common.HexToAddress("0x95222290DD7278Aa3Ddd389Cc1E1d165CC4BAfe5")
+	aliceAddress = common.HexToAddress("0x00000000000000000000000000000000000A11CE")
+	bobAddress   = common.HexToAddress("0x0000000000000000000000000000000000000B0B")
+)
+
+func addressTopic(address common.Address) common.Hash {
+	return common.BytesToHash(address.Bytes())
+}
+
+func TestParseEventSignature(t *testing.T) {
+	event, err := parseEventSignature(transferSignature)
+	require.NoError(t, err)
+	require.Equal(t, "Transfer(address,address,uint256)", event.Sig)
+	require.Equal(t, FormatAndHash(transferSignature), event.ID)
+	require.Equal(t, 2, countIndexed(event.Inputs))
+	require.Equal(t, "to", event.Inputs[1].Name)
+
+	event, err = parseEventSignature("ExecutionFailure(bytes32,uint256)")
+	require.NoError(t, err)
+	require.Equal(t, "arg0", event.Inputs[0].Name)
+	require.Equal(t, 0, countIndexed(event.Inputs))
+
+	_, err = parseEventSignature("Transfer(uint from)")
+	require.Error(t, err, "non canonical types are rejected")
+	_, err = parseEventSignature("Four(uint8 indexed a, uint8 indexed b, uint8 indexed c, uint8 indexed d)")
+	require.Error(t, err, "an event has at most 3 indexed parameters")
+}
+
+func TestResolveTopicFilters(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature string
+		topics    []EventTopic
+		expected  [][]common.Hash
+		expectErr bool
+	}{
+		{
+			name:      "address any-of",
+			signature: transferSignature,
+			topics:    []EventTopic{{Index: 2, Values: []string{aliceAddress.Hex(), bobAddress.Hex()}}},
+			expected:  [][]common.Hash{nil, nil, {addressTopic(aliceAddress), addressTopic(bobAddress)}},
+		},
+		{
+			name:      "uint equality",
+			signature: "Deposit(uint256 indexed amount)",
+			topics:    []EventTopic{{Index: 1, Values: []string{"0x10"}}},
+			expected:  [][]common.Hash{nil, {common.BigToHash(big.NewInt(16))}},
+		},
+		{
+			name:      "negative int",
+			signature: "Delta(int8 indexed delta)",
+			topics:    []EventTopic{{Index: 1, Values: []string{"-1"}}},
+			expected:  [][]common.Hash{nil, {common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")}},
+		},
+		{
+			name:      "no indexed markers",
+			signature: "Transfer(address,address,uint256)",
+			topics:    []EventTopic{{Index: 1, Values: []string{aliceAddress.Hex()}}},
+			expectErr: true,
+		},
+		{
+			name:      "index of a non indexed parameter",
+			signature: transferSignature,
+			topics:    []EventTopic{{Index: 3, Values: []string{"1"}}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid address",
+			signature: transferSignature,
+			topics:    []EventTopic{{Index: 1, Values: []string{"0x1234"}}},
+			expectErr: true,
+		},
+		{
+			name:      "value out of range",
+			signature: "Small(uint8 indexed value)",
+			topics:    []EventTopic{{Index: 1, Values: []string{"256"}}},
+			expectErr: true,
+		},
+		{
+			name:      "duplicated index",
+			signature: transferSignature,
+			topics:    []EventTopic{{Index: 1, Values: []string{aliceAddress.Hex()}}, {Index: 1, Values: []string{bobAddress.Hex()}}},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := Event{Signature: test.signature, Topics: test.topics}
+			err := event.resolveTopicFilters()
+			if test.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, event.topicFilters)
+		})
+	}
+}
+
+const topicsData = `
+configuration:
+  - version: "1.0"
+    name: "Token transfers to Alice"
+    priority: "P1"
+    addresses:
+      - 0x95222290DD7278Aa3Ddd389Cc1E1d165CC4BAfe5
+    events:
+      - signature: "Transfer(address indexed from, address indexed to, uint256 value)"
+        topics:
+          - index: 2
+            values:
+              - 0x00000000000000000000000000000000000A11CE
+  - version: "1.0"
+    name: "All the transfers to Bob"
+    priority: "P3"
+    addresses:
+    events:
+      - signature: "Transfer(address indexed from, address indexed to, uint256 value)"
+        topics:
+          - index: 2
+            values:
+              - 0x0000000000000000000000000000000000000B0B
+`
+
+func loadTopicsConfig(t *testing.T) GlobalConfiguration {
+	var config GlobalConfiguration
+	require.NoError(t, yaml.Unmarshal([]byte(topicsData), &config))
+	for i := range config.Configuration {
+		for j := range config.Configuration[i].Events {
+			config.Configuration[i].Events[j].Keccak256_Signature = FormatAndHash(config.Configuration[i].Events[j].Signature)
+		}
+		require.NoError(t, config.Configuration[i].ResolveEvents())
+	}
+	return config
+}
+
+func TestReturnMatchesFromLog(t *testing.T) {
+	config := loadTopicsConfig(t)
+	transfer := FormatAndHash(transferSignature)
+
+	transferLog := func(address common.Address, to common.Address) types.Log {
+		return types.Log{Address: address, Topics: []common.Hash{transfer, addressTopic(safeAddress), addressTopic(to)}}
+	}
+
+	matches := config.ReturnMatchesFromLog(transferLog(safeAddress, aliceAddress))
+	require.Len(t, matches, 1)
+	require.Equal(t, "Token transfers to Alice", matches[0].Config.Name)
+
+	matches = config.ReturnMatchesFromLog(transferLog(aliceAddress, bobAddress))
+	require.Len(t, matches, 1)
+	require.Equal(t, "All the transfers to Bob", matches[0].Config.Name)
+
+	require.Empty(t, config.ReturnMatchesFromLog(transferLog(aliceAddress, aliceAddress)), "the topic value is not accepted by any rule")
+	require.Empty(t, config.ReturnMatchesFromLog(types.Log{Address: safeAddress, Topics: []common.Hash{transfer}}), "the log misses the filtered topic")
+	require.Empty(t, config.ReturnMatchesFromLog(types.Log{Address: safeAddress}), "anonymous logs are ignored")
+}
+
+func TestFilterTopics(t *testing.T) {
+	config := loadTopicsConfig(t)
+	transfer := FormatAndHash(transferSignature)
+	require.Equal(t, [][]common.Hash{{transfer}, nil, {addressTopic(aliceAddress), addressTopic(bobAddress)}}, config.FilterTopics())
+
+	// A single event without a filter on the position disables the push down of that position.
+	config.Configuration = append(config.Configuration, Configuration{Name: "All the transfers", Events: []Event{{Signature: transferSignature, Keccak256_Signature: transfer}}})
+	require.Equal(t, [][]common.Hash{{transfer}}, config.FilterTopics())
+
+	require.Nil(t, GlobalConfiguration{}.FilterTopics())
+}
+
+func TestFilterAddresses(t *testing.T) {
+	config := GlobalConfiguration{Configuration: []Configuration{
+		{Name: "Safe", Addresses: []common.Address{safeAddress, aliceAddress}, Events: []Event{{Signature: transferSignature}}},
+		{Name: "Bob", Addresses: []common.Address{bobAddress, safeAddress}, Events: []Event{{Signature: transferSignature}}},
+		{Name: "No events", Events: nil},
+	}}
+	require.Equal(t, []common.Address{safeAddress, aliceAddress, bobAddress}, config.FilterAddresses())
+
+	// A rule without addresses monitors every address.
+	require.Nil(t, loadTopicsConfig(t).FilterAddresses())
+}
@@ -1,17 +1,17 @@
 package global_events
 
 import (
-	"errors"
-	"fmt"
-	"os"
-	"path/filepath"
+	"slices"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
-	"gopkg.in/yaml.v3"
 )
 
-// EventTopic is the struct that will contain the index of the topic and the values that will be monitored (not used currently).
+// EventTopic is the struct that will contain the index of the topic and the values that will be monitored.
+// The `Index` is the position of the topic into the log (from 1 to 3, as `Topic[0]` is the signature of the event) so the `Index` 1 is the first `indexed` parameter of the signature.
+// The log matches if its topic is one of the `Values` (a single value is an equality, multiple values are an any-of like a list of addresses).
 type EventTopic struct {
 	Index  int      `yaml:"index"`
 	Values []string `yaml:"values"`
@@ -20,17 +20,36 @@ type EventTopic struct {
 // Event is the struct that will contain the signature of the event and the topics that will be monitored.
 type Event struct {
 	Keccak256_Signature common.Hash  // the value is the `Topic[0]`. This is generated from the `Event.Signature` field (eg. 0x23428b18acfb3ea64b08dc0c1d296ea9c09702c09083ca5272e64d115b687d23 --> ExecutionFailure(bytes32,uint256)
-	Signature           string       `yaml:"signature"`        // That is the name of the function like "Transfer(address,address,uint256)"
-	Topics              []EventTopic `yaml:"topics,omitempty"` // The topics that will be monitored not used yet.
+	Signature           string       `yaml:"signature"`            // That is the name of the function like "Transfer(address,address,uint256)"
+	Topics              []EventTopic `yaml:"topics,omitempty"`     // The topics that will be monitored, this requires the `indexed` markers in the `Signature` (e.g: "Transfer(address indexed from, address indexed to, uint256 value)").
+	Conditions          []string     `yaml:"conditions,omitempty"` // The conditions over the decoded fields of the event that all have to be true (e.g: "value > 1000e18", "newOwner not in [0x..., 0x...]"), this requires the names of the parameters in the `Signature`.
+
+	topicFilters [][]common.Hash // the accepted topics hashes by topic position, resolved from `Topics` at load time.
+	abiEvent     *abi.Event      // the parsed `Signature` used to decode the logs, nil if the signature can't be parsed.
+	conditions   []condition     // the parsed `Conditions`.
+}
+
+// Call is the struct that will contain the signature of a function monitored when it is called on the addresses, even if the call reverts.
+type Call struct {
+	Selector  [4]byte          // the first 4 bytes of the calldata. This is generated from the `Call.Signature` field (eg. 0x3659cfe6 --> upgradeTo(address)).
+	Signature string           `yaml:"signature"`           // That is the function like "upgradeTo(address implementation)".
+	Addresses []common.Address `yaml:"addresses,omitempty"` // The addresses called, the addresses of the rule if empty.
+	Internal  bool             `yaml:"internal,omitempty"`  // Also match the internal calls (made by contracts), this requires `debug_traceBlockByHash` on the node.
 }
 
 // Configuration is the struct that will contain the configuration coming from the yaml files under the `rules` directory.
 type Configuration struct {
 	Version   string           `yaml:"version"`
+	Chain     string           `yaml:"chain,omitempty"` // The chain of the addresses (a name of `--chains`), the `l1` (`--l1.node.url`) if empty.
 	Name      string           `yaml:"name"`
 	Priority  string           `yaml:"priority"`
 	Addresses []common.Address `yaml:"addresses"` //TODO: add the superchain registry with the format `/l1/l2/optimismPortal`
 	Events    []Event          `yaml:"events"`
+	Calls     []Call           `yaml:"calls,omitempty"`
+	Window    *Window          `yaml:"window,omitempty"` // Optional, counts the matches of the rule over a window instead of alerting on each match.
+	Alert     *Alert           `yaml:"alert,omitempty"`  // Optional, deduplicates or aggregates the alerts of the rule.
+
+	source string // the rule file the configuration was loaded from.
 }
 
 // GlobalConfiguration is the struct that will contain all the configuration of the monitoring.
@@ -74,94 +93,91 @@ func (G GlobalConfiguration) ReturnConfigsFromTopic(topic common.Hash) []Configu
 	return configs
 }
 
-// ReadYamlFile read a yaml file and return a Configuration struct.
-func ReadYamlFile(filename string) Configuration {
-	var config Configuration
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		fmt.Println("Error reading YAML file:", err)
-		panic("Error reading YAML")
-	}
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
-		fmt.Println("Error reading YAML file:", err)
-		panic("Error reading YAML")
-
-	}
-	return config
-}
-
-// StringFunctionToHex take the configuration yaml and resolve a solidity event like "Transfer(address)" to the keccak256 hash of the event signature and UPDATE the configuration with the keccak256 hash.
-func StringFunctionToHex(config Configuration, log log.Logger) Configuration {
-	var FinalConfig Configuration
-	if len(config.Addresses) == 0 && len(config.Events) > 0 {
-		log.Warn("No addresses to monitor, but some events are defined (this means we are monitoring all the addresses), probably for debugging purposes.")
-		keccak256_topic_0 := config.Events
-		for i, event := range config.Events {
-			keccak256_topic_0[i].Keccak256_Signature = FormatAndHash(event.Signature)
-			log.Info("", "Keccak256", keccak256_topic_0[i].Keccak256_Signature)
-		}
-		FinalConfig = Configuration{Version: config.Version, Name: config.Name, Priority: config.Priority, Addresses: []common.Address{}, Events: keccak256_topic_0}
-		return FinalConfig
-	}
-	// If there is addresses to monitor, we will resolve the signature of the events.
-	for range config.Addresses { //resolve the hex signature from a topic
-		keccak256_topic_0 := config.Events
-		for i, event := range config.Events {
-			keccak256_topic_0[i].Keccak256_Signature = FormatAndHash(event.Signature)
-
-		}
-		FinalConfig = Configuration{Version: config.Version, Name: config.Name, Priority: config.Priority, Addresses: config.Addresses, Events: keccak256_topic_0}
-	}
-
-	return FinalConfig
+// RuleMatch is an event of a rule matched by a log.
+type RuleMatch struct {
+	Config    Configuration
+	Event     Event
+	Decoded   DecodedLog // the fields of the log decoded with the signature of the event.
+	DecodeErr error      // set if the log couldn't be decoded, the conditions of the event (if any) are then not evaluated and the rule matches.
 }
 
-// ReadAllYamlRules Read all the files in the `rules` directory at the given path from the command line `--PathYamlRules` that are YAML files.
-func ReadAllYamlRules(PathYamlRules string, log log.Logger) (GlobalConfiguration, error) {
-	var GlobalConfig GlobalConfiguration
-
-	entries, err := os.ReadDir(PathYamlRules) //Only read yaml files
-	if err != nil {
-		fmt.Println("Error reading directory:", err)
-		panic("Error reading directory")
+// ReturnMatchesFromLog returns all the rules (and their event) matched by a log: the event has the same `Topic[0]` and accepts the indexed values of the log.
+// The rules monitoring the address of the log take precedence, the rules monitoring all the addresses are only returned if none of them matched.
+// If the log can't be decoded, the conditions are not evaluated and the event matches (we prefer a noisy alert than a missed one).
+func (G GlobalConfiguration) ReturnMatchesFromLog(vLog types.Log) []RuleMatch {
+	if len(vLog.Topics) == 0 { // Ensure no anonymous event is here.
+		return nil
 	}
-	var yamlFiles []os.DirEntry
-	// Filter entries for files ending with ".yaml" or ".yml"
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue // Skip directories
+	var matches, wildcardMatches []RuleMatch
+	for _, config := range G.Configuration {
+		wildcard := len(config.Addresses) == 0
+		if !wildcard && !slices.Contains(config.Addresses, vLog.Address) {
+			continue
 		}
-
-		// Check if the file ends with ".yaml" or ".yml"
-		if filepath.Ext(entry.Name()) == ".yaml" || filepath.Ext(entry.Name()) == ".yml" {
-			yamlFiles = append(yamlFiles, entry)
+		for _, event := range config.Events {
+			if event.Keccak256_Signature != vLog.Topics[0] || !event.MatchTopics(vLog.Topics) {
+				continue
+			}
+			match := RuleMatch{Config: config, Event: event}
+			match.Decoded, match.DecodeErr = event.DecodeLog(vLog)
+			if match.DecodeErr == nil {
+				ok, err := event.MatchConditions(match.Decoded)
+				if err != nil {
+					match.DecodeErr = err
+				} else if !ok {
+					continue
+				}
+			}
+			if wildcard {
+				wildcardMatches = append(wildcardMatches, match)
+			} else {
+				matches = append(matches, match)
+			}
 		}
 	}
-	if len(yamlFiles) == 0 {
-		return GlobalConfiguration{}, errors.New("no YAML files found in the directory")
+	if len(matches) > 0 {
+		return matches
 	}
-	for _, file := range yamlFiles {
-		path_rule := PathYamlRules + "/" + file.Name()
-		log.Info("Reading a new rule", "Rule", path_rule)
-		yamlconfig := ReadYamlFile(path_rule)             // Read the yaml file
-		yamlconfig = StringFunctionToHex(yamlconfig, log) // Modify the yaml config to have the common.hash of the event signature.
-		GlobalConfig.Configuration = append(GlobalConfig.Configuration, yamlconfig)
-		// monitoringAddresses = append(monitoringAddresses, fromConfigurationToAddress(yamlconfig)...)
+	return wildcardMatches
+}
 
+// ChainName returns the chain of the rule, the `l1` if not set.
+func (c Configuration) ChainName() string {
+	if c.Chain == "" {
+		return L1Chain
 	}
+	return c.Chain
+}
 
-	yaml_marshalled, err := yaml.Marshal(GlobalConfig)
-	if err != nil {
-		log.Warn("Fail to marshal GlobalConfig to yaml", "ERROR", err)
-		panic("Fail to marshal GlobalConfig to yaml")
+// SplitByChain returns the rules of each chain.
+func (G GlobalConfiguration) SplitByChain() map[string]GlobalConfiguration {
+	chains := make(map[string]GlobalConfiguration)
+	for _, config := range G.Configuration {
+		rules := chains[config.ChainName()]
+		rules.Configuration = append(rules.Configuration, config)
+		chains[config.ChainName()] = rules
 	}
-	err = os.WriteFile("/tmp/globalconfig.yaml", yaml_marshalled, 0644) // Storing the configuration if we need to debug and knows what is monitored in the future.
-	if err != nil {
-		log.Warn("Error writing the globalconfig YAML file on the disk:", "ERROR", err)
-		panic("Error writing the globalconfig YAML file on the disk")
+	return chains
+}
+
+// FilterAddresses returns the addresses of the `FilterLogs` queries for all the rules (the union of their addresses).
+// It returns nil (every address) if a rule monitors events without addresses, so none of its logs is dropped by the node.
+func (G GlobalConfiguration) FilterAddresses() []common.Address {
+	var addresses []common.Address
+	for _, config := range G.Configuration {
+		if len(config.Events) == 0 {
+			continue
+		}
+		if len(config.Addresses) == 0 {
+			return nil
+		}
+		for _, address := range config.Addresses {
+			if !slices.Contains(addresses, address) {
+				addresses = append(addresses, address)
+			}
+		}
 	}
-	return GlobalConfig, nil
+	return addresses
 }
 
 // DisplayMonitorAddresses will display the addresses that are monitored and the events that are monitored for each address.
@@ -169,7 +185,7 @@ func (G GlobalConfiguration) DisplayMonitorAddresses(log log.Logger) {
 	log.Info("============== Monitoring addresses =================")
 
 	for _, config := range G.Configuration {
-		log.Info("", "Name:", config.Name)
+		log.Info("", "Name:", config.Name, "Chain:", config.ChainName())
 		if len(config.Addresses) == 0 && len(config.Events) > 0 {
 			log.Warn("Address:[], No address are defined but some events are defined (this means we are monitoring all the addresses), probably for debugging purposes.")
 			for _, events := range config.Events {
@@ -183,5 +199,8 @@ func (G GlobalConfiguration) DisplayMonitorAddresses(log log.Logger) {
 				}
 			}
 		}
+		for _, call := range config.Calls {
+			log.Info("", "    Calls", call.Signature, "Addresses", call.Addresses, "Internal", call.Internal)
+		}
 	}
 }
@@ -56,3 +56,18 @@ func TestYamlToConfiguration(t *testing.T) {
 		t.Errorf("error: %v", err)
 	}
 }
+
+func TestSplitByChain(t *testing.T) {
+	config := GlobalConfiguration{Configuration: []Configuration{
+		{Name: "L1 rule"},
+		{Name: "Base rule", Chain: "base"},
+		{Name: "Explicit L1 rule", Chain: L1Chain},
+	}}
+	chains := config.SplitByChain()
+	if len(chains) != 2 || len(chains[L1Chain].Configuration) != 2 || len(chains["base"].Configuration) != 1 {
+		t.Errorf("unexpected split of the rules by chain: %+v", chains)
+	}
+	if chains["base"].Configuration[0].Name != "Base rule" {
+		t.Errorf("expected the base rule, got %q", chains["base"].Configuration[0].Name)
+	}
+}
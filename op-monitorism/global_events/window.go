@@ -0,0 +1,144 @@
+package global_events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// WindowRate alerts when the rule matches more than `threshold` times within the window.
+	WindowRate = "rate"
+	// WindowAbsence alerts when the rule didn't match for the duration of the window.
+	WindowAbsence = "absence"
+)
+
+// Window turns a rule into a windowed rule: the matches of its events and calls are counted over a sliding window of block time.
+type Window struct {
+	Type      string        `yaml:"type"`                // `rate` or `absence`.
+	Duration  time.Duration `yaml:"duration"`            // the length of the window in block time (e.g: "10m", "2h").
+	Threshold int           `yaml:"threshold,omitempty"` // for the `rate` type, the maximum number of matches within the window.
+}
+
+// Validate ensures the window is usable.
+func (w Window) Validate() error {
+	if w.Duration < time.Second {
+		return fmt.Errorf("the window duration %s has to be at least 1s", w.Duration)
+	}
+	switch w.Type {
+	case WindowRate:
+		if w.Threshold < 0 {
+			return fmt.Errorf("the window threshold %d can't be negative", w.Threshold)
+		}
+	case WindowAbsence:
+		if w.Threshold != 0 {
+			return fmt.Errorf("the window threshold is only used by the %q type", WindowRate)
+		}
+	default:
+		return fmt.Errorf("unknown window type %q, expected %q or %q", w.Type, WindowRate, WindowAbsence)
+	}
+	return nil
+}
+
+// WindowState is the state of a windowed rule, stored in the checkpoint to survive the restarts.
+type WindowState struct {
+	Occurrences []uint64 `json:"occurrences,omitempty"` // the block timestamps of the matches within the window (only for the `rate` type).
+	LastSeen    uint64   `json:"lastSeen"`              // the block timestamp of the last match, or of the first block monitored if the rule never matched.
+	Violation   bool     `json:"violation"`             // the result of the last evaluation.
+}
+
+// Record adds a match of the rule at the block timestamp `timestamp`.
+func (w Window) Record(state *WindowState, timestamp uint64) {
+	if w.Type == WindowRate {
+		state.Occurrences = append(state.Occurrences, timestamp)
+	}
+	if timestamp > state.LastSeen {
+		state.LastSeen = timestamp
+	}
+}
+
+// Evaluate prunes the matches out of the window ending at the block timestamp `now` and returns the number of matches within the window, the seconds since the last match and whether the rule is violated.
+func (w Window) Evaluate(state *WindowState, now uint64) (count int, sinceLast uint64, violation bool) {
+	if state.LastSeen == 0 { // the clock of the absence starts with the first block monitored.
+		state.LastSeen = now
+	}
+	if now > state.LastSeen {
+		sinceLast = now - state.LastSeen
+	}
+	duration := uint64(w.Duration / time.Second)
+	kept := state.Occurrences[:0]
+	for _, timestamp := range state.Occurrences {
+		if timestamp+duration > now {
+			kept = append(kept, timestamp)
+		}
+	}
+	state.Occurrences = kept
+	count = len(kept)
+
+	switch w.Type {
+	case WindowRate:
+		violation = count > w.Threshold
+	case WindowAbsence:
+		violation = sinceLast >= duration
+	}
+	return count, sinceLast, violation
+}
+
+// recordOccurrence records a match of a windowed rule in the block.
+func (c *chainMonitor) recordOccurrence(config Configuration, block *types.Block) {
+	if config.Window == nil {
+		return
+	}
+	config.Window.Record(c.windowState(config.Name), block.Time())
+}
+
+// windowState returns the state of a windowed rule, created if needed.
+func (c *chainMonitor) windowState(name string) *WindowState {
+	state, ok := c.windows[name]
+	if !ok {
+		state = &WindowState{}
+		c.windows[name] = state
+	}
+	return state
+}
+
+// evaluateWindows evaluates all the windowed rules at the time of the block (after all its matches were recorded).
+func (c *chainMonitor) evaluateWindows(block *types.Block) {
+	for _, config := range c.globalconfig.Configuration {
+		if config.Window == nil {
+			continue
+		}
+		state := c.windowState(config.Name)
+		wasViolated := state.Violation
+		count, sinceLast, violation := config.Window.Evaluate(state, block.Time())
+		state.Violation = violation
+
+		c.windowOccurrences.WithLabelValues(c.nickname, c.chain, config.Name, config.Priority, config.Window.Type).Set(float64(count))
+		c.windowSecondsSinceLast.WithLabelValues(c.nickname, c.chain, config.Name, config.Priority, config.Window.Type).Set(float64(sinceLast))
+		if violation {
+			c.windowViolation.WithLabelValues(c.nickname, c.chain, config.Name, config.Priority, config.Window.Type).Set(1)
+		} else {
+			c.windowViolation.WithLabelValues(c.nickname, c.chain, config.Name, config.Priority, config.Window.Type).Set(0)
+		}
+
+		switch {
+		case violation && !wasViolated:
+			c.log.Warn("Window Violation", "RuleName", config.Name, "Priority", config.Priority, "Type", config.Window.Type, "Duration", config.Window.Duration, "Threshold", config.Window.Threshold, "Occurrences", count, "SecondsSinceLast", sinceLast, "CurrentBlock", block.Number().String())
+		case !violation && wasViolated:
+			c.log.Info("Window Recovered", "RuleName", config.Name, "Priority", config.Priority, "Type", config.Window.Type, "Occurrences", count, "SecondsSinceLast", sinceLast, "CurrentBlock", block.Number().String())
+		}
+	}
+}
+
+// restoreWindows restores the states of the windowed rules from the checkpoint, the states of the rules that are no longer windowed are dropped.
+func (c *chainMonitor) restoreWindows(checkpoint *Checkpoint) {
+	if checkpoint == nil {
+		return
+	}
+	for _, config := range c.globalconfig.Configuration {
+		if state, ok := checkpoint.Windows[config.Name]; ok && config.Window != nil && state != nil {
+			c.windows[config.Name] = state
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package global_events
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestWindowValidate(t *testing.T) {
+	var config Configuration
+	require.NoError(t, yaml.Unmarshal([]byte("window:\n  type: rate\n  duration: 10m\n  threshold: 3\n"), &config))
+	require.Equal(t, &Window{Type: WindowRate, Duration: 10 * time.Minute, Threshold: 3}, config.Window)
+	require.NoError(t, config.Window.Validate())
+
+	require.NoError(t, Window{Type: WindowAbsence, Duration: 2 * time.Hour}.Validate())
+	require.Error(t, Window{Type: WindowAbsence, Duration: 2 * time.Hour, Threshold: 1}.Validate())
+	require.Error(t, Window{Type: WindowRate, Threshold: 3}.Validate(), "no duration")
+	require.Error(t, Window{Type: "burst", Duration: time.Hour}.Validate())
+}
+
+func TestDuplicateRuleNames(t *testing.T) {
+	// Two rules named alike would share their windows.
+	dir := t.TempDir()
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("name: Safe failures\n"), 0o644))
+	}
+	_, err := ReadAllYamlRules(dir, oplog.NewLogger(io.Discard, oplog.DefaultCLIConfig()))
+	require.ErrorContains(t, err, `duplicate rule name "Safe failures"`)
+}
+
+func TestWindowRate(t *testing.T) {
+	window := Window{Type: WindowRate, Duration: 60 * time.Second, Threshold: 2}
+	state := &WindowState{}
+
+	for _, timestamp := range []uint64{1000, 1010, 1020} {
+		window.Record(state, timestamp)
+	}
+	count, sinceLast, violation := window.Evaluate(state, 1030)
+	require.Equal(t, 3, count)
+	require.Equal(t, uint64(10), sinceLast)
+	require.True(t, violation, "more than 2 matches within 60s")
+
+	count, _, violation = window.Evaluate(state, 1060)
+	require.Equal(t, 2, count, "the match at 1000 is out of the window")
+	require.False(t, violation)
+	require.Equal(t, []uint64{1010, 1020}, state.Occurrences)
+}
+
+func TestWindowAbsence(t *testing.T) {
+	window := Window{Type: WindowAbsence, Duration: 2 * time.Hour}
+	state := &WindowState{}
+
+	_, sinceLast, violation := window.Evaluate(state, 10_000)
+	require.Equal(t, uint64(0), sinceLast, "the clock starts with the first block")
+	require.False(t, violation)
+
+	_, sinceLast, violation = window.Evaluate(state, 10_000+7200)
+	require.Equal(t, uint64(7200), sinceLast)
+	require.True(t, violation)
+
+	window.Record(state, 17_300)
+	_, _, violation = window.Evaluate(state, 17_300)
+	require.False(t, violation)
+	require.Empty(t, state.Occurrences, "the matches are only kept for the rate")
+}
@@ -48,9 +48,16 @@ type BlockProcessor struct {
 	cancel           context.CancelFunc
 	metrics          Metrics
 	useLatest        bool
+	blockTag         string
 
-	// Optional log filter. When logFilterAddresses is non-empty, per-block logs are
-	// fetched with eth_getLogs (filtered) instead of pulling every block receipt.
+	// Optional callback invoked once a block is fully processed (transactions, block
+	// and logs), after the lastProcessed cursor moved to it. Monitors use it to
+	// checkpoint the cursor or to evaluate per-block state.
+	onBlockProcessed func(block *types.Block)
+
+	// Optional log filter. When logFilterAddresses or logFilterTopics is non-empty,
+	// per-block logs are fetched with eth_getLogs (filtered) instead of pulling every
+	// block receipt.
 	// This is far cheaper on busy chains and works against nodes that don't serve
 	// batch eth_getBlockReceipts for a given block (e.g. anvil fork-base blocks).
 	logFilterAddresses []common.Address
@@ -73,13 +80,18 @@ type BlockProcessor struct {
 
 // Config holds the configuration for the processor
 type Config struct {
-	StartBlock *big.Int      // Optional: starting block number
+	StartBlock *big.Int      // Optional: last block already processed, nil to start from the head (0 means block 0 was processed)
 	Interval   time.Duration // Optional: polling interval
 	UseLatest  bool          // Optional: use latest block instead of finalized block, not reorg safe
+	BlockTag   string        // Optional: block tag followed as the chain head ("latest", "safe" or "finalized"), overrides UseLatest
+
+	// Optional callback invoked after each block is fully processed.
+	OnBlockProcessed func(block *types.Block)
 
 	// Optional log filter (only used when a logProcessFunc is set). When
-	// LogFilterAddresses is non-empty, logs are fetched per block via eth_getLogs
-	// filtered by these addresses/topics instead of by pulling every block receipt.
+	// LogFilterAddresses or LogFilterTopics is non-empty, logs are fetched per block
+	// via eth_getLogs filtered by these addresses/topics instead of by pulling every
+	// block receipt.
 	LogFilterAddresses []common.Address
 	LogFilterTopics    [][]common.Hash
 
@@ -144,6 +156,8 @@ func NewBlockProcessor(
 		metrics:          metrics,
 		log:              log,
 		useLatest:        config.UseLatest,
+		blockTag:         config.BlockTag,
+		onBlockProcessed: config.OnBlockProcessed,
 
 		logFilterAddresses: config.LogFilterAddresses,
 		logFilterTopics:    config.LogFilterTopics,
@@ -181,10 +195,18 @@ func NewBlockProcessor(
 	return p, nil
 }
 
+// StartCursor returns the StartBlock of a processor configured with the last block already processed, 0 starting from the head.
+func StartCursor(lastProcessed uint64) *big.Int {
+	if lastProcessed == 0 {
+		return nil
+	}
+	return new(big.Int).SetUint64(lastProcessed)
+}
+
 // Start begins the processing loop
 func (p *BlockProcessor) Start() error {
 	// If no starting block was specified, get the latest finalized block
-	if p.lastProcessed == nil || p.lastProcessed.Cmp(big.NewInt(0)) == 0 {
+	if p.lastProcessed == nil {
 		block, err := p.getLatestBlock()
 		if err != nil {
 			return err
@@ -281,7 +303,7 @@ func (p *BlockProcessor) processBlock(blockNumber *big.Int) error {
 	// matching logs via eth_getLogs (cheap, and works against nodes that don't serve
 	// batch eth_getBlockReceipts for the block); otherwise pull every receipt.
 	if p.logProcessFunc != nil {
-		if len(p.logFilterAddresses) > 0 {
+		if len(p.logFilterAddresses) > 0 || len(p.logFilterTopics) > 0 {
 			if err := p.processFilteredLogs(block); err != nil {
 				return err
 			}
@@ -304,6 +326,10 @@ func (p *BlockProcessor) processBlock(blockNumber *big.Int) error {
 	p.lastProcessed = new(big.Int).Set(blockNumber)
 	p.metrics.highestBlockProcessed.Set(float64(p.lastProcessed.Int64()))
 
+	if p.onBlockProcessed != nil {
+		p.onBlockProcessed(block)
+	}
+
 	return nil
 }
 
@@ -524,13 +550,20 @@ func (p *BlockProcessor) getBlockReceiptsWithRetry(block *types.Block) ([]*types
 	}
 }
 
-func (p *BlockProcessor) getLatestBlock() (*types.Block, error) {
-	var tag string
-	if p.useLatest {
-		tag = "latest"
-	} else {
-		tag = "finalized"
+// headTag returns the block tag followed as the chain head.
+func (p *BlockProcessor) headTag() string {
+	switch {
+	case p.blockTag != "":
+		return p.blockTag
+	case p.useLatest:
+		return "latest"
+	default:
+		return "finalized"
 	}
+}
+
+func (p *BlockProcessor) getLatestBlock() (*types.Block, error) {
+	tag := p.headTag()
 
 	var header *types.Header
 	err := p.client.Client().CallContext(p.ctx, &header, "eth_getBlockByNumber", tag, false)
@@ -134,3 +134,22 @@ func TestFilteredLogsRetryCancellation(t *testing.T) {
 		t.Fatal("filtered-log retry did not stop promptly on cancellation")
 	}
 }
+
+func TestHeadTag(t *testing.T) {
+	assert.Equal(t, "finalized", (&BlockProcessor{}).headTag())
+	assert.Equal(t, "latest", (&BlockProcessor{useLatest: true}).headTag())
+	assert.Equal(t, "safe", (&BlockProcessor{useLatest: true, blockTag: "safe"}).headTag(), "the block tag overrides UseLatest")
+}
+
+func TestStartFromBlockZero(t *testing.T) {
+	// A cursor of 0 means block 0 was processed: the head is not queried, the client is never used.
+	p := testProcessor(nil, nil)
+	p.interval = time.Hour
+	p.lastProcessed = big.NewInt(0)
+	p.cancel()
+	require.ErrorIs(t, p.Start(), context.Canceled)
+	require.Equal(t, big.NewInt(0), p.lastProcessed)
+
+	require.Nil(t, StartCursor(0))
+	require.Equal(t, big.NewInt(5), StartCursor(5))
+}
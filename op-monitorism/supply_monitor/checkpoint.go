@@ -0,0 +1,63 @@
+package supply_monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Checkpoint is the ledger persisted on the disk so a restart resumes from the last blocks checked with the same baseline, instead of
+// assuming again that the L1 backing matches the L2 supply.
+type Checkpoint struct {
+	L2Block       uint64                   `json:"l2Block"`       // the last L2 block accounted.
+	L1Block       uint64                   `json:"l1Block"`       // the L1 origin of the `L2Block`.
+	Supply        *big.Int                 `json:"supply"`        // the ETH supply of L2 at the `L2Block`.
+	InFlight      map[common.Hash]*big.Int `json:"inFlight"`      // the withdrawals initiated since the start block and not finalized yet.
+	InFlightTotal *big.Int                 `json:"inFlightTotal"` // the net flow of the withdrawals since the start block.
+	Baseline      *big.Int                 `json:"baseline"`      // the surplus at the start block.
+}
+
+// ReadCheckpoint reads the checkpoint stored at `path`. It returns nil (and no error) if the file doesn't exist yet.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the checkpoint %s: %w", path, err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode the checkpoint %s: %w", path, err)
+	}
+	return &checkpoint, nil
+}
+
+// WriteCheckpoint stores the checkpoint at `path`. The file is written next to the destination then renamed so a crash never leaves a truncated checkpoint.
+func WriteCheckpoint(path string, checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode the checkpoint: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create the checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed.
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write the checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write the checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store the checkpoint %s: %w", path, err)
+	}
+	return nil
+}
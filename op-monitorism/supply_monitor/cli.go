@@ -0,0 +1,146 @@
+package supply_monitor
+
+import (
+	"fmt"
+	"math/big"
+
+	opservice "github.com/ethereum-optimism/optimism/op-service"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	L1NodeURLFlagName = "l1.node.url"
+	L2NodeURLFlagName = "l2.node.url"
+
+	OptimismPortalAddressFlagName = "optimismportal.address"
+	ETHLockboxAddressFlagName     = "ethlockbox.address"
+	StartBlockFlagName            = "start.block"
+	StartSupplyFlagName           = "start.supply"
+	BlockTagFlagName              = "block.tag"
+	MaxBlocksFlagName             = "max.blocks"
+	CheckpointFileFlagName        = "checkpoint.file"
+)
+
+type CLIConfig struct {
+	L1NodeURL string
+	L2NodeURL string
+
+	OptimismPortalAddress common.Address
+	// ETHLockboxAddress is the zero address when the portal holds the ETH itself
+	ETHLockboxAddress common.Address
+
+	StartBlock uint64
+	// StartSupply is the total ETH supply of L2 at the start block in wei, nil when unknown
+	StartSupply *big.Int
+	BlockTag    string
+	MaxBlocks   uint64
+	// CheckpointFile is the path of the file storing the ledger, empty if the checkpoints are disabled
+	CheckpointFile string
+}
+
+func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
+	cfg := CLIConfig{
+		L1NodeURL:  ctx.String(L1NodeURLFlagName),
+		L2NodeURL:  ctx.String(L2NodeURLFlagName),
+		StartBlock: ctx.Uint64(StartBlockFlagName),
+		BlockTag:   ctx.String(BlockTagFlagName),
+		MaxBlocks:  ctx.Uint64(MaxBlocksFlagName),
+
+		CheckpointFile: ctx.String(CheckpointFileFlagName),
+	}
+
+	portalAddress := ctx.String(OptimismPortalAddressFlagName)
+	if !common.IsHexAddress(portalAddress) {
+		return cfg, fmt.Errorf("--%s is not a hex-encoded address", OptimismPortalAddressFlagName)
+	}
+	cfg.OptimismPortalAddress = common.HexToAddress(portalAddress)
+
+	if lockboxAddress := ctx.String(ETHLockboxAddressFlagName); lockboxAddress != "" {
+		if !common.IsHexAddress(lockboxAddress) {
+			return cfg, fmt.Errorf("--%s is not a hex-encoded address", ETHLockboxAddressFlagName)
+		}
+		cfg.ETHLockboxAddress = common.HexToAddress(lockboxAddress)
+	}
+
+	if startSupply := ctx.String(StartSupplyFlagName); startSupply != "" {
+		supply, ok := new(big.Int).SetString(startSupply, 10)
+		if !ok || supply.Sign() < 0 {
+			return cfg, fmt.Errorf("--%s is not an amount of wei", StartSupplyFlagName)
+		}
+		cfg.StartSupply = supply
+	}
+
+	// Without a checkpoint, every restart starts a new ledger: the start supply must then be the supply of a fixed start block, and
+	// without it the backing would be assumed again to match the L2 supply, absorbing any deficit built up before the restart.
+	if cfg.CheckpointFile == "" {
+		if cfg.StartSupply == nil {
+			return cfg, fmt.Errorf("--%s or --%s is required", StartSupplyFlagName, CheckpointFileFlagName)
+		}
+		if cfg.StartBlock == 0 {
+			return cfg, fmt.Errorf("--%s requires --%s without --%s", StartSupplyFlagName, StartBlockFlagName, CheckpointFileFlagName)
+		}
+	}
+
+	if cfg.MaxBlocks == 0 {
+		return cfg, fmt.Errorf("--%s must be positive", MaxBlocksFlagName)
+	}
+	return cfg, nil
+}
+
+func CLIFlags(envVar string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     L1NodeURLFlagName,
+			Usage:    "Node URL of L1 archive Geth node",
+			EnvVars:  opservice.PrefixEnvVar(envVar, "L1_NODE_URL"),
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     L2NodeURLFlagName,
+			Usage:    "Node URL of L2 archive Op-Geth node",
+			EnvVars:  opservice.PrefixEnvVar(envVar, "L2_NODE_URL"),
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     OptimismPortalAddressFlagName,
+			Usage:    "Address of the OptimismPortal contract",
+			EnvVars:  opservice.PrefixEnvVar(envVar, "OPTIMISM_PORTAL"),
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:    ETHLockboxAddressFlagName,
+			Usage:   "Address of the ETHLockbox contract, if the chain locks its ETH in one",
+			EnvVars: opservice.PrefixEnvVar(envVar, "ETH_LOCKBOX"),
+		},
+		&cli.Uint64Flag{
+			Name:    StartBlockFlagName,
+			Usage:   "L2 block number the supply is tracked from. Omit to start from the current block",
+			EnvVars: opservice.PrefixEnvVar(envVar, "START_BLOCK"),
+		},
+		&cli.StringFlag{
+			Name:    StartSupplyFlagName,
+			Usage:   "Total ETH supply of L2 at the start block, in wei. Omit to assume that the L1 backing matched the L2 supply at the start block (requires checkpoint.file)",
+			EnvVars: opservice.PrefixEnvVar(envVar, "START_SUPPLY"),
+		},
+		&cli.StringFlag{
+			Name:    BlockTagFlagName,
+			Usage:   "Block tag of the L2 blocks checked (\"latest\", \"safe\" or \"finalized\")",
+			Value:   "finalized",
+			EnvVars: opservice.PrefixEnvVar(envVar, "BLOCK_TAG"),
+		},
+		&cli.Uint64Flag{
+			Name:    MaxBlocksFlagName,
+			Usage:   "Maximum number of L2 blocks processed per loop",
+			Value:   1000,
+			EnvVars: opservice.PrefixEnvVar(envVar, "MAX_BLOCKS"),
+		},
+		&cli.StringFlag{
+			Name:    CheckpointFileFlagName,
+			Usage:   "Path of the file storing the ledger, so a restart resumes from it. The start block and supply are ignored when it exists",
+			EnvVars: opservice.PrefixEnvVar(envVar, "CHECKPOINT_FILE"),
+		},
+	}
+}
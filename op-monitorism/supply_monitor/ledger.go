@@ -0,0 +1,132 @@
+package supply_monitor
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ledger tracks the ETH supply of L2 and the withdrawals in flight since the start block.
+//
+// The supply of L2 is the ETH minted by the deposits minus the ETH burned by the L2ToL1MessagePasser. The ETH of an initiated withdrawal
+// leaves the circulating supply as soon as it's sent to the message passer, but is only released by the OptimismPortal once the
+// withdrawal is finalized on L1. Until then it's in flight and still has to be backed on L1.
+//
+// The withdrawals in flight at the start block are unknown, so the total in flight is the net flow since the start block: the value of
+// the withdrawals initiated minus the value of the withdrawals finalized. It's negative when more was finalized than initiated since
+// then, and the surplus stays equal to the value in flight at the start block as long as the ETH is conserved. That value stays in the
+// surplus, including the withdrawals that are never finalized, so the surplus at the start block is the baseline and any drift below it
+// is a violation.
+type ledger struct {
+	supply *big.Int
+
+	// the withdrawals initiated since the start block and not finalized yet, by withdrawal hash
+	inFlight      map[common.Hash]*big.Int
+	inFlightTotal *big.Int
+
+	// baseline is the surplus at the start block
+	baseline *big.Int
+}
+
+func newLedger(supply *big.Int) *ledger {
+	return &ledger{
+		supply:        new(big.Int).Set(supply),
+		inFlight:      make(map[common.Hash]*big.Int),
+		inFlightTotal: new(big.Int),
+		baseline:      new(big.Int),
+	}
+}
+
+// setBaseline records the surplus at the start block.
+func (l *ledger) setBaseline(backing, messagePasserBalance *big.Int) {
+	l.baseline = l.surplus(backing, messagePasserBalance)
+}
+
+// mint adds the ETH minted by deposits to the supply.
+func (l *ledger) mint(amount *big.Int) {
+	l.supply.Add(l.supply, amount)
+}
+
+// burn removes the ETH burned by the message passer from the supply.
+func (l *ledger) burn(amount *big.Int) {
+	l.supply.Sub(l.supply, amount)
+}
+
+// initiate records a withdrawal sent to the message passer.
+func (l *ledger) initiate(withdrawalHash common.Hash, value *big.Int) {
+	if value.Sign() == 0 {
+		return
+	}
+	if _, ok := l.inFlight[withdrawalHash]; ok {
+		return
+	}
+	l.inFlight[withdrawalHash] = new(big.Int).Set(value)
+	l.inFlightTotal.Add(l.inFlightTotal, value)
+}
+
+// tracks returns true if the withdrawal was initiated since the start block and isn't finalized yet.
+func (l *ledger) tracks(withdrawalHash common.Hash) bool {
+	_, ok := l.inFlight[withdrawalHash]
+	return ok
+}
+
+// finalize records a withdrawal finalized on L1. The value is only needed for a withdrawal initiated before the start block, the value
+// of a tracked withdrawal is known.
+func (l *ledger) finalize(withdrawalHash common.Hash, value *big.Int) {
+	if tracked, ok := l.inFlight[withdrawalHash]; ok {
+		delete(l.inFlight, withdrawalHash)
+		value = tracked
+	}
+	l.inFlightTotal.Sub(l.inFlightTotal, value)
+}
+
+// circulating returns the ETH supply of L2 that isn't held by the message passer waiting to be burned.
+func (l *ledger) circulating(messagePasserBalance *big.Int) *big.Int {
+	return new(big.Int).Sub(l.supply, messagePasserBalance)
+}
+
+// surplus returns the ETH locked on L1 that isn't needed to back the circulating supply and the withdrawals in flight. A negative surplus
+// means that L2 holds more ETH than L1 can release.
+func (l *ledger) surplus(backing, messagePasserBalance *big.Int) *big.Int {
+	required := new(big.Int).Add(l.circulating(messagePasserBalance), l.inFlightTotal)
+	return new(big.Int).Sub(backing, required)
+}
+
+// drift returns the change of the surplus since the start block. A negative drift means that L2 holds more ETH than L1 can release,
+// even by less than the value in flight at the start block.
+func (l *ledger) drift(backing, messagePasserBalance *big.Int) *big.Int {
+	return new(big.Int).Sub(l.surplus(backing, messagePasserBalance), l.baseline)
+}
+
+// checkpoint returns the state of the ledger to persist once the blocks up to l2Block and l1Block are accounted.
+func (l *ledger) checkpoint(l2Block, l1Block uint64) *Checkpoint {
+	return &Checkpoint{
+		L2Block:       l2Block,
+		L1Block:       l1Block,
+		Supply:        l.supply,
+		InFlight:      l.inFlight,
+		InFlightTotal: l.inFlightTotal,
+		Baseline:      l.baseline,
+	}
+}
+
+// restoreLedger restores the ledger persisted in a checkpoint.
+func restoreLedger(checkpoint *Checkpoint) (*ledger, error) {
+	if checkpoint.Supply == nil || checkpoint.InFlightTotal == nil || checkpoint.Baseline == nil {
+		return nil, fmt.Errorf("incomplete checkpoint")
+	}
+	inFlight := make(map[common.Hash]*big.Int, len(checkpoint.InFlight))
+	for withdrawalHash, value := range checkpoint.InFlight {
+		if value == nil {
+			return nil, fmt.Errorf("no value for the withdrawal %s in the checkpoint", withdrawalHash)
+		}
+		inFlight[withdrawalHash] = value
+	}
+	return &ledger{
+		supply:        checkpoint.Supply,
+		inFlight:      inFlight,
+		inFlightTotal: checkpoint.InFlightTotal,
+		baseline:      checkpoint.Baseline,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package supply_monitor
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	l1bindings "github.com/ethereum-optimism/monitorism/op-monitorism/withdrawals-v2/bindings"
+	"github.com/ethereum-optimism/optimism/op-chain-ops/crossdomain"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerSurplus(t *testing.T) {
+	// 100 ETH on L2, of which 10 in the message passer waiting to be burned, backed by 100 ETH on L1.
+	l := newLedger(big.NewInt(100))
+	require.Equal(t, big.NewInt(90), l.circulating(big.NewInt(10)))
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(100), big.NewInt(10)))
+
+	// A deposit of 5 ETH is locked on L1 and minted on L2.
+	l.mint(big.NewInt(5))
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(105), big.NewInt(10)))
+
+	// A withdrawal of 20 ETH is sent to the message passer, the ETH is still locked on L1.
+	first, second := common.HexToHash("0x01"), common.HexToHash("0x02")
+	l.initiate(first, big.NewInt(20))
+	l.initiate(first, big.NewInt(20))
+	l.initiate(second, big.NewInt(0))
+	require.Equal(t, big.NewInt(20), l.inFlightTotal)
+	require.Len(t, l.inFlight, 1)
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(105), big.NewInt(30)))
+
+	// The message passer burns its balance.
+	l.burn(big.NewInt(30))
+	require.Equal(t, big.NewInt(75), l.supply)
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(105), big.NewInt(0)))
+
+	// The withdrawal is finalized and released on L1, its tracked value is used.
+	require.True(t, l.tracks(first))
+	l.finalize(first, big.NewInt(0))
+	require.False(t, l.tracks(first))
+	require.Zero(t, l.inFlightTotal.Sign())
+	require.Equal(t, big.NewInt(10), l.surplus(big.NewInt(85), big.NewInt(0)))
+
+	// ETH minted on L2 without a deposit isn't backed.
+	l.mint(big.NewInt(15))
+	require.Equal(t, big.NewInt(-5), l.surplus(big.NewInt(85), big.NewInt(0)))
+}
+
+func TestLedgerPreStartWithdrawal(t *testing.T) {
+	// Without a start supply, the circulating supply is assumed to match the 100 ETH locked on L1, while a withdrawal of 10 ETH
+	// initiated before the start block is still in flight.
+	l := newLedger(big.NewInt(100))
+	require.Zero(t, l.surplus(big.NewInt(100), big.NewInt(0)).Sign())
+
+	// A withdrawal of 5 ETH is initiated after the start block.
+	l.initiate(common.HexToHash("0x01"), big.NewInt(5))
+	l.burn(big.NewInt(5))
+	require.Zero(t, l.surplus(big.NewInt(100), big.NewInt(0)).Sign())
+
+	// The withdrawal of the start block is finalized: 10 ETH leave L1 and the net flow in flight turns negative.
+	preStart := common.HexToHash("0x02")
+	require.False(t, l.tracks(preStart))
+	l.finalize(preStart, big.NewInt(10))
+	require.Equal(t, big.NewInt(-5), l.inFlightTotal)
+	require.Len(t, l.inFlight, 1)
+	require.Zero(t, l.surplus(big.NewInt(90), big.NewInt(0)).Sign(), "the release of a pre-start withdrawal isn't a violation")
+
+	// ETH leaving L1 without a withdrawal still is.
+	require.Equal(t, big.NewInt(-1), l.surplus(big.NewInt(89), big.NewInt(0)))
+}
+
+func TestLedgerDrift(t *testing.T) {
+	// With the start supply, 100 ETH on L2 are backed by 110 ETH on L1: a withdrawal of 10 ETH initiated before the start block is
+	// waiting for its proof window, and may never be finalized.
+	l := newLedger(big.NewInt(100))
+	l.setBaseline(big.NewInt(110), big.NewInt(0))
+	require.Equal(t, big.NewInt(10), l.baseline)
+	require.Zero(t, l.drift(big.NewInt(110), big.NewInt(0)).Sign())
+
+	// 4 ETH are minted on L2 without a deposit: the surplus stays positive, the drift reports the deficit.
+	l.mint(big.NewInt(4))
+	require.Equal(t, big.NewInt(6), l.surplus(big.NewInt(110), big.NewInt(0)))
+	require.Equal(t, big.NewInt(-4), l.drift(big.NewInt(110), big.NewInt(0)))
+
+	// The deficit survives a restart from the checkpoint.
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	l.initiate(common.HexToHash("0x01"), big.NewInt(3))
+	require.NoError(t, WriteCheckpoint(path, l.checkpoint(20, 10)))
+	checkpoint, err := ReadCheckpoint(path)
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), checkpoint.L2Block)
+	require.Equal(t, uint64(10), checkpoint.L1Block)
+	restored, err := restoreLedger(checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, l, restored)
+	require.Equal(t, big.NewInt(-4), restored.drift(big.NewInt(110), big.NewInt(3)))
+	require.True(t, restored.tracks(common.HexToHash("0x01")))
+
+	_, err = restoreLedger(&Checkpoint{Supply: big.NewInt(1)})
+	require.Error(t, err)
+}
+
+func TestReadMissingCheckpoint(t *testing.T) {
+	checkpoint, err := ReadCheckpoint(filepath.Join(t.TempDir(), "checkpoint.json"))
+	require.NoError(t, err)
+	require.Nil(t, checkpoint, "a missing checkpoint is not an error")
+}
+
+func TestFindFinalizedWithdrawal(t *testing.T) {
+	portalABI, err := l1bindings.OptimismPortal2MetaData.GetAbi()
+	require.NoError(t, err)
+	portal, relayer := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	finalize := func(value int64) (hexutil.Bytes, common.Hash) {
+		tx := l1bindings.TypesWithdrawalTransaction{Nonce: big.NewInt(value), Sender: relayer, Target: relayer, Value: big.NewInt(value), GasLimit: big.NewInt(100000), Data: []byte{}}
+		input, err := portalABI.Pack("finalizeWithdrawalTransaction", tx)
+		require.NoError(t, err)
+		hash, err := crossdomain.NewWithdrawal(tx.Nonce, &tx.Sender, &tx.Target, tx.Value, tx.GasLimit, tx.Data).Hash()
+		require.NoError(t, err)
+		return input, hash
+	}
+	first, firstHash := finalize(5)
+	second, secondHash := finalize(7)
+
+	// A batch relayer finalizes both withdrawals, after a reverted decoy claiming the second one.
+	frame := &callFrame{Type: "CALL", To: relayer, Calls: []callFrame{
+		{Type: "CALL", To: portal, Input: first},
+		{Type: "CALL", To: portal, Input: second, Error: "execution reverted"},
+		{Type: "DELEGATECALL", To: portal, Input: second},
+	}}
+	value, ok := findFinalizedWithdrawal(frame, portal, portalABI, firstHash)
+	require.True(t, ok)
+	require.Equal(t, big.NewInt(5), value)
+	_, ok = findFinalizedWithdrawal(frame, portal, portalABI, secondHash)
+	require.False(t, ok, "the reverted and delegated calls don't finalize")
+
+	frame.Calls = append(frame.Calls, callFrame{Type: "CALL", To: portal, Input: second})
+	value, ok = findFinalizedWithdrawal(frame, portal, portalABI, secondHash)
+	require.True(t, ok)
+	require.Equal(t, big.NewInt(7), value)
+}
@@ -0,0 +1,535 @@
+package supply_monitor
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/monitorism/op-monitorism/conservation_monitor"
+	l1bindings "github.com/ethereum-optimism/monitorism/op-monitorism/withdrawals-v2/bindings"
+	l2bindings "github.com/ethereum-optimism/monitorism/op-monitorism/withdrawals/bindings"
+	opbindings "github.com/ethereum-optimism/optimism/op-bindings/bindings"
+	"github.com/ethereum-optimism/optimism/op-chain-ops/crossdomain"
+	"github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/ethereum-optimism/optimism/op-service/predeploys"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	MetricsNamespace = "supply_mon"
+
+	// the `contract` label of the L1 backing
+	PortalContract  = "optimism_portal"
+	LockboxContract = "eth_lockbox"
+)
+
+// blockTags are the block tags supported by --block.tag
+var blockTags = map[string]rpc.BlockNumber{
+	"latest":    rpc.LatestBlockNumber,
+	"safe":      rpc.SafeBlockNumber,
+	"finalized": rpc.FinalizedBlockNumber,
+}
+
+type Monitor struct {
+	log      log.Logger
+	l1Client *ethclient.Client
+	l2Client *ethclient.Client
+
+	portal        *l1bindings.OptimismPortal2Filterer
+	portalABI     *abi.ABI
+	messagePasser *l2bindings.L2ToL1MessagePasserFilterer
+	l1BlockInfo   *opbindings.L1BlockCaller
+
+	portalAddress  common.Address
+	lockboxAddress common.Address
+	startBlock     uint64
+	startSupply    *big.Int
+	blockTag       rpc.BlockNumber
+	maxBlocks      uint64
+	checkpointFile string
+
+	// ledger is nil until the start block is read, l2Block and l1Block are the last blocks accounted on each layer
+	ledger  *ledger
+	l2Block uint64
+	l1Block uint64
+
+	/** Metrics **/
+	l1Backing           *prometheus.GaugeVec
+	l2Supply            prometheus.Gauge
+	circulatingSupply   prometheus.Gauge
+	inFlightWithdrawals prometheus.Gauge
+	inFlightCount       prometheus.Gauge
+	backingSurplus      prometheus.Gauge
+	backingDrift        prometheus.Gauge
+	highestBlockNumber  *prometheus.GaugeVec
+	backingViolations   prometheus.Counter
+	unexpectedRpcErrors *prometheus.CounterVec
+}
+
+func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIConfig) (*Monitor, error) {
+	log.Info("creating the ETH supply monitor")
+	blockTag, ok := blockTags[cfg.BlockTag]
+	if !ok {
+		return nil, fmt.Errorf("unsupported block tag %q", cfg.BlockTag)
+	}
+
+	l1Client, err := ethclient.Dial(cfg.L1NodeURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial l1: %w", err)
+	}
+	l2Client, err := ethclient.Dial(cfg.L2NodeURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial l2: %w", err)
+	}
+
+	portal, err := l1bindings.NewOptimismPortal2Filterer(cfg.OptimismPortalAddress, l1Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to the OptimismPortal: %w", err)
+	}
+	messagePasser, err := l2bindings.NewL2ToL1MessagePasserFilterer(predeploys.L2ToL1MessagePasserAddr, l2Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to the L2ToL1MessagePasser: %w", err)
+	}
+	l1BlockInfo, err := opbindings.NewL1BlockCaller(predeploys.L1BlockAddr, l2Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to the L1Block: %w", err)
+	}
+	portalABI, err := l1bindings.OptimismPortal2MetaData.GetAbi()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the OptimismPortal ABI: %w", err)
+	}
+
+	log.Info("configured the ETH supply monitor",
+		"optimism_portal", cfg.OptimismPortalAddress,
+		"eth_lockbox", cfg.ETHLockboxAddress,
+		"start_block", cfg.StartBlock,
+		"start_supply", cfg.StartSupply,
+		"block_tag", cfg.BlockTag,
+		"checkpoint_file", cfg.CheckpointFile,
+	)
+
+	return &Monitor{
+		log:      log,
+		l1Client: l1Client,
+		l2Client: l2Client,
+
+		portal:        portal,
+		portalABI:     portalABI,
+		messagePasser: messagePasser,
+		l1BlockInfo:   l1BlockInfo,
+
+		portalAddress:  cfg.OptimismPortalAddress,
+		lockboxAddress: cfg.ETHLockboxAddress,
+		startBlock:     cfg.StartBlock,
+		startSupply:    cfg.StartSupply,
+		blockTag:       blockTag,
+		maxBlocks:      cfg.MaxBlocks,
+		checkpointFile: cfg.CheckpointFile,
+
+		l1Backing: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "l1_backing",
+			Help:      "ETH locked on L1 to back the L2 supply, by contract",
+		}, []string{"contract"}),
+		l2Supply: m.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "l2_supply",
+			Help:      "ETH supply of L2: the ETH minted by the deposits minus the ETH burned by the L2ToL1MessagePasser",
+		}),
+		circulatingSupply: m.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "l2_circulating_supply",
+			Help:      "ETH supply of L2 not held by the L2ToL1MessagePasser",
+		}),
+		inFlightWithdrawals: m.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "withdrawals_in_flight",
+			Help:      "ETH of the withdrawals initiated minus the withdrawals finalized since the start block, negative when more withdrawals of before the start block were finalized",
+		}),
+		inFlightCount: m.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "withdrawals_in_flight_count",
+			Help:      "Number of withdrawals initiated since the start block and not finalized on L1",
+		}),
+		backingSurplus: m.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "backing_surplus",
+			Help:      "ETH locked on L1 minus the circulating L2 supply and the withdrawals in flight",
+		}),
+		backingDrift: m.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "backing_drift",
+			Help:      "Backing surplus minus the surplus at the start block, negative when L2 isn't fully backed",
+		}),
+		highestBlockNumber: m.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "highestBlockNumber",
+			Help:      "Last block number checked, by layer",
+		}, []string{"layer"}),
+		backingViolations: m.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "backing_violations_total",
+			Help:      "Number of checks where the backing surplus drifted below the start block",
+		}),
+		unexpectedRpcErrors: m.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "unexpectedRpcErrors",
+			Help:      "number of unexpected rpc errors",
+		}, []string{"section", "name"}),
+	}, nil
+}
+
+// snapshot is the state of both layers at an L2 block and its L1 origin.
+type snapshot struct {
+	l2Block              uint64
+	l1Block              uint64
+	backing              map[string]*big.Int
+	messagePasserBalance *big.Int
+}
+
+// backingTotal returns the ETH locked on L1.
+func (s *snapshot) backingTotal() *big.Int {
+	total := new(big.Int)
+	for _, amount := range s.backing {
+		total.Add(total, amount)
+	}
+	return total
+}
+
+// blockRange is what happened on both layers since the last check.
+type blockRange struct {
+	minted    *big.Int
+	burned    *big.Int
+	initiated map[common.Hash]*big.Int
+	finalized map[common.Hash]*big.Int // the value is only read for the withdrawals initiated before the start block
+}
+
+func (m *Monitor) Run(ctx context.Context) {
+	if m.ledger == nil {
+		if err := m.start(ctx); err != nil {
+			m.log.Error("failed to read the start block", "err", err)
+			m.unexpectedRpcErrors.WithLabelValues("supply", "start").Inc()
+		}
+		return
+	}
+
+	head, err := m.l2Client.HeaderByNumber(ctx, big.NewInt(int64(m.blockTag)))
+	if err != nil {
+		m.log.Error("failed to query the L2 head", "err", err)
+		m.unexpectedRpcErrors.WithLabelValues("supply", "HeaderByNumber").Inc()
+		return
+	}
+	if head.Number.Uint64() <= m.l2Block {
+		m.log.Info("no new L2 block", "block", m.l2Block)
+		return
+	}
+	to := min(head.Number.Uint64(), m.l2Block+m.maxBlocks)
+
+	// Everything is queried before the ledger is updated, so a failed query is retried with the same range at the next loop.
+	snap, err := m.snapshot(ctx, to)
+	if err != nil {
+		m.log.Error("failed to query the supply", "block", to, "err", err)
+		m.unexpectedRpcErrors.WithLabelValues("supply", "snapshot").Inc()
+		return
+	}
+	changes, err := m.queryRange(ctx, m.l2Block+1, to, m.l1Block+1, snap.l1Block)
+	if err != nil {
+		m.log.Error("failed to query the blocks", "from", m.l2Block+1, "to", to, "err", err)
+		m.unexpectedRpcErrors.WithLabelValues("supply", "queryRange").Inc()
+		return
+	}
+
+	m.ledger.mint(changes.minted)
+	m.ledger.burn(changes.burned)
+	for withdrawalHash, value := range changes.initiated {
+		m.ledger.initiate(withdrawalHash, value)
+	}
+	for withdrawalHash, value := range changes.finalized {
+		m.ledger.finalize(withdrawalHash, value)
+	}
+	m.l2Block, m.l1Block = snap.l2Block, snap.l1Block
+	m.check(snap)
+	m.storeCheckpoint()
+}
+
+// start restores the ledger from the checkpoint, or reads the state at the start block. Without a start supply, the circulating supply is
+// assumed to match the L1 backing.
+func (m *Monitor) start(ctx context.Context) error {
+	if m.checkpointFile != "" {
+		checkpoint, err := ReadCheckpoint(m.checkpointFile)
+		if err != nil {
+			return err
+		}
+		if checkpoint != nil {
+			ledger, err := restoreLedger(checkpoint)
+			if err != nil {
+				return fmt.Errorf("failed to restore the checkpoint %s: %w", m.checkpointFile, err)
+			}
+			m.log.Info("resuming from the checkpoint", "l2_block", checkpoint.L2Block, "l1_block", checkpoint.L1Block, "baseline", ledger.baseline)
+			m.ledger = ledger
+			m.l2Block, m.l1Block = checkpoint.L2Block, checkpoint.L1Block
+			return nil
+		}
+	}
+
+	block := m.startBlock
+	if block == 0 {
+		head, err := m.l2Client.HeaderByNumber(ctx, big.NewInt(int64(m.blockTag)))
+		if err != nil {
+			return fmt.Errorf("failed to query the L2 head: %w", err)
+		}
+		block = head.Number.Uint64()
+	}
+	snap, err := m.snapshot(ctx, block)
+	if err != nil {
+		return err
+	}
+
+	supply := m.startSupply
+	if supply == nil {
+		supply = new(big.Int).Add(snap.backingTotal(), snap.messagePasserBalance)
+		m.log.Warn("no start supply, assuming that the L1 backing matches the L2 supply", "block", block, "supply", supply)
+	}
+	m.ledger = newLedger(supply)
+	m.ledger.setBaseline(snap.backingTotal(), snap.messagePasserBalance)
+	m.l2Block, m.l1Block = snap.l2Block, snap.l1Block
+	m.check(snap)
+	m.storeCheckpoint()
+	return nil
+}
+
+// storeCheckpoint persists the ledger, if the checkpoints are enabled.
+func (m *Monitor) storeCheckpoint() {
+	if m.checkpointFile == "" {
+		return
+	}
+	if err := WriteCheckpoint(m.checkpointFile, m.ledger.checkpoint(m.l2Block, m.l1Block)); err != nil {
+		// The blocks are not reprocessed, a restart resumes from the previous checkpoint.
+		m.log.Warn("failed to store the checkpoint", "l2_block", m.l2Block, "err", err)
+	}
+}
+
+// snapshot reads the L1 origin of an L2 block, the ETH locked on L1 at the origin and the balance of the message passer at the L2 block.
+// Deposits are minted on L2 in the first block of the epoch of their L1 block, so both layers are aligned at the origin.
+func (m *Monitor) snapshot(ctx context.Context, l2Block uint64) (*snapshot, error) {
+	l2Number := new(big.Int).SetUint64(l2Block)
+	origin, err := m.l1BlockInfo.Number(&bind.CallOpts{Context: ctx, BlockNumber: l2Number})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the L1 origin: %w", err)
+	}
+	l1Number := new(big.Int).SetUint64(origin)
+
+	backing := make(map[string]*big.Int)
+	backing[PortalContract], err = m.l1Client.BalanceAt(ctx, m.portalAddress, l1Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the OptimismPortal balance: %w", err)
+	}
+	if m.lockboxAddress != (common.Address{}) {
+		backing[LockboxContract], err = m.l1Client.BalanceAt(ctx, m.lockboxAddress, l1Number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query the ETHLockbox balance: %w", err)
+		}
+	}
+
+	messagePasserBalance, err := m.l2Client.BalanceAt(ctx, predeploys.L2ToL1MessagePasserAddr, l2Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the L2ToL1MessagePasser balance: %w", err)
+	}
+	return &snapshot{l2Block: l2Block, l1Block: origin, backing: backing, messagePasserBalance: messagePasserBalance}, nil
+}
+
+// queryRange reads the deposits minted, the withdrawals initiated and the ETH burned in the L2 blocks, and the withdrawals finalized in
+// the L1 blocks.
+func (m *Monitor) queryRange(ctx context.Context, l2From, l2To, l1From, l1To uint64) (*blockRange, error) {
+	changes := &blockRange{
+		minted:    new(big.Int),
+		burned:    new(big.Int),
+		initiated: make(map[common.Hash]*big.Int),
+		finalized: make(map[common.Hash]*big.Int),
+	}
+	for number := l2From; number <= l2To; number++ {
+		block, err := m.l2Client.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+		if err != nil {
+			return nil, fmt.Errorf("failed to query L2 block %d: %w", number, err)
+		}
+		changes.minted.Add(changes.minted, conservation_monitor.DepositMint(block))
+	}
+
+	l2Opts := &bind.FilterOpts{Start: l2From, End: &l2To, Context: ctx}
+	messages, err := m.messagePasser.FilterMessagePassed(l2Opts, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter MessagePassed: %w", err)
+	}
+	defer messages.Close()
+	for messages.Next() {
+		changes.initiated[messages.Event.WithdrawalHash] = messages.Event.Value
+	}
+	if err := messages.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate MessagePassed: %w", err)
+	}
+
+	burns, err := m.messagePasser.FilterWithdrawerBalanceBurnt(l2Opts, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter WithdrawerBalanceBurnt: %w", err)
+	}
+	defer burns.Close()
+	for burns.Next() {
+		changes.burned.Add(changes.burned, burns.Event.Amount)
+	}
+	if err := burns.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate WithdrawerBalanceBurnt: %w", err)
+	}
+
+	if l1From > l1To {
+		return changes, nil
+	}
+	// A withdrawal finalized at or before the L1 origin was initiated at or before the L2 block.
+	finalized, err := m.portal.FilterWithdrawalFinalized(&bind.FilterOpts{Start: l1From, End: &l1To, Context: ctx}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter WithdrawalFinalized: %w", err)
+	}
+	defer finalized.Close()
+	for finalized.Next() {
+		withdrawalHash := common.Hash(finalized.Event.WithdrawalHash)
+		if _, ok := changes.initiated[withdrawalHash]; ok || m.ledger.tracks(withdrawalHash) {
+			changes.finalized[withdrawalHash] = nil
+			continue
+		}
+		// The withdrawal was initiated before the start block, its value is read from the call to the portal that finalized it.
+		value, err := m.finalizedValue(ctx, finalized.Event.Raw.TxHash, withdrawalHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the value of the withdrawal %s: %w", withdrawalHash, err)
+		}
+		changes.finalized[withdrawalHash] = value
+	}
+	if err := finalized.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate WithdrawalFinalized: %w", err)
+	}
+	return changes, nil
+}
+
+// callFrame is a frame of the callTracer.
+type callFrame struct {
+	Type  string         `json:"type"`
+	To    common.Address `json:"to"`
+	Input hexutil.Bytes  `json:"input"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+// finalizedValue traces the L1 transaction that finalized a withdrawal and returns the value of the withdrawal. The call to the portal
+// may be made by a contract, e.g. a batch relayer finalizing several withdrawals in one transaction.
+func (m *Monitor) finalizedValue(ctx context.Context, txHash common.Hash, withdrawalHash common.Hash) (*big.Int, error) {
+	var frame callFrame
+	if err := m.l1Client.Client().CallContext(ctx, &frame, "debug_traceTransaction", txHash, map[string]interface{}{"tracer": "callTracer"}); err != nil {
+		return nil, fmt.Errorf("failed to trace the transaction %s: %w", txHash, err)
+	}
+	value, ok := findFinalizedWithdrawal(&frame, m.portalAddress, m.portalABI, withdrawalHash)
+	if !ok {
+		return nil, fmt.Errorf("no call to the portal finalizing it in the transaction %s", txHash)
+	}
+	return value, nil
+}
+
+// findFinalizedWithdrawal walks the call tree and returns the value of the withdrawal finalized by a call to the portal. The reverted
+// frames are skipped with their subtree.
+func findFinalizedWithdrawal(frame *callFrame, portal common.Address, portalABI *abi.ABI, withdrawalHash common.Hash) (*big.Int, bool) {
+	if frame.Error != "" {
+		return nil, false
+	}
+	if frame.Type == "CALL" && frame.To == portal {
+		if tx, ok := decodeFinalizeInput(portalABI, frame.Input); ok {
+			hash, err := crossdomain.NewWithdrawal(tx.Nonce, &tx.Sender, &tx.Target, tx.Value, tx.GasLimit, tx.Data).Hash()
+			if err == nil && hash == withdrawalHash {
+				return tx.Value, true
+			}
+		}
+	}
+	for i := range frame.Calls {
+		if value, ok := findFinalizedWithdrawal(&frame.Calls[i], portal, portalABI, withdrawalHash); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// decodeFinalizeInput decodes the withdrawal of a call to finalizeWithdrawalTransaction or finalizeWithdrawalTransactionExternalProof.
+func decodeFinalizeInput(portalABI *abi.ABI, input []byte) (l1bindings.TypesWithdrawalTransaction, bool) {
+	if len(input) < 4 {
+		return l1bindings.TypesWithdrawalTransaction{}, false
+	}
+	method, err := portalABI.MethodById(input[:4])
+	if err != nil || (method.Name != "finalizeWithdrawalTransaction" && method.Name != "finalizeWithdrawalTransactionExternalProof") {
+		return l1bindings.TypesWithdrawalTransaction{}, false
+	}
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil || len(args) == 0 {
+		return l1bindings.TypesWithdrawalTransaction{}, false
+	}
+	return *abi.ConvertType(args[0], new(l1bindings.TypesWithdrawalTransaction)).(*l1bindings.TypesWithdrawalTransaction), true
+}
+
+// check compares the L2 supply with the L1 backing and reports the metrics. The surplus at the start block includes the ETH in flight
+// then, so a violation is a drift of the surplus below it.
+func (m *Monitor) check(snap *snapshot) {
+	backing := snap.backingTotal()
+	circulating := m.ledger.circulating(snap.messagePasserBalance)
+	surplus := m.ledger.surplus(backing, snap.messagePasserBalance)
+	drift := m.ledger.drift(backing, snap.messagePasserBalance)
+
+	for contract, amount := range snap.backing {
+		m.l1Backing.WithLabelValues(contract).Set(weiToEther(amount))
+	}
+	m.l2Supply.Set(weiToEther(m.ledger.supply))
+	m.circulatingSupply.Set(weiToEther(circulating))
+	m.inFlightWithdrawals.Set(weiToEther(m.ledger.inFlightTotal))
+	m.inFlightCount.Set(float64(len(m.ledger.inFlight)))
+	m.backingSurplus.Set(weiToEther(surplus))
+	m.backingDrift.Set(weiToEther(drift))
+	m.highestBlockNumber.WithLabelValues("l2").Set(float64(snap.l2Block))
+	m.highestBlockNumber.WithLabelValues("l1").Set(float64(snap.l1Block))
+
+	if drift.Sign() < 0 {
+		m.log.Error("L2 ETH supply exceeds the L1 backing",
+			"l2_block", snap.l2Block,
+			"l1_block", snap.l1Block,
+			"backing", backing,
+			"circulating", circulating,
+			"in_flight", m.ledger.inFlightTotal,
+			"surplus", surplus,
+			"start_surplus", m.ledger.baseline,
+			"drift", drift,
+		)
+		m.backingViolations.Inc()
+		return
+	}
+	m.log.Info("L2 ETH supply is backed",
+		"l2_block", snap.l2Block,
+		"l1_block", snap.l1Block,
+		"backing", backing,
+		"circulating", circulating,
+		"in_flight", m.ledger.inFlightTotal,
+		"surplus", surplus,
+		"drift", drift,
+	)
+}
+
+func (m *Monitor) Close(_ context.Context) error {
+	m.l1Client.Close()
+	m.l2Client.Close()
+	return nil
+}
+
+// weiToEther converts an amount of wei to a float in ETH for the metrics.
+func weiToEther(wei *big.Int) float64 {
+	ether, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(params.Ether)).Float64()
+	return ether
+}
@@ -1,14 +1,24 @@
 package transaction_monitor
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/ethereum-optimism/monitorism/op-monitorism/transaction_monitor/bindings/dispute"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
 )
 
 // CheckFunc is a type for address verification functions
@@ -18,6 +28,111 @@ type CheckFunc func(ctx context.Context, client *ethclient.Client, addr common.A
 var AddressChecks = map[CheckType]CheckFunc{
 	ExactMatchCheck:  CheckExactMatch,
 	DisputeGameCheck: CheckDisputeGame,
+	CodeHashCheck:    CheckCodeHash,
+}
+
+// TxCheckFunc is a type for transaction verification functions
+type TxCheckFunc func(ctx context.Context, client *ethclient.Client, tx *types.Transaction, params map[string]interface{}) (bool, error)
+
+// TxChecks maps the check types over the whole transaction to their implementation functions
+var TxChecks = map[CheckType]TxCheckFunc{
+	SelectorCheck: CheckSelector,
+}
+
+// Validate validates the parameters of the check, or of all the checks of the group
+func (c CheckConfig) Validate() error {
+	if len(c.All) > 0 || len(c.Any) > 0 {
+		if c.Type != "" || (len(c.All) > 0 && len(c.Any) > 0) {
+			return fmt.Errorf("a check group has either all or any, and no type")
+		}
+		for _, check := range append(c.All, c.Any...) {
+			if err := check.Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	validate, ok := ParamValidations[c.Type]
+	if !ok {
+		return fmt.Errorf("unknown check type: %s", c.Type)
+	}
+	if err := validate(c.Params); err != nil {
+		return fmt.Errorf("invalid parameters for check type %s: %w", c.Type, err)
+	}
+	return nil
+}
+
+// compile validates the check, or all the checks of the group, and keeps the parsed parameters of the selector and codehash checks so they are not parsed again for every transaction
+func (c *CheckConfig) compile() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	for _, group := range [][]CheckConfig{c.All, c.Any} {
+		for i := range group {
+			if err := group[i].compile(); err != nil {
+				return err
+			}
+		}
+	}
+	switch c.Type {
+	case SelectorCheck:
+		parsed, err := parseSelectorParams(c.Params)
+		if err != nil {
+			return err
+		}
+		c.selector = &parsed
+	case CodeHashCheck:
+		parsed, err := parseCodeHashParams(c.Params)
+		if err != nil {
+			return err
+		}
+		c.codeHash = &parsed
+	}
+	return nil
+}
+
+// Evaluate runs the check against a transaction to the address `to`, a group passes if all (`all`) or any (`any`) of its checks pass
+func (c CheckConfig) Evaluate(ctx context.Context, client *ethclient.Client, tx *types.Transaction, to common.Address) (bool, error) {
+	return c.evaluate(ctx, client, nil, nil, tx, to)
+}
+
+// evaluate runs the check against a transaction of the block `block` to the address `to`, the code of the addresses is read through `codes` (optional)
+func (c CheckConfig) evaluate(ctx context.Context, client *ethclient.Client, codes *codeCache, block *big.Int, tx *types.Transaction, to common.Address) (bool, error) {
+	switch {
+	case len(c.All) > 0:
+		for _, check := range c.All {
+			ok, err := check.evaluate(ctx, client, codes, block, tx, to)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case len(c.Any) > 0:
+		for _, check := range c.Any {
+			ok, err := check.evaluate(ctx, client, codes, block, tx, to)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+	if c.selector != nil {
+		return c.selector.matches(tx), nil
+	}
+	if c.codeHash != nil && codes != nil {
+		info, err := codes.fetch(ctx, client, to, block)
+		if err != nil {
+			return false, err
+		}
+		return c.codeHash.allows(info), nil
+	}
+	if checkFn, ok := AddressChecks[c.Type]; ok {
+		return checkFn(ctx, client, to, c.Params)
+	}
+	if checkFn, ok := TxChecks[c.Type]; ok {
+		return checkFn(ctx, client, tx, c.Params)
+	}
+	return false, fmt.Errorf("unknown check type: %s", c.Type)
 }
 
 // CheckExactMatch verifies if the address matches exactly with the provided match parameter
@@ -77,6 +192,377 @@ func CheckDisputeGame(ctx context.Context, client *ethclient.Client, addr common
 	return factoryResult.Proxy == addr && factoryResult.Timestamp > 0, nil
 }
 
+// ImplementationSlot is the ERC-1967 storage slot of the implementation of a proxy: bytes32(uint256(keccak256("eip1967.proxy.implementation")) - 1)
+var ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+
+// codeInfo is the code of an address as seen by the codehash check
+type codeInfo struct {
+	codeHash           common.Hash
+	implementation     common.Address // the ERC-1967 implementation, zero if the address is not a proxy
+	implementationHash common.Hash
+}
+
+// codeKey identifies the code of an address at a block, `latest` is set for the latest block.
+type codeKey struct {
+	address common.Address
+	block   uint64
+	latest  bool
+}
+
+func newCodeKey(addr common.Address, block *big.Int) codeKey {
+	if block == nil {
+		return codeKey{address: addr, latest: true}
+	}
+	return codeKey{address: addr, block: block.Uint64()}
+}
+
+// codeCache caches the code of the addresses checked by the codehash check of a monitor, for the block being processed. The entries are
+// reused for the transactions of the block they were read at (the latest block reads included) and cleared when a new block starts, the
+// entries of the previous block are only kept to reuse the code hash of the implementation until the proxy is upgraded.
+type codeCache struct {
+	entries  map[codeKey]codeInfo
+	previous map[common.Address]codeInfo
+}
+
+func newCodeCache() *codeCache {
+	return &codeCache{entries: make(map[codeKey]codeInfo), previous: make(map[common.Address]codeInfo)}
+}
+
+// fetch returns the code of an address at the block `block` (nil for the latest block)
+func (c *codeCache) fetch(ctx context.Context, client *ethclient.Client, addr common.Address, block *big.Int) (codeInfo, error) {
+	key := newCodeKey(addr, block)
+	if cached, ok := c.entries[key]; ok {
+		return cached, nil
+	}
+	for cachedKey := range c.entries {
+		if cachedKey.block != key.block || cachedKey.latest != key.latest {
+			c.startBlock()
+		}
+		break // all the entries are of the same block.
+	}
+	var previous *codeInfo
+	if cached, ok := c.previous[addr]; ok {
+		previous = &cached
+	}
+	info, err := fetchCodeInfo(ctx, client, addr, block, previous)
+	if err != nil {
+		return codeInfo{}, err
+	}
+	c.entries[key] = info
+	return info, nil
+}
+
+// startBlock clears the entries of the previous block, keeping the last ones for their implementation.
+func (c *codeCache) startBlock() {
+	c.previous = make(map[common.Address]codeInfo, len(c.entries))
+	for key, info := range c.entries {
+		c.previous[key.address] = info
+	}
+	c.entries = make(map[codeKey]codeInfo)
+}
+
+// fetchCodeInfo returns the code hash of an address and, for an ERC-1967 proxy, its implementation and the code hash of the implementation.
+// The code hash and the implementation slot are read with a single eth_getProof, the code hash of the implementation is reused from
+// `previous` (optional) if the implementation is unchanged.
+func fetchCodeInfo(ctx context.Context, client *ethclient.Client, addr common.Address, block *big.Int, previous *codeInfo) (codeInfo, error) {
+	geth := gethclient.New(client.Client())
+	proof, err := geth.GetProof(ctx, addr, []string{ImplementationSlot.Hex()}, block)
+	if err != nil {
+		return codeInfo{}, fmt.Errorf("failed to get proof of address: %w", err)
+	}
+	info := codeInfo{codeHash: proof.CodeHash}
+	if len(proof.StorageProof) == 1 && proof.StorageProof[0].Value != nil {
+		info.implementation = common.BigToAddress(proof.StorageProof[0].Value)
+	}
+	if info.implementation == (common.Address{}) {
+		return info, nil
+	}
+	if previous != nil && previous.implementation == info.implementation {
+		info.implementationHash = previous.implementationHash
+		return info, nil
+	}
+	implementationProof, err := geth.GetProof(ctx, info.implementation, nil, block)
+	if err != nil {
+		return codeInfo{}, fmt.Errorf("failed to get proof of implementation: %w", err)
+	}
+	info.implementationHash = implementationProof.CodeHash
+	return info, nil
+}
+
+// parseHashes parses a hash or a list of hashes parameter, a missing parameter is an empty list
+func parseHashes(value interface{}) ([]common.Hash, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		list = []interface{}{value}
+	}
+	hashes := make([]common.Hash, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid hash %v", item)
+		}
+		decoded, err := hexutil.Decode(s)
+		if err != nil || len(decoded) != common.HashLength {
+			return nil, fmt.Errorf("invalid hash %q", s)
+		}
+		hashes = append(hashes, common.BytesToHash(decoded))
+	}
+	return hashes, nil
+}
+
+// parseAddresses parses an address or a list of addresses parameter, a missing parameter is an empty list
+func parseAddresses(value interface{}) ([]common.Address, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		list = []interface{}{value}
+	}
+	addresses := make([]common.Address, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok || !common.IsHexAddress(s) {
+			return nil, fmt.Errorf("invalid address %v", item)
+		}
+		addresses = append(addresses, common.HexToAddress(s))
+	}
+	return addresses, nil
+}
+
+// codeHashParams are the parsed parameters of the codehash check
+type codeHashParams struct {
+	codeHashes               []common.Hash
+	implementations          []common.Address
+	implementationCodeHashes []common.Hash
+}
+
+// parseCodeHashParams parses the allowed `codehashes`, `implementations` and `implementation_codehashes` of the codehash check
+func parseCodeHashParams(params map[string]interface{}) (codeHashParams, error) {
+	var parsed codeHashParams
+	var err error
+	if parsed.codeHashes, err = parseHashes(params["codehashes"]); err != nil {
+		return parsed, fmt.Errorf("codehashes parameter is invalid: %w", err)
+	}
+	if parsed.implementations, err = parseAddresses(params["implementations"]); err != nil {
+		return parsed, fmt.Errorf("implementations parameter is invalid: %w", err)
+	}
+	if parsed.implementationCodeHashes, err = parseHashes(params["implementation_codehashes"]); err != nil {
+		return parsed, fmt.Errorf("implementation_codehashes parameter is invalid: %w", err)
+	}
+	if len(parsed.codeHashes) == 0 && len(parsed.implementations) == 0 && len(parsed.implementationCodeHashes) == 0 {
+		return parsed, fmt.Errorf("codehashes, implementations or implementation_codehashes parameter is required")
+	}
+	return parsed, nil
+}
+
+// allows returns true if the code of the address is allowed: its code hash, or its ERC-1967 implementation (or the code hash of the implementation) is allowed
+func (p codeHashParams) allows(info codeInfo) bool {
+	if info.codeHash == (common.Hash{}) || info.codeHash == types.EmptyCodeHash {
+		return false // no code
+	}
+	if slices.Contains(p.codeHashes, info.codeHash) {
+		return true
+	}
+	if info.implementation == (common.Address{}) {
+		return false
+	}
+	return slices.Contains(p.implementations, info.implementation) || slices.Contains(p.implementationCodeHashes, info.implementationHash)
+}
+
+// CheckCodeHash verifies if the address is a contract with an allowed runtime code hash, or an ERC-1967 proxy with an allowed implementation
+func CheckCodeHash(ctx context.Context, client *ethclient.Client, addr common.Address, params map[string]interface{}) (bool, error) {
+	parsed, err := parseCodeHashParams(params)
+	if err != nil {
+		return false, err
+	}
+	info, err := fetchCodeInfo(ctx, client, addr, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	return parsed.allows(info), nil
+}
+
+// functionSignatureRegex matches a function signature like "transfer(address to, uint256 amount)"
+var functionSignatureRegex = regexp.MustCompile(`^\s*([A-Za-z_$][A-Za-z0-9_$]*)\s*\((.*)\)\s*$`)
+
+// parseFunctionSignature parses a function signature with optional parameter names, the tuples are not supported
+func parseFunctionSignature(signature string) (abi.Method, error) {
+	matches := functionSignatureRegex.FindStringSubmatch(signature)
+	if len(matches) != 3 {
+		return abi.Method{}, fmt.Errorf("invalid function signature %q", signature)
+	}
+	inputs := abi.Arguments{}
+	if strings.TrimSpace(matches[2]) != "" {
+		for i, param := range strings.Split(matches[2], ",") {
+			parts := strings.Fields(param)
+			if len(parts) == 0 || len(parts) > 2 {
+				return abi.Method{}, fmt.Errorf("invalid parameter %d %q in function signature %q", i, param, signature)
+			}
+			typ, err := abi.NewType(parts[0], "", nil)
+			if err != nil {
+				return abi.Method{}, fmt.Errorf("invalid type of parameter %d in function signature %q: %w", i, signature, err)
+			}
+			argument := abi.Argument{Type: typ}
+			if len(parts) == 2 {
+				argument.Name = parts[1]
+			}
+			inputs = append(inputs, argument)
+		}
+	}
+	return abi.NewMethod(matches[1], matches[1], abi.Function, "", false, false, inputs, nil), nil
+}
+
+// selectorParams are the parsed parameters of the selector check
+type selectorParams struct {
+	selector []byte
+	method   *abi.Method      // nil if the check is given a raw selector
+	args     map[int][]string // the allowed values (canonical) by argument index
+}
+
+// parseSelectorParams parses the `signature` (or the raw `selector`) and the allowed `args` of the selector check
+func parseSelectorParams(params map[string]interface{}) (selectorParams, error) {
+	var parsed selectorParams
+	signature, hasSignature := params["signature"].(string)
+	selector, hasSelector := params["selector"].(string)
+	switch {
+	case hasSignature && !hasSelector:
+		method, err := parseFunctionSignature(signature)
+		if err != nil {
+			return parsed, err
+		}
+		parsed.method = &method
+		parsed.selector = method.ID
+	case hasSelector && !hasSignature:
+		decoded, err := hexutil.Decode(selector)
+		if err != nil || len(decoded) != 4 {
+			return parsed, fmt.Errorf("invalid selector %q, expected 4 bytes", selector)
+		}
+		parsed.selector = decoded
+	default:
+		return parsed, fmt.Errorf("either signature or selector parameter is required")
+	}
+
+	args, ok := params["args"]
+	if !ok {
+		return parsed, nil
+	}
+	argsMap, ok := args.(map[string]interface{})
+	if !ok {
+		return parsed, fmt.Errorf("args parameter is invalid")
+	}
+	if parsed.method == nil {
+		return parsed, fmt.Errorf("args parameter requires a signature")
+	}
+	parsed.args = make(map[int][]string)
+	for name, values := range argsMap {
+		index := -1
+		for i, input := range parsed.method.Inputs {
+			if input.Name == name {
+				index = i
+			}
+		}
+		if index < 0 {
+			return parsed, fmt.Errorf("unknown argument %q in signature %q", name, signature)
+		}
+		list, ok := values.([]interface{})
+		if !ok {
+			list = []interface{}{values}
+		}
+		for _, value := range list {
+			canonical, err := canonicalArgValue(parsed.method.Inputs[index].Type, fmt.Sprint(value))
+			if err != nil {
+				return parsed, fmt.Errorf("invalid value of argument %q: %w", name, err)
+			}
+			parsed.args[index] = append(parsed.args[index], canonical)
+		}
+	}
+	return parsed, nil
+}
+
+// canonicalArgValue formats an allowed value of an argument like the decoded values are formatted by formatArgValue
+func canonicalArgValue(typ abi.Type, value string) (string, error) {
+	switch typ.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(value) {
+			return "", fmt.Errorf("invalid address %q", value)
+		}
+		return common.HexToAddress(value).Hex(), nil
+	case abi.IntTy, abi.UintTy:
+		n, ok := new(big.Int).SetString(value, 0)
+		if !ok {
+			return "", fmt.Errorf("invalid integer %q", value)
+		}
+		return n.String(), nil
+	case abi.BytesTy, abi.FixedBytesTy:
+		decoded, err := hexutil.Decode(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid bytes %q: %w", value, err)
+		}
+		return hexutil.Encode(decoded), nil
+	case abi.BoolTy, abi.StringTy:
+		return value, nil
+	}
+	return "", fmt.Errorf("the arguments of type %s can't be checked", typ)
+}
+
+// formatArgValue formats a decoded argument to compare it with the allowed values
+func formatArgValue(value interface{}) string {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	}
+	// The fixed bytes are decoded as byte arrays of their size.
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+		data := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(data), v)
+		return hexutil.Encode(data)
+	}
+	return fmt.Sprint(value)
+}
+
+// CheckSelector verifies if the transaction calls the function of the `signature` (or the `selector`), with the `args` among their allowed values
+func CheckSelector(ctx context.Context, client *ethclient.Client, tx *types.Transaction, params map[string]interface{}) (bool, error) {
+	parsed, err := parseSelectorParams(params)
+	if err != nil {
+		return false, err
+	}
+	return parsed.matches(tx), nil
+}
+
+// matches returns true if the transaction calls the function of the selector with the arguments among their allowed values
+func (p selectorParams) matches(tx *types.Transaction) bool {
+	data := tx.Data()
+	if len(data) < 4 || !bytes.Equal(data[:4], p.selector) {
+		return false
+	}
+	if len(p.args) == 0 {
+		return true
+	}
+	values, err := p.method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return false // calldata that can't be decoded is not an allowed call
+	}
+	for index, allowed := range p.args {
+		found := false
+		for _, value := range allowed {
+			if strings.EqualFold(formatArgValue(values[index]), value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 // ParamValidationFunc is a type for parameter validation functions
 type ParamValidationFunc func(params map[string]interface{}) error
 
@@ -84,6 +570,8 @@ type ParamValidationFunc func(params map[string]interface{}) error
 var ParamValidations = map[CheckType]ParamValidationFunc{
 	ExactMatchCheck:  ValidateCheckExactMatch,
 	DisputeGameCheck: ValidateCheckDisputeGame,
+	SelectorCheck:    ValidateCheckSelector,
+	CodeHashCheck:    ValidateCheckCodeHash,
 }
 
 // ValidateCheckExactMatch validates the parameters for the exact match check
@@ -103,3 +591,15 @@ func ValidateCheckDisputeGame(params map[string]interface{}) error {
 	}
 	return nil
 }
+
+// ValidateCheckSelector validates the parameters for the selector check
+func ValidateCheckSelector(params map[string]interface{}) error {
+	_, err := parseSelectorParams(params)
+	return err
+}
+
+// ValidateCheckCodeHash validates the parameters for the codehash check
+func ValidateCheckCodeHash(params map[string]interface{}) error {
+	_, err := parseCodeHashParams(params)
+	return err
+}
@@ -15,6 +15,7 @@ const (
 	ConfigFileFlagName      = "config.file"
 	StartBlockFlagName      = "start.block"
 	PollingIntervalFlagName = "poll.interval"
+	TraceInternalFlagName   = "trace.internal"
 )
 
 type CLIConfig struct {
@@ -22,6 +23,7 @@ type CLIConfig struct {
 	StartBlock      uint64        `yaml:"start_block"`
 	PollingInterval time.Duration `yaml:"poll_interval"`
 	WatchConfigs    []WatchConfig `yaml:"watch_configs"`
+	TraceInternal   bool          `yaml:"trace_internal"`
 }
 
 func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
@@ -29,6 +31,7 @@ func ReadCLIFlags(ctx *cli.Context) (CLIConfig, error) {
 		NodeUrl:         ctx.String(NodeURLFlagName),
 		StartBlock:      ctx.Uint64(StartBlockFlagName),
 		PollingInterval: ctx.Duration(PollingIntervalFlagName),
+		TraceInternal:   ctx.Bool(TraceInternalFlagName),
 	}
 
 	configFile := ctx.String(ConfigFileFlagName)
@@ -78,5 +81,10 @@ func CLIFlags(envPrefix string) []cli.Flag {
 			Value:   12 * time.Second,
 			EnvVars: opservice.PrefixEnvVar(envPrefix, "POLL_INTERVAL"),
 		},
+		&cli.BoolFlag{
+			Name:    TraceInternalFlagName,
+			Usage:   "Trace each block (debug_traceBlockByHash with the callTracer) to also check the value moved by the watched addresses through internal calls",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "TRACE_INTERNAL"),
+		},
 	}
 }
@@ -0,0 +1,44 @@
+package transaction_monitor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// inboundResult is a transaction sent to an inbound watched address with the result of its checks
+type inboundResult struct {
+	to      common.Address
+	allowed bool
+}
+
+// checkInbound runs the filters of the inbound watch config of the recipient of the transaction against its sender, it returns nil if the recipient isn't watched.
+// The selector checks see the transaction as is, so an allowlist can be restricted to some functions.
+func (m *Monitor) checkInbound(ctx context.Context, block *types.Block, tx *types.Transaction, from common.Address) (*inboundResult, error) {
+	if tx.To() == nil {
+		return nil, nil
+	}
+	config, ok := m.inbound[*tx.To()]
+	if !ok {
+		return nil, nil
+	}
+	allowed, err := m.passesFilters(ctx, block, config.Filters, tx, from)
+	if err != nil {
+		return nil, fmt.Errorf("error checking inbound sender: %w", err)
+	}
+	return &inboundResult{to: config.Address, allowed: allowed}, nil
+}
+
+// recordInbound updates the metrics of an inbound transaction and flags an unauthorized sender
+func (m *Monitor) recordInbound(block *types.Block, tx *types.Transaction, from common.Address, result *inboundResult) {
+	if result == nil {
+		return
+	}
+	m.metrics.inboundTx.WithLabelValues(result.to.String()).Inc()
+	if !result.allowed {
+		m.log.Warn("unauthorized sender to watched contract", "from", from, "to", result.to, "tx", tx.Hash(), "block", block.Number())
+		m.metrics.unauthorizedInbound.WithLabelValues(result.to.String()).Inc()
+	}
+}
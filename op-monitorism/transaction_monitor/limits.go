@@ -0,0 +1,291 @@
+package transaction_monitor
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// LimitType represents the type of limit enforced on the transactions of a watched address
+type LimitType string
+
+const (
+	// MaxValueLimit flags a transaction sending more than `max` wei
+	MaxValueLimit LimitType = "max_value"
+	// MaxGasPriceLimit flags a transaction paying a gas price above `max` wei
+	MaxGasPriceLimit LimitType = "max_gas_price"
+	// MaxPriorityFeeLimit flags a transaction paying a priority fee (tip) above `max` wei
+	MaxPriorityFeeLimit LimitType = "max_priority_fee"
+	// SpendBudgetLimit flags a transaction bringing the ETH spent (value and fees) over the last `window` above `max` wei
+	SpendBudgetLimit LimitType = "spend_budget"
+	// MaxBlobsLimit flags a transaction carrying more than `max` blobs
+	MaxBlobsLimit LimitType = "max_blobs"
+	// MaxBlobFeeLimit flags a transaction paying a blob fee above `max` wei
+	MaxBlobFeeLimit LimitType = "max_blob_fee"
+	// DelegationLimit flags an EIP-7702 authorization signed by the watched address, unless it delegates to one of the `allowed` addresses
+	DelegationLimit LimitType = "delegation"
+)
+
+// LimitConfig represents a single limit configuration
+type LimitConfig struct {
+	Type   LimitType              `yaml:"type"`
+	Params map[string]interface{} `yaml:"params"`
+}
+
+// LimitValidations maps limit types to their parameter validation functions
+var LimitValidations = map[LimitType]ParamValidationFunc{
+	MaxValueLimit:       ValidateMaxLimit,
+	MaxGasPriceLimit:    ValidateMaxLimit,
+	MaxPriorityFeeLimit: ValidateMaxLimit,
+	SpendBudgetLimit:    ValidateSpendBudgetLimit,
+	MaxBlobsLimit:       ValidateMaxLimit,
+	MaxBlobFeeLimit:     ValidateMaxLimit,
+	DelegationLimit:     ValidateDelegationLimit,
+}
+
+// ValidateMaxLimit validates the parameters of the limits with a `max` amount
+func ValidateMaxLimit(params map[string]interface{}) error {
+	_, err := parseAmount(params["max"])
+	if err != nil {
+		return fmt.Errorf("max parameter not found or invalid: %w", err)
+	}
+	return nil
+}
+
+// ValidateSpendBudgetLimit validates the parameters of the spend budget limit
+func ValidateSpendBudgetLimit(params map[string]interface{}) error {
+	if err := ValidateMaxLimit(params); err != nil {
+		return err
+	}
+	if _, err := parseWindow(params["window"]); err != nil {
+		return fmt.Errorf("window parameter not found or invalid: %w", err)
+	}
+	return nil
+}
+
+// ValidateDelegationLimit validates the parameters of the delegation limit
+func ValidateDelegationLimit(params map[string]interface{}) error {
+	if _, err := parseAddresses(params["allowed"]); err != nil {
+		return fmt.Errorf("allowed parameter is invalid: %w", err)
+	}
+	return nil
+}
+
+// amountUnits are the units of the amounts, `gwei` is checked before `wei`
+var amountUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"gwei", params.GWei},
+	{"ether", params.Ether},
+	{"wei", params.Wei},
+}
+
+// parseAmount parses an amount in wei, given as an integer or as a string with an optional `wei`, `gwei` or `ether` unit (e.g. "50gwei", "1.5ether").
+// The YAML decoder gives the integers above the int64 range as uint64 and the ones in exponent notation (e.g. 1e18) as float64, they have to be whole amounts of wei.
+func parseAmount(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return nil, fmt.Errorf("negative amount %d", v)
+		}
+		return big.NewInt(int64(v)), nil
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 || v != math.Trunc(v) {
+			return nil, fmt.Errorf("invalid amount %v, quote it with a unit for a fractional amount (e.g. \"1.5gwei\")", v)
+		}
+		wei, _ := big.NewFloat(v).Int(nil)
+		return wei, nil
+	case string:
+		s := strings.TrimSpace(v)
+		unit := big.NewFloat(params.Wei)
+		for _, u := range amountUnits {
+			if strings.HasSuffix(s, u.suffix) {
+				s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+				unit = big.NewFloat(u.multiplier)
+				break
+			}
+		}
+		amount, ok := new(big.Float).SetPrec(256).SetString(s)
+		if !ok || amount.Sign() < 0 {
+			return nil, fmt.Errorf("invalid amount %q", v)
+		}
+		wei, _ := amount.Mul(amount, unit).Int(nil)
+		return wei, nil
+	}
+	return nil, fmt.Errorf("invalid amount %v", value)
+}
+
+// parseWindow parses a window duration like "24h"
+func parseWindow(value interface{}) (time.Duration, error) {
+	s, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid window %v", value)
+	}
+	window, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if window < time.Second {
+		return 0, fmt.Errorf("the window %s has to be at least 1s", window)
+	}
+	return window, nil
+}
+
+// spend is the ETH spent by a transaction at a block timestamp
+type spend struct {
+	timestamp uint64
+	amount    *big.Int
+}
+
+// limit is a validated limit of a watched address, with the spends within its window for the spend budget
+type limit struct {
+	kind    LimitType
+	max     *big.Int
+	window  time.Duration
+	spends  []spend
+	allowed []common.Address // the allowed delegations
+}
+
+// newLimit builds a limit from its configuration, the parameters must be validated first
+func newLimit(config LimitConfig) *limit {
+	l := &limit{kind: config.Type}
+	switch config.Type {
+	case DelegationLimit:
+		l.allowed, _ = parseAddresses(config.Params["allowed"])
+	case SpendBudgetLimit:
+		l.window, _ = parseWindow(config.Params["window"])
+		fallthrough
+	default:
+		l.max, _ = parseAmount(config.Params["max"])
+	}
+	return l
+}
+
+// TxCost is what a transaction of a watched address costs
+type TxCost struct {
+	Value       *big.Int // the value of the transaction
+	GasPrice    *big.Int // the effective gas price
+	PriorityFee *big.Int // the effective priority fee (tip)
+	Fee         *big.Int // the fees paid (gas used times the effective gas price, plus the L1 fee on L2 and the blob fee), nil if unknown
+	Blobs       *big.Int // the number of blobs
+	BlobFee     *big.Int // the blob fee paid, nil if unknown
+	Reverted    bool     // the value was not transferred, only the fees were paid
+}
+
+// Spent returns the ETH spent by the transaction: its value (unless it reverted) and its fees
+func (c TxCost) Spent() *big.Int {
+	spent := new(big.Int)
+	if !c.Reverted {
+		spent.Set(c.Value)
+	}
+	if c.Fee != nil {
+		spent.Add(spent, c.Fee)
+	}
+	return spent
+}
+
+// txCost returns the cost of a transaction included in a block with the base fee `baseFee`, the receipt is optional
+func txCost(tx *types.Transaction, baseFee *big.Int, receipt *types.Receipt) TxCost {
+	cost := TxCost{Value: tx.Value(), Blobs: big.NewInt(int64(len(tx.BlobHashes())))}
+	if receipt != nil {
+		cost.Reverted = receipt.Status != types.ReceiptStatusSuccessful
+	}
+	if tx.IsDepositTx() {
+		// The gas of the deposits is bought on L1, they don't pay any fee on L2.
+		cost.GasPrice, cost.PriorityFee, cost.Fee, cost.BlobFee = new(big.Int), new(big.Int), new(big.Int), new(big.Int)
+		return cost
+	}
+
+	cost.PriorityFee = tx.EffectiveGasTipValue(baseFee)
+	cost.GasPrice = new(big.Int).Set(cost.PriorityFee)
+	if baseFee != nil {
+		cost.GasPrice.Add(cost.GasPrice, baseFee)
+	}
+	if receipt != nil {
+		if receipt.EffectiveGasPrice != nil {
+			cost.GasPrice = receipt.EffectiveGasPrice
+		}
+		cost.Fee = new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), cost.GasPrice)
+		if receipt.L1Fee != nil {
+			cost.Fee.Add(cost.Fee, receipt.L1Fee)
+		}
+		cost.BlobFee = new(big.Int)
+		if receipt.BlobGasPrice != nil {
+			cost.BlobFee.Mul(new(big.Int).SetUint64(receipt.BlobGasUsed), receipt.BlobGasPrice)
+		}
+		cost.Fee.Add(cost.Fee, cost.BlobFee)
+	}
+	return cost
+}
+
+// check records the cost of a transaction at the block timestamp `timestamp` and returns the amount observed by the limit and whether it is above the limit
+func (l *limit) check(cost TxCost, timestamp uint64) (*big.Int, bool) {
+	var observed *big.Int
+	switch l.kind {
+	case MaxValueLimit:
+		observed = cost.Value
+	case MaxGasPriceLimit:
+		observed = cost.GasPrice
+	case MaxPriorityFeeLimit:
+		observed = cost.PriorityFee
+	case SpendBudgetLimit:
+		observed = l.record(cost.Spent(), timestamp)
+	case MaxBlobsLimit:
+		observed = cost.Blobs
+	case MaxBlobFeeLimit:
+		observed = cost.BlobFee
+	}
+	if observed == nil {
+		return nil, false
+	}
+	return observed, observed.Cmp(l.max) > 0
+}
+
+// record adds a spend to the window ending at `timestamp` and returns the total spent within the window
+func (l *limit) record(amount *big.Int, timestamp uint64) *big.Int {
+	window := uint64(l.window / time.Second)
+	kept := l.spends[:0]
+	for _, s := range l.spends {
+		if s.timestamp+window > timestamp {
+			kept = append(kept, s)
+		}
+	}
+	l.spends = append(kept, spend{timestamp: timestamp, amount: amount})
+
+	total := new(big.Int)
+	for _, s := range l.spends {
+		total.Add(total, s.amount)
+	}
+	return total
+}
+
+// allowsDelegation returns true if an authorization delegating to `target` is allowed by the delegation limit
+func (l *limit) allowsDelegation(target common.Address) bool {
+	return slices.Contains(l.allowed, target)
+}
+
+// needsReceipt returns true if one of the limits needs the fees paid by the transaction
+func needsReceipt(limits []*limit) bool {
+	for _, l := range limits {
+		if l.kind == SpendBudgetLimit || l.kind == MaxBlobFeeLimit {
+			return true
+		}
+	}
+	return false
+}
+
+// weiToEther converts an amount in wei to a float in ether for the metrics
+func weiToEther(wei *big.Int) float64 {
+	ether, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(params.Ether)).Float64()
+	return ether
+}
@@ -27,30 +27,68 @@ const (
 	ExactMatchCheck CheckType = "exact_match"
 	// DisputeGameCheck verifies if an address is a valid dispute game created by the factory
 	DisputeGameCheck CheckType = "dispute_game"
+	// SelectorCheck verifies if the transaction calls a function, optionally with allowed arguments
+	SelectorCheck CheckType = "selector"
+	// CodeHashCheck verifies if an address has an allowed runtime code, or is an ERC-1967 proxy of an allowed implementation
+	CodeHashCheck CheckType = "codehash"
 )
 
-// CheckConfig represents a single check configuration
+// CheckConfig represents a single check configuration, or a group of checks with `all` (AND) or `any` (OR)
 type CheckConfig struct {
-	Type   CheckType              `yaml:"type"`
-	Params map[string]interface{} `yaml:"params"`
+	Type   CheckType              `yaml:"type,omitempty"`
+	Params map[string]interface{} `yaml:"params,omitempty"`
+	All    []CheckConfig          `yaml:"all,omitempty"`
+	Any    []CheckConfig          `yaml:"any,omitempty"`
+
+	selector *selectorParams // the parsed parameters of a selector check, set when the monitor is created
+	codeHash *codeHashParams // the parsed parameters of a codehash check, set when the monitor is created
 }
 
+// Direction is the side of the transactions a watch config matches on
+type Direction string
+
+const (
+	// OutboundDirection watches the transactions sent by the address, the filters check their recipient
+	OutboundDirection Direction = "outbound"
+	// InboundDirection watches the transactions sent to the address (a contract), the filters check their sender
+	InboundDirection Direction = "inbound"
+)
+
 // WatchConfig represents the configuration for watching a specific address
 type WatchConfig struct {
-	Address common.Address `yaml:"address"`
-	Filters []CheckConfig  `yaml:"filters"`
+	Address   common.Address `yaml:"address"`
+	Direction Direction      `yaml:"direction,omitempty"` // outbound by default
+	Filters   []CheckConfig  `yaml:"filters"`
+	Limits    []LimitConfig  `yaml:"limits,omitempty"`
+	Nonce     *NonceConfig   `yaml:"nonce,omitempty"`
 }
 
 type Metrics struct {
-	transactions   *prometheus.CounterVec
-	unauthorizedTx *prometheus.CounterVec
-	ethSpent       *prometheus.CounterVec
+	transactions        *prometheus.CounterVec
+	unauthorizedTx      *prometheus.CounterVec
+	ethSpent            *prometheus.CounterVec
+	violations          *prometheus.CounterVec
+	windowSpent         *prometheus.GaugeVec
+	senderErrors        prometheus.Counter
+	internalCalls       *prometheus.CounterVec
+	confirmedNonce      *prometheus.GaugeVec
+	pendingNonce        *prometheus.GaugeVec
+	pendingBlocks       *prometheus.GaugeVec
+	nonceGap            *prometheus.GaugeVec
+	inboundTx           *prometheus.CounterVec
+	unauthorizedInbound *prometheus.CounterVec
 }
 
 type Monitor struct {
 	log          log.Logger
 	client       *ethclient.Client
+	signer       types.Signer
+	chainID      *big.Int
 	watchConfigs map[common.Address]WatchConfig
+	inbound      map[common.Address]WatchConfig
+	limits       map[common.Address][]*limit
+	nonces       map[common.Address]*nonceState
+	codes        *codeCache
 	processor    *processor.BlockProcessor
 	metrics      Metrics
 }
@@ -60,11 +98,21 @@ func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIC
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial node: %w", err)
 	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain id: %w", err)
+	}
 
 	mon := &Monitor{
 		log:          log,
 		client:       client,
+		signer:       types.LatestSignerForChainID(chainID),
+		chainID:      chainID,
 		watchConfigs: make(map[common.Address]WatchConfig),
+		inbound:      make(map[common.Address]WatchConfig),
+		limits:       make(map[common.Address][]*limit),
+		nonces:       make(map[common.Address]*nonceState),
+		codes:        newCodeCache(),
 		metrics: Metrics{
 			transactions: m.NewCounterVec(
 				prometheus.CounterOpts{
@@ -90,32 +138,142 @@ func NewMonitor(ctx context.Context, log log.Logger, m metrics.Factory, cfg CLIC
 				},
 				[]string{"address"},
 			),
+			violations: m.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "violations_total",
+					Help:      "Number of transactions above a limit of the sender, by limit type",
+				},
+				[]string{"from", "reason"},
+			),
+			windowSpent: m.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Namespace: MetricsNamespace,
+					Name:      "window_spent_eth",
+					Help:      "ETH spent (value and fees) by address over the window of its spend budget",
+				},
+				[]string{"from", "window"},
+			),
+			internalCalls: m.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "internal_calls_total",
+					Help:      "Number of internal calls moving value from a watched address",
+				},
+				[]string{"from"},
+			),
+			confirmedNonce: m.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Namespace: MetricsNamespace,
+					Name:      "confirmed_nonce",
+					Help:      "Nonce of the address at the last block processed",
+				},
+				[]string{"address"},
+			),
+			pendingNonce: m.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Namespace: MetricsNamespace,
+					Name:      "pending_nonce",
+					Help:      "Pending nonce of the address (including its transactions in the txpool)",
+				},
+				[]string{"address"},
+			),
+			pendingBlocks: m.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Namespace: MetricsNamespace,
+					Name:      "pending_blocks",
+					Help:      "Number of blocks since the oldest transaction of the address is pending",
+				},
+				[]string{"address"},
+			),
+			nonceGap: m.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Namespace: MetricsNamespace,
+					Name:      "nonce_gap",
+					Help:      "Number of missing nonces below the queued transactions of the address",
+				},
+				[]string{"address"},
+			),
+			inboundTx: m.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "inbound_transactions_total",
+					Help:      "Total number of transactions sent to an inbound watched address",
+				},
+				[]string{"to"},
+			),
+			unauthorizedInbound: m.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "unauthorized_inbound_transactions_total",
+					Help:      "Number of transactions sent to an inbound watched address by unauthorized senders",
+				},
+				[]string{"to"},
+			),
+			senderErrors: m.NewCounter(
+				prometheus.CounterOpts{
+					Namespace: MetricsNamespace,
+					Name:      "sender_recovery_errors_total",
+					Help:      "Number of transactions skipped because their sender couldn't be recovered",
+				},
+			),
 		},
 	}
 
 	// Initialize and validate watchConfigs
 	for _, config := range cfg.WatchConfigs {
-		for _, filter := range config.Filters {
-			err := ParamValidations[filter.Type](filter.Params)
-			if err != nil {
-				return nil, fmt.Errorf("invalid parameters for check type %s: %w", filter.Type, err)
+		for i := range config.Filters {
+			if err := config.Filters[i].compile(); err != nil {
+				return nil, err
+			}
+		}
+		switch config.Direction {
+		case "", OutboundDirection:
+		case InboundDirection:
+			// The limits and the nonce are the ones of a sender, they don't apply to the transactions received.
+			if len(config.Limits) > 0 || config.Nonce != nil {
+				return nil, fmt.Errorf("the inbound watch config of %s can't have limits or a nonce", config.Address)
+			}
+			if _, exists := mon.inbound[config.Address]; exists {
+				return nil, fmt.Errorf("duplicate inbound watch config for %s", config.Address)
 			}
+			mon.inbound[config.Address] = config
+			continue
+		default:
+			return nil, fmt.Errorf("unknown direction %s for %s", config.Direction, config.Address)
+		}
+		for _, limitConfig := range config.Limits {
+			validate, ok := LimitValidations[limitConfig.Type]
+			if !ok {
+				return nil, fmt.Errorf("unknown limit type: %s", limitConfig.Type)
+			}
+			if err := validate(limitConfig.Params); err != nil {
+				return nil, fmt.Errorf("invalid parameters for limit type %s: %w", limitConfig.Type, err)
+			}
+			mon.limits[config.Address] = append(mon.limits[config.Address], newLimit(limitConfig))
 		}
 		mon.watchConfigs[config.Address] = config
 	}
 
+	// The blocks are only traced if the internal calls are monitored.
+	var blockProcessFunc processor.BlockProcessingFunc
+	if cfg.TraceInternal {
+		blockProcessFunc = mon.processBlockTrace
+	}
+
 	// Create the block processor
 	proc, err := processor.NewBlockProcessor(
 		m,
 		log,
 		cfg.NodeUrl,
 		mon.processTx,
-		nil,
+		blockProcessFunc,
 		nil,
 		&processor.Config{
-			StartBlock: big.NewInt(int64(cfg.StartBlock)),
-			Interval:   cfg.PollingInterval,
-			UseLatest:  true,
+			StartBlock:       processor.StartCursor(cfg.StartBlock),
+			Interval:         cfg.PollingInterval,
+			UseLatest:        true,
+			OnBlockProcessed: mon.checkNonces,
 		},
 	)
 	if err != nil {
@@ -137,13 +295,33 @@ func (m *Monitor) Run(ctx context.Context) {
 	}
 }
 
-func (m *Monitor) processTx(block *types.Block, tx *types.Transaction, client *ethclient.Client) error {
+func (m *Monitor) processTx(block *types.Block, tx *types.Transaction, client *ethclient.Client) (err error) {
 	ctx := context.Background()
 
+	// The authorizations, the nonces and the inbound transactions are recorded once the transaction is processed, as it is retried on error.
+	var from common.Address
+	var inbound *inboundResult
+	defer func() {
+		if err == nil {
+			m.checkDelegations(block, tx)
+			m.countNonces(tx, from)
+			m.recordInbound(block, tx, from, inbound)
+		}
+	}()
+
 	// Grab the sender of the transaction.
-	from, err := types.Sender(types.NewLondonSigner(tx.ChainId()), tx)
+	from, err = m.sender(tx)
 	if err != nil {
-		return fmt.Errorf("failed to find tx sender: %w", err)
+		// Retrying would fail again, the transaction is skipped.
+		m.log.Warn("failed to find tx sender", "tx", tx.Hash(), "type", tx.Type(), "block", block.Number(), "err", err)
+		m.metrics.senderErrors.Inc()
+		return nil
+	}
+
+	// Check the sender of the transactions to the inbound watched addresses, whether they revert or not.
+	inbound, err = m.checkInbound(ctx, block, tx, from)
+	if err != nil {
+		return err
 	}
 
 	// Return if we're not watching this address.
@@ -151,20 +329,26 @@ func (m *Monitor) processTx(block *types.Block, tx *types.Transaction, client *e
 		return nil
 	}
 
+	// The receipt is needed for the created address and for the fees paid.
+	limits := m.limits[from]
+	var receipt *types.Receipt
+	if tx.To() == nil || needsReceipt(limits) {
+		receipt, err = client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to get transaction receipt: %w", err)
+		}
+	}
+
 	// If to is nil, use the created address.
 	var to common.Address
 	if tx.To() != nil {
 		to = *tx.To()
 	} else {
-		receipt, err := client.TransactionReceipt(ctx, tx.Hash())
-		if err != nil {
-			return fmt.Errorf("failed to get transaction receipt: %w", err)
-		}
 		to = receipt.ContractAddress
 	}
 
-	// Check if the recipient is authorized.
-	allowed, err := m.isAddressAllowed(ctx, from, to)
+	// Check if the recipient (and the call) is authorized.
+	allowed, err := m.isTxAllowed(ctx, block, from, tx, to)
 	if err != nil {
 		return fmt.Errorf("error checking address: %w", err)
 	}
@@ -178,25 +362,63 @@ func (m *Monitor) processTx(block *types.Block, tx *types.Transaction, client *e
 	if !allowed {
 		m.metrics.unauthorizedTx.WithLabelValues(from.String()).Inc()
 	}
+	m.checkLimits(block, tx.Hash(), from, limits, txCost(tx, block.BaseFee(), receipt))
 
 	return nil
 }
 
-func (m *Monitor) isAddressAllowed(ctx context.Context, from common.Address, addr common.Address) (bool, error) {
+// sender returns the sender of a transaction of any type. The deposits are not signed, their sender is part of the transaction.
+func (m *Monitor) sender(tx *types.Transaction) (common.Address, error) {
+	if tx.IsDepositTx() {
+		// Only the London signer of op-geth returns the sender of the deposits.
+		return types.NewLondonSigner(m.chainID).Sender(tx)
+	}
+	return types.Sender(m.signer, tx)
+}
+
+// checkDelegations flags the EIP-7702 authorizations signed by the watched addresses with a delegation limit, whoever sends the transaction.
+func (m *Monitor) checkDelegations(block *types.Block, tx *types.Transaction) {
+	for _, auth := range tx.SetCodeAuthorizations() {
+		authority, err := auth.Authority()
+		if err != nil {
+			continue // an invalid authorization is skipped by the EVM too.
+		}
+		for _, l := range m.limits[authority] {
+			if l.kind == DelegationLimit && !l.allowsDelegation(auth.Address) {
+				m.log.Warn("delegation signed by watched address", "authority", authority, "delegate", auth.Address, "tx", tx.Hash(), "block", block.Number(), "reason", l.kind)
+				m.metrics.violations.WithLabelValues(authority.String(), string(l.kind)).Inc()
+			}
+		}
+	}
+}
+
+// checkLimits checks the cost of a transaction against the limits of its sender, there is no error so the spends are never recorded twice.
+func (m *Monitor) checkLimits(block *types.Block, txHash common.Hash, from common.Address, limits []*limit, cost TxCost) {
+	for _, l := range limits {
+		observed, violated := l.check(cost, block.Time())
+		if l.kind == SpendBudgetLimit {
+			m.metrics.windowSpent.WithLabelValues(from.String(), l.window.String()).Set(weiToEther(observed))
+		}
+		if violated {
+			m.log.Warn("transaction above limit", "from", from, "tx", txHash, "block", block.Number(), "reason", l.kind, "observed", observed, "max", l.max)
+			m.metrics.violations.WithLabelValues(from.String(), string(l.kind)).Inc()
+		}
+	}
+}
+
+func (m *Monitor) isTxAllowed(ctx context.Context, block *types.Block, from common.Address, tx *types.Transaction, to common.Address) (bool, error) {
 	// Make sure there's a watch config for this address.
 	watchConfig, ok := m.watchConfigs[from]
 	if !ok {
 		return false, fmt.Errorf("no watch config found for address %s", from.String())
 	}
+	return m.passesFilters(ctx, block, watchConfig.Filters, tx, to)
+}
 
-	// Check each filter.
-	for _, filter := range watchConfig.Filters {
-		checkFn, ok := AddressChecks[filter.Type]
-		if !ok {
-			return false, fmt.Errorf("unknown check type: %s", filter.Type)
-		}
-
-		isValid, err := checkFn(ctx, m.client, addr, filter.Params)
+// passesFilters returns true if one of the filters allows the transaction of the block, the address checks are run against `addr` at the block
+func (m *Monitor) passesFilters(ctx context.Context, block *types.Block, filters []CheckConfig, tx *types.Transaction, addr common.Address) (bool, error) {
+	for _, filter := range filters {
+		isValid, err := filter.evaluate(ctx, m.client, m.codes, block.Number(), tx, addr)
 		if err != nil {
 			return false, fmt.Errorf("error running check: %w", err)
 		}
@@ -3,19 +3,25 @@ package transaction_monitor
 import (
 	"context"
 	"crypto/ecdsa"
+	"encoding/json"
+	"math"
 	"math/big"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/ethereum-optimism/optimism/op-service/testutils/devnet"
+	"github.com/holiman/uint256"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
@@ -188,6 +194,523 @@ func TestChecks(t *testing.T) {
 	})
 }
 
+func TestParseAmount(t *testing.T) {
+	for input, expected := range map[interface{}]*big.Int{
+		1000:                   big.NewInt(1000),
+		uint64(math.MaxUint64): new(big.Int).SetUint64(math.MaxUint64),
+		1e18:                   big.NewInt(params.Ether),
+		"1000":                 big.NewInt(1000),
+		"50gwei":               big.NewInt(50 * params.GWei),
+		"1.5 ether":            big.NewInt(1.5 * params.Ether),
+		"1000000wei":           big.NewInt(1000000),
+	} {
+		amount, err := parseAmount(input)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, amount, input)
+	}
+	for _, input := range []interface{}{nil, -1, "-1ether", "ten", 1.5, -1e18, math.Inf(1), math.NaN()} {
+		_, err := parseAmount(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	baseFee := big.NewInt(10 * params.GWei)
+	tx := types.NewTx(&types.DynamicFeeTx{
+		To:        &allowedAddress,
+		Value:     big.NewInt(params.Ether),
+		Gas:       21000,
+		GasTipCap: big.NewInt(2 * params.GWei),
+		GasFeeCap: big.NewInt(100 * params.GWei),
+	})
+
+	cost := txCost(tx, baseFee, nil)
+	require.Equal(t, big.NewInt(12*params.GWei), cost.GasPrice)
+	require.Equal(t, big.NewInt(2*params.GWei), cost.PriorityFee)
+	require.Nil(t, cost.Fee)
+
+	receipt := &types.Receipt{Status: types.ReceiptStatusFailed, GasUsed: 21000, EffectiveGasPrice: big.NewInt(12 * params.GWei), L1Fee: big.NewInt(1000)}
+	cost = txCost(tx, baseFee, receipt)
+	require.Equal(t, big.NewInt(21000*12*params.GWei+1000), cost.Spent(), "only the fees of a reverted transaction are spent")
+
+	newTestLimit := func(kind LimitType, params map[string]interface{}) *limit {
+		require.NoError(t, LimitValidations[kind](params))
+		return newLimit(LimitConfig{Type: kind, Params: params})
+	}
+	_, violated := newTestLimit(MaxValueLimit, map[string]interface{}{"max": "0.5ether"}).check(cost, 0)
+	require.True(t, violated, "the value of a reverted transaction is still checked")
+	_, violated = newTestLimit(MaxGasPriceLimit, map[string]interface{}{"max": "20gwei"}).check(cost, 0)
+	require.False(t, violated)
+	_, violated = newTestLimit(MaxPriorityFeeLimit, map[string]interface{}{"max": "1gwei"}).check(cost, 0)
+	require.True(t, violated)
+
+	budget := newTestLimit(SpendBudgetLimit, map[string]interface{}{"max": "2.5ether", "window": "1h"})
+	spent := TxCost{Value: big.NewInt(params.Ether)}
+	for i, expected := range []bool{false, false, true} {
+		total, violated := budget.check(spent, uint64(i*60))
+		require.Equal(t, expected, violated, i)
+		require.Equal(t, new(big.Int).Mul(big.NewInt(int64(i+1)), big.NewInt(params.Ether)), total)
+	}
+	total, violated := budget.check(spent, 3660)
+	require.False(t, violated, "the first spends are out of the window")
+	require.Equal(t, new(big.Int).Mul(big.NewInt(2), big.NewInt(params.Ether)), total)
+
+	require.Error(t, ValidateSpendBudgetLimit(map[string]interface{}{"max": "1ether"}), "missing window")
+	require.Error(t, ValidateSpendBudgetLimit(map[string]interface{}{"max": "1ether", "window": "1ms"}))
+}
+
+func TestCheckSelector(t *testing.T) {
+	ctx := context.Background()
+	method, err := parseFunctionSignature("transfer(address to, uint256 amount)")
+	require.NoError(t, err)
+	require.Equal(t, "0xa9059cbb", hexutil.Encode(method.ID))
+	calldata, err := method.Inputs.Pack(allowedAddress, big.NewInt(1000))
+	require.NoError(t, err)
+	tx := types.NewTx(&types.DynamicFeeTx{To: &allowedAddress, Data: append(method.ID, calldata...)})
+
+	for name, c := range map[string]struct {
+		params   map[string]interface{}
+		expected bool
+	}{
+		"signature":          {map[string]interface{}{"signature": "transfer(address,uint256)"}, true},
+		"raw selector":       {map[string]interface{}{"selector": "0xa9059cbb"}, true},
+		"other function":     {map[string]interface{}{"signature": "approve(address,uint256)"}, false},
+		"allowed argument":   {map[string]interface{}{"signature": "transfer(address to, uint256 amount)", "args": map[string]interface{}{"to": strings.ToLower(allowedAddress.Hex())}}, true},
+		"any of the values":  {map[string]interface{}{"signature": "transfer(address to, uint256 amount)", "args": map[string]interface{}{"amount": []interface{}{1, "0x3e8"}}}, true},
+		"disallowed value":   {map[string]interface{}{"signature": "transfer(address to, uint256 amount)", "args": map[string]interface{}{"to": unauthorizedAddr.Hex()}}, false},
+		"one arg disallowed": {map[string]interface{}{"signature": "transfer(address to, uint256 amount)", "args": map[string]interface{}{"to": allowedAddress.Hex(), "amount": 1}}, false},
+	} {
+		require.NoError(t, ValidateCheckSelector(c.params), name)
+		ok, err := CheckSelector(ctx, nil, tx, c.params)
+		require.NoError(t, err, name)
+		require.Equal(t, c.expected, ok, name)
+	}
+
+	for name, params := range map[string]map[string]interface{}{
+		"no signature":      {},
+		"both":              {"signature": "transfer(address,uint256)", "selector": "0xa9059cbb"},
+		"short selector":    {"selector": "0xa905"},
+		"unknown argument":  {"signature": "transfer(address to, uint256 amount)", "args": map[string]interface{}{"from": allowedAddress.Hex()}},
+		"invalid value":     {"signature": "transfer(address to, uint256 amount)", "args": map[string]interface{}{"amount": "ten"}},
+		"args and selector": {"selector": "0xa9059cbb", "args": map[string]interface{}{"to": allowedAddress.Hex()}},
+	} {
+		require.Error(t, ValidateCheckSelector(params), name)
+	}
+}
+
+func TestCheckGroups(t *testing.T) {
+	ctx := context.Background()
+	pause := hexutil.MustDecode("0x8456cb59")
+	tx := types.NewTx(&types.DynamicFeeTx{To: &allowedAddress, Data: pause})
+
+	// The watched address may only call pause() on the allowed address, or anything on the factory.
+	filter := CheckConfig{Any: []CheckConfig{
+		{All: []CheckConfig{
+			{Type: ExactMatchCheck, Params: map[string]interface{}{"match": allowedAddress.Hex()}},
+			{Type: SelectorCheck, Params: map[string]interface{}{"signature": "pause()"}},
+		}},
+		{Type: ExactMatchCheck, Params: map[string]interface{}{"match": factoryAddress.Hex()}},
+	}}
+	require.NoError(t, filter.Validate())
+
+	ok, err := filter.Evaluate(ctx, nil, tx, allowedAddress)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = filter.Evaluate(ctx, nil, types.NewTx(&types.DynamicFeeTx{To: &allowedAddress}), allowedAddress)
+	require.NoError(t, err)
+	require.False(t, ok, "a transfer to the allowed address is not allowed")
+	ok, err = filter.Evaluate(ctx, nil, tx, factoryAddress)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// The selector is parsed once when the filter is compiled, not for every transaction.
+	require.NoError(t, filter.compile())
+	selector := &filter.Any[0].All[1]
+	require.NotNil(t, selector.selector)
+	selector.Params = nil
+	ok, err = filter.Evaluate(ctx, nil, tx, allowedAddress)
+	require.NoError(t, err)
+	require.True(t, ok, "the parsed selector is used")
+
+	require.Error(t, CheckConfig{Type: ExactMatchCheck, All: filter.Any}.Validate(), "a group has no type")
+	require.Error(t, CheckConfig{All: filter.Any, Any: filter.Any}.Validate())
+	require.Error(t, CheckConfig{Any: []CheckConfig{{Type: "unknown"}}}.Validate())
+}
+
+func newTestMonitor(t *testing.T, configs ...WatchConfig) *Monitor {
+	chainID := big.NewInt(31337)
+	monitor := &Monitor{
+		log:          log.New(),
+		signer:       types.LatestSignerForChainID(chainID),
+		chainID:      chainID,
+		watchConfigs: make(map[common.Address]WatchConfig),
+		inbound:      make(map[common.Address]WatchConfig),
+		limits:       make(map[common.Address][]*limit),
+		nonces:       make(map[common.Address]*nonceState),
+		metrics: Metrics{
+			transactions:        prometheus.NewCounterVec(prometheus.CounterOpts{Name: "transactions_total"}, []string{"from"}),
+			unauthorizedTx:      prometheus.NewCounterVec(prometheus.CounterOpts{Name: "unauthorized_transactions_total"}, []string{"from"}),
+			ethSpent:            prometheus.NewCounterVec(prometheus.CounterOpts{Name: "eth_spent_total"}, []string{"address"}),
+			violations:          prometheus.NewCounterVec(prometheus.CounterOpts{Name: "violations_total"}, []string{"from", "reason"}),
+			windowSpent:         prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "window_spent_eth"}, []string{"from", "window"}),
+			senderErrors:        prometheus.NewCounter(prometheus.CounterOpts{Name: "sender_recovery_errors_total"}),
+			internalCalls:       prometheus.NewCounterVec(prometheus.CounterOpts{Name: "internal_calls_total"}, []string{"from"}),
+			confirmedNonce:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "confirmed_nonce"}, []string{"address"}),
+			pendingNonce:        prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pending_nonce"}, []string{"address"}),
+			pendingBlocks:       prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pending_blocks"}, []string{"address"}),
+			nonceGap:            prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "nonce_gap"}, []string{"address"}),
+			inboundTx:           prometheus.NewCounterVec(prometheus.CounterOpts{Name: "inbound_transactions_total"}, []string{"to"}),
+			unauthorizedInbound: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "unauthorized_inbound_transactions_total"}, []string{"to"}),
+		},
+	}
+	for _, config := range configs {
+		if config.Direction == InboundDirection {
+			monitor.inbound[config.Address] = config
+			continue
+		}
+		for _, limitConfig := range config.Limits {
+			require.NoError(t, LimitValidations[limitConfig.Type](limitConfig.Params))
+			monitor.limits[config.Address] = append(monitor.limits[config.Address], newLimit(limitConfig))
+		}
+		monitor.watchConfigs[config.Address] = config
+	}
+	return monitor
+}
+
+func TestSender(t *testing.T) {
+	monitor := newTestMonitor(t)
+	chainID := uint256.MustFromBig(monitor.chainID)
+
+	blobTx, err := types.SignNewTx(watchedKey, monitor.signer, &types.BlobTx{
+		ChainID:    chainID,
+		GasTipCap:  uint256.NewInt(1),
+		GasFeeCap:  uint256.NewInt(1),
+		BlobFeeCap: uint256.NewInt(1),
+		Value:      uint256.NewInt(0),
+		BlobHashes: []common.Hash{{0x01}, {0x01}},
+	})
+	require.NoError(t, err)
+	setCodeTx, err := types.SignNewTx(watchedKey, monitor.signer, &types.SetCodeTx{
+		ChainID:   chainID,
+		GasTipCap: uint256.NewInt(1),
+		GasFeeCap: uint256.NewInt(1),
+		Value:     uint256.NewInt(0),
+		AuthList:  []types.SetCodeAuthorization{{ChainID: *chainID}},
+	})
+	require.NoError(t, err)
+	deposit := types.NewTx(&types.DepositTx{From: allowedAddress, To: &watchedAddress, Value: big.NewInt(1), Mint: big.NewInt(1)})
+
+	for name, c := range map[string]struct {
+		tx       *types.Transaction
+		expected common.Address
+	}{
+		"blob":     {blobTx, watchedAddress},
+		"set code": {setCodeTx, watchedAddress},
+		"deposit":  {deposit, allowedAddress},
+	} {
+		from, err := monitor.sender(c.tx)
+		require.NoError(t, err, name)
+		require.Equal(t, c.expected, from, name)
+	}
+
+	cost := txCost(blobTx, big.NewInt(1), &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: 21000, EffectiveGasPrice: big.NewInt(2), BlobGasUsed: 2 * params.BlobTxBlobGasPerBlob, BlobGasPrice: big.NewInt(3)})
+	require.Equal(t, big.NewInt(2), cost.Blobs)
+	require.Equal(t, big.NewInt(2*params.BlobTxBlobGasPerBlob*3), cost.BlobFee)
+	require.Equal(t, big.NewInt(21000*2+2*params.BlobTxBlobGasPerBlob*3), cost.Fee, "the blob fee is part of the fees")
+	cost = txCost(deposit, big.NewInt(1), nil)
+	require.Equal(t, int64(0), cost.GasPrice.Int64(), "the deposits don't pay fees on L2")
+	require.Equal(t, big.NewInt(1), cost.Spent())
+}
+
+func TestDelegations(t *testing.T) {
+	delegate := common.HexToAddress("0x63c0c19a282a1B52b07dD5a65b58948A07DAE32B")
+	monitor := newTestMonitor(t,
+		WatchConfig{Address: watchedAddress, Limits: []LimitConfig{{Type: DelegationLimit, Params: map[string]interface{}{"allowed": delegate.Hex()}}}},
+	)
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	chainID := uint256.MustFromBig(monitor.chainID)
+	sign := func(target common.Address) types.SetCodeAuthorization {
+		auth, err := types.SignSetCode(watchedKey, types.SetCodeAuthorization{ChainID: *chainID, Address: target})
+		require.NoError(t, err)
+		return auth
+	}
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	// The authorizations of the watched address are flagged even in a transaction sent by another address.
+	tx, err := types.SignNewTx(otherKey, monitor.signer, &types.SetCodeTx{
+		ChainID:   chainID,
+		GasTipCap: uint256.NewInt(1),
+		GasFeeCap: uint256.NewInt(1),
+		Value:     uint256.NewInt(0),
+		AuthList:  []types.SetCodeAuthorization{sign(delegate), sign(unauthorizedAddr), {ChainID: *chainID, Address: unauthorizedAddr}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, monitor.processTx(block, tx, nil))
+	require.Equal(t, float64(1), getCounterValue(t, monitor.metrics.violations, watchedAddress.Hex(), string(DelegationLimit)))
+
+	// A transaction whose sender can't be recovered is skipped instead of being retried forever.
+	invalid := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1), To: &allowedAddress})
+	require.NoError(t, monitor.processTx(block, invalid, nil))
+	require.Equal(t, float64(1), testutil.ToFloat64(monitor.metrics.senderErrors))
+}
+
+func TestInboundTransactions(t *testing.T) {
+	proxyAdmin := common.HexToAddress("0x543bA4AADBAb8f9025686Bd03993043599c6fB04")
+	upgrade := "upgrade(address,address)"
+	monitor := newTestMonitor(t,
+		WatchConfig{Address: proxyAdmin, Direction: InboundDirection, Filters: []CheckConfig{
+			// The owner can only upgrade.
+			{All: []CheckConfig{
+				{Type: ExactMatchCheck, Params: map[string]interface{}{"match": watchedAddress.Hex()}},
+				{Type: SelectorCheck, Params: map[string]interface{}{"signature": upgrade}},
+			}},
+		}},
+	)
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	send := func(key *ecdsa.PrivateKey, to common.Address, data []byte) {
+		tx, err := types.SignNewTx(key, monitor.signer, &types.DynamicFeeTx{ChainID: monitor.chainID, To: &to, Data: data})
+		require.NoError(t, err)
+		require.NoError(t, monitor.processTx(block, tx, nil))
+	}
+	upgradeCall := append(crypto.Keccak256([]byte(upgrade))[:4], make([]byte, 64)...)
+
+	send(watchedKey, proxyAdmin, upgradeCall)
+	require.Equal(t, float64(1), getCounterValue(t, monitor.metrics.inboundTx, proxyAdmin.Hex()))
+	require.Equal(t, float64(0), getCounterValue(t, monitor.metrics.unauthorizedInbound, proxyAdmin.Hex()))
+
+	// Any other sender, or another function, is flagged. The receipt isn't needed: the call is flagged even if it reverts.
+	send(otherKey, proxyAdmin, upgradeCall)
+	send(watchedKey, proxyAdmin, crypto.Keccak256([]byte("transferOwnership(address)"))[:4])
+	require.Equal(t, float64(3), getCounterValue(t, monitor.metrics.inboundTx, proxyAdmin.Hex()))
+	require.Equal(t, float64(2), getCounterValue(t, monitor.metrics.unauthorizedInbound, proxyAdmin.Hex()))
+
+	// The transactions to the other addresses aren't counted, the senders aren't watched outbound.
+	send(otherKey, allowedAddress, nil)
+	require.Equal(t, float64(3), getCounterValue(t, monitor.metrics.inboundTx, proxyAdmin.Hex()))
+	require.Equal(t, float64(0), getCounterValue(t, monitor.metrics.transactions, watchedAddress.Hex()))
+}
+
+const blockTrace = `[{
+	"txHash": "0x1111111111111111111111111111111111111111111111111111111111111111",
+	"result": {
+		"type": "CALL", "from": "0x0000000000000000000000000000000000000001", "to": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", "value": "0x0", "input": "0x",
+		"calls": [
+			{"type": "CALL", "from": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", "to": "0x70997970c51812dc3a010c7d01b50e0d17dc79c8", "value": "0xde0b6b3a7640000", "input": "0x"},
+			{"type": "CALL", "from": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", "to": "0x3c44cdddb6a900fa2b585dd299e03d12fa4293bc", "value": "0x6f05b59d3b20000", "input": "0x",
+				"calls": [{"type": "CALL", "from": "0x3c44cdddb6a900fa2b585dd299e03d12fa4293bc", "to": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", "value": "0x1", "input": "0x"}]},
+			{"type": "CALL", "from": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", "to": "0x3c44cdddb6a900fa2b585dd299e03d12fa4293bc", "value": "0x1", "input": "0x", "error": "execution reverted"},
+			{"type": "DELEGATECALL", "from": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", "to": "0x3c44cdddb6a900fa2b585dd299e03d12fa4293bc", "value": "0x1", "input": "0x"},
+			{"type": "STATICCALL", "from": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", "to": "0x3c44cdddb6a900fa2b585dd299e03d12fa4293bc", "input": "0x"}
+		]
+	}
+}]`
+
+// debugService serves debug_traceBlockByHash
+type debugService struct {
+	traces []txTrace
+}
+
+func (s *debugService) TraceBlockByHash(hash common.Hash, config map[string]interface{}) []txTrace {
+	return s.traces
+}
+
+func TestInternalCalls(t *testing.T) {
+	var traces []txTrace
+	require.NoError(t, json.Unmarshal([]byte(blockTrace), &traces))
+
+	var calls []InternalCall
+	collectInternalCalls(traces[0].TxHash, traces[0].Result, &calls)
+	require.Len(t, calls, 3, "the root, reverted, delegate and static calls are skipped")
+	require.Equal(t, watchedAddress, calls[0].From)
+	require.Equal(t, big.NewInt(params.Ether), calls[0].Value)
+	require.Equal(t, unauthorizedAddr, calls[2].From, "the nested calls are collected")
+
+	monitor := newTestMonitor(t, WatchConfig{
+		Address: watchedAddress,
+		Filters: []CheckConfig{{Type: ExactMatchCheck, Params: map[string]interface{}{"match": allowedAddress.Hex()}}},
+		Limits:  []LimitConfig{{Type: MaxValueLimit, Params: map[string]interface{}{"max": "0.4ether"}}},
+	})
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("debug", &debugService{traces: traces}))
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	defer client.Close()
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	require.NoError(t, monitor.processBlockTrace(block, client))
+	require.Equal(t, float64(2), getCounterValue(t, monitor.metrics.internalCalls, watchedAddress.Hex()))
+	require.Equal(t, float64(1.5), getCounterValue(t, monitor.metrics.ethSpent, watchedAddress.Hex()))
+	require.Equal(t, float64(1), getCounterValue(t, monitor.metrics.unauthorizedTx, watchedAddress.Hex()))
+	require.Equal(t, float64(2), getCounterValue(t, monitor.metrics.violations, watchedAddress.Hex(), string(MaxValueLimit)))
+}
+
+// nonceService serves eth_getTransactionCount and txpool_contentFrom for the nonce tracking
+type nonceService struct {
+	confirmed, latest, pending uint64
+	queued                     map[string]interface{}
+}
+
+func (s *nonceService) GetTransactionCount(addr common.Address, block string) hexutil.Uint64 {
+	switch block {
+	case "latest":
+		return hexutil.Uint64(s.latest)
+	case "pending":
+		return hexutil.Uint64(s.pending)
+	}
+	return hexutil.Uint64(s.confirmed)
+}
+
+func (s *nonceService) ContentFrom(addr common.Address) txPoolContent {
+	return txPoolContent{Queued: s.queued}
+}
+
+func TestNonceTracking(t *testing.T) {
+	monitor := newTestMonitor(t, WatchConfig{Address: watchedAddress, Nonce: &NonceConfig{StuckBlocks: 2, TxPool: true}})
+	service := &nonceService{confirmed: 5, latest: 5, pending: 5}
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("eth", service))
+	require.NoError(t, server.RegisterName("txpool", service))
+	monitor.client = ethclient.NewClient(rpc.DialInProc(server))
+	defer monitor.client.Close()
+
+	violations := func(reason string) float64 {
+		return getCounterValue(t, monitor.metrics.violations, watchedAddress.Hex(), reason)
+	}
+	process := func(number int64) {
+		monitor.checkNonces(types.NewBlockWithHeader(&types.Header{Number: big.NewInt(number)}))
+	}
+
+	process(1)
+	// A transaction of the watched address is included, another one is pending.
+	monitor.countNonces(types.NewTx(&types.LegacyTx{Nonce: 5}), watchedAddress)
+	service.confirmed, service.latest, service.pending = 6, 6, 7
+	process(2)
+	process(3)
+	require.Equal(t, float64(0), violations(StuckTxViolation))
+	require.Equal(t, float64(1), testutil.ToFloat64(monitor.metrics.pendingBlocks.WithLabelValues(watchedAddress.Hex())))
+	process(4)
+	process(5)
+	require.Equal(t, float64(1), violations(StuckTxViolation), "a stuck transaction is reported once")
+	require.Equal(t, float64(0), violations(NonceJumpViolation))
+
+	// The nonce increases without any transaction seen, and a transaction is queued above a missing nonce.
+	service.confirmed, service.latest, service.pending = 8, 8, 8
+	service.queued = map[string]interface{}{"10": nil, "12": nil}
+	process(6)
+	require.Equal(t, float64(1), violations(NonceJumpViolation))
+	require.Equal(t, float64(1), violations(NonceGapViolation))
+	require.Equal(t, float64(2), testutil.ToFloat64(monitor.metrics.nonceGap.WithLabelValues(watchedAddress.Hex())))
+	require.Equal(t, float64(0), testutil.ToFloat64(monitor.metrics.pendingBlocks.WithLabelValues(watchedAddress.Hex())))
+	process(7)
+	require.Equal(t, float64(1), violations(NonceGapViolation), "a gap is reported once")
+}
+
+// proofService serves eth_getProof for the codehash check
+type proofService struct {
+	codeHashes map[common.Address]common.Hash
+	slots      map[common.Address]common.Address
+	calls      int
+}
+
+type testStorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+type testAccountResult struct {
+	Address      common.Address      `json:"address"`
+	AccountProof []string            `json:"accountProof"`
+	Balance      *hexutil.Big        `json:"balance"`
+	CodeHash     common.Hash         `json:"codeHash"`
+	Nonce        hexutil.Uint64      `json:"nonce"`
+	StorageHash  common.Hash         `json:"storageHash"`
+	StorageProof []testStorageResult `json:"storageProof"`
+}
+
+func (s *proofService) GetProof(addr common.Address, keys []string, block string) testAccountResult {
+	s.calls++
+	result := testAccountResult{Address: addr, Balance: new(hexutil.Big), CodeHash: types.EmptyCodeHash}
+	if hash, ok := s.codeHashes[addr]; ok {
+		result.CodeHash = hash
+	}
+	for _, key := range keys {
+		value := new(big.Int).SetBytes(s.slots[addr].Bytes())
+		result.StorageProof = append(result.StorageProof, testStorageResult{Key: key, Value: (*hexutil.Big)(value)})
+	}
+	return result
+}
+
+func TestCheckCodeHash(t *testing.T) {
+	ctx := context.Background()
+	proxyCode, implementationCode := common.HexToHash("0x01"), common.HexToHash("0x02")
+	proxy, implementation := common.HexToAddress("0x1001"), common.HexToAddress("0x1002")
+	service := &proofService{
+		codeHashes: map[common.Address]common.Hash{proxy: proxyCode, implementation: implementationCode, allowedAddress: implementationCode},
+		slots:      map[common.Address]common.Address{proxy: implementation},
+	}
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("eth", service))
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	defer client.Close()
+
+	for name, c := range map[string]struct {
+		addr     common.Address
+		params   map[string]interface{}
+		expected bool
+	}{
+		"allowed code":                {allowedAddress, map[string]interface{}{"codehashes": []interface{}{implementationCode.Hex()}}, true},
+		"other code":                  {allowedAddress, map[string]interface{}{"codehashes": proxyCode.Hex()}, false},
+		"no code":                     {unauthorizedAddr, map[string]interface{}{"codehashes": types.EmptyCodeHash.Hex()}, false},
+		"allowed implementation":      {proxy, map[string]interface{}{"implementations": implementation.Hex()}, true},
+		"allowed implementation code": {proxy, map[string]interface{}{"implementation_codehashes": implementationCode.Hex()}, true},
+		"other implementation":        {proxy, map[string]interface{}{"implementations": allowedAddress.Hex()}, false},
+		"not a proxy":                 {allowedAddress, map[string]interface{}{"implementation_codehashes": implementationCode.Hex()}, false},
+	} {
+		require.NoError(t, ValidateCheckCodeHash(c.params), name)
+		ok, err := CheckCodeHash(ctx, client, c.addr, c.params)
+		require.NoError(t, err, name)
+		require.Equal(t, c.expected, ok, name)
+	}
+
+	// The monitor reads the code once per block, and the implementation again only when the proxy is upgraded.
+	check := CheckConfig{Type: CodeHashCheck, Params: map[string]interface{}{"implementations": implementation.Hex()}}
+	require.NoError(t, check.compile())
+	codes := newCodeCache()
+	evaluate := func(block int64, expected bool, calls int) {
+		ok, err := check.evaluate(ctx, client, codes, big.NewInt(block), nil, proxy)
+		require.NoError(t, err)
+		require.Equal(t, expected, ok, "block %d", block)
+		require.Equal(t, calls, service.calls, "block %d", block)
+	}
+	service.calls = 0
+	evaluate(1, true, 2)
+	evaluate(1, true, 2)
+	evaluate(2, true, 3)
+	service.slots[proxy] = allowedAddress
+	evaluate(2, true, 3)
+	evaluate(3, false, 5)
+	require.Len(t, codes.entries, 1, "the entries of the previous blocks are cleared")
+
+	// The latest block reads are reused too, until another block starts.
+	latest := func(expected bool, calls int) {
+		ok, err := check.evaluate(ctx, client, codes, nil, nil, proxy)
+		require.NoError(t, err)
+		require.Equal(t, expected, ok)
+		require.Equal(t, calls, service.calls)
+	}
+	latest(false, 6)
+	latest(false, 6)
+	evaluate(4, false, 7)
+	require.Len(t, codes.entries, 1)
+
+	require.Error(t, ValidateCheckCodeHash(map[string]interface{}{}))
+	require.Error(t, ValidateCheckCodeHash(map[string]interface{}{"codehashes": "0x01"}))
+	require.Error(t, ValidateCheckCodeHash(map[string]interface{}{"implementations": []interface{}{"0x1234"}}))
+}
+
 func getCounterValue(t *testing.T, counter *prometheus.CounterVec, labelValues ...string) float64 {
 	m, err := counter.GetMetricWithLabelValues(labelValues...)
 	require.NoError(t, err)
@@ -0,0 +1,171 @@
+package transaction_monitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// NonceGapViolation is reported when the txpool holds transactions of the address above a missing nonce
+	NonceGapViolation = "nonce_gap"
+	// StuckTxViolation is reported when a pending transaction of the address isn't included for `stuck_blocks` blocks
+	StuckTxViolation = "stuck_transaction"
+	// NonceJumpViolation is reported when the nonce of the address increases more than its transactions seen by the monitor
+	NonceJumpViolation = "nonce_jump"
+
+	// defaultStuckBlocks is the default number of blocks after which a pending transaction is stuck
+	defaultStuckBlocks = 10
+)
+
+// NonceConfig enables the tracking of the nonce of a watched EOA
+type NonceConfig struct {
+	StuckBlocks uint64 `yaml:"stuck_blocks"` // the number of blocks after which a pending transaction is stuck (10 by default)
+	TxPool      bool   `yaml:"txpool"`       // read txpool_contentFrom to detect the nonce gaps
+}
+
+// nonceState is the nonce of a watched address as of the last block checked
+type nonceState struct {
+	initialized  bool
+	confirmed    uint64 // the nonce at the last block checked
+	seen         uint64 // the nonces used by the transactions and authorizations of the address seen since the last block checked
+	latest       uint64 // the nonce at the head of the chain
+	pendingSince uint64 // the block since which a transaction of the address is pending, 0 if none
+	stuck        bool
+	gap          bool
+}
+
+// txPoolContent is the content of the txpool for an address, by nonce
+type txPoolContent struct {
+	Pending map[string]interface{} `json:"pending"`
+	Queued  map[string]interface{} `json:"queued"`
+}
+
+// nonceState returns the nonce state of an address, nil if its nonce isn't tracked
+func (m *Monitor) nonceState(addr common.Address) *nonceState {
+	config, ok := m.watchConfigs[addr]
+	if !ok || config.Nonce == nil {
+		return nil
+	}
+	state, ok := m.nonces[addr]
+	if !ok {
+		state = &nonceState{}
+		m.nonces[addr] = state
+	}
+	return state
+}
+
+// countNonces counts the nonces used by the transaction: its sender's and the ones of the authorities of its EIP-7702 authorizations
+func (m *Monitor) countNonces(tx *types.Transaction, from common.Address) {
+	if state := m.nonceState(from); state != nil && !tx.IsDepositTx() {
+		state.seen++
+	}
+	for _, auth := range tx.SetCodeAuthorizations() {
+		authority, err := auth.Authority()
+		if err != nil {
+			continue
+		}
+		if state := m.nonceState(authority); state != nil {
+			state.seen++
+		}
+	}
+}
+
+// checkNonces is called once a block is processed, it checks the nonces of the watched addresses against their transactions and the pending ones.
+// The errors are only logged, the addresses are checked again with the next block.
+func (m *Monitor) checkNonces(block *types.Block) {
+	ctx := context.Background()
+	for addr, config := range m.watchConfigs {
+		if config.Nonce == nil {
+			continue
+		}
+		if err := m.checkNonce(ctx, block, addr, config.Nonce, m.nonceState(addr)); err != nil {
+			m.log.Warn("failed to check nonce", "address", addr, "block", block.Number(), "err", err)
+		}
+	}
+}
+
+// checkNonce checks the nonce of an address at the block
+func (m *Monitor) checkNonce(ctx context.Context, block *types.Block, addr common.Address, config *NonceConfig, state *nonceState) error {
+	confirmed, err := m.client.NonceAt(ctx, addr, block.Number())
+	if err != nil {
+		return fmt.Errorf("failed to get nonce: %w", err)
+	}
+	latest, err := m.client.NonceAt(ctx, addr, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get latest nonce: %w", err)
+	}
+	pending, err := m.client.PendingNonceAt(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("failed to get pending nonce: %w", err)
+	}
+	var content txPoolContent
+	if config.TxPool {
+		if err := m.client.Client().CallContext(ctx, &content, "txpool_contentFrom", addr); err != nil {
+			return fmt.Errorf("failed to get txpool content: %w", err)
+		}
+	}
+
+	m.metrics.confirmedNonce.WithLabelValues(addr.String()).Set(float64(confirmed))
+	m.metrics.pendingNonce.WithLabelValues(addr.String()).Set(float64(pending))
+
+	// Nonce jump: the nonce increased more than the transactions seen.
+	if state.initialized && confirmed > state.confirmed+state.seen {
+		m.log.Warn("unexpected nonce jump, the key may be used elsewhere", "address", addr, "block", block.Number(), "previous", state.confirmed, "nonce", confirmed, "seen", state.seen)
+		m.metrics.violations.WithLabelValues(addr.String(), NonceJumpViolation).Inc()
+	}
+	state.initialized, state.confirmed, state.seen = true, confirmed, 0
+
+	// Stuck transaction: the pending nonce stays above the latest one for `stuck_blocks` blocks.
+	stuckBlocks := config.StuckBlocks
+	if stuckBlocks == 0 {
+		stuckBlocks = defaultStuckBlocks
+	}
+	switch {
+	case pending <= latest:
+		state.pendingSince, state.stuck = 0, false
+	case state.pendingSince == 0 || latest > state.latest: // a new transaction is pending, or the oldest one was included.
+		state.pendingSince, state.stuck = block.NumberU64(), false
+	}
+	state.latest = latest
+	var pendingBlocks uint64
+	if state.pendingSince > 0 {
+		pendingBlocks = block.NumberU64() - state.pendingSince
+	}
+	m.metrics.pendingBlocks.WithLabelValues(addr.String()).Set(float64(pendingBlocks))
+	if pendingBlocks >= stuckBlocks && !state.stuck {
+		state.stuck = true
+		m.log.Warn("transaction stuck", "address", addr, "block", block.Number(), "nonce", latest, "pending", pending, "blocks", pendingBlocks)
+		m.metrics.violations.WithLabelValues(addr.String(), StuckTxViolation).Inc()
+	}
+
+	// Nonce gap: the txpool holds transactions above the next nonce.
+	if config.TxPool {
+		gap := nonceGap(content, pending)
+		m.metrics.nonceGap.WithLabelValues(addr.String()).Set(float64(gap))
+		if gap > 0 && !state.gap {
+			m.log.Warn("nonce gap", "address", addr, "block", block.Number(), "pending", pending, "gap", gap)
+			m.metrics.violations.WithLabelValues(addr.String(), NonceGapViolation).Inc()
+		}
+		state.gap = gap > 0
+	}
+	return nil
+}
+
+// nonceGap returns the number of missing nonces between the next nonce and the lowest queued transaction, 0 if there is no gap
+func nonceGap(content txPoolContent, next uint64) uint64 {
+	var gap uint64
+	for key := range content.Queued {
+		nonce, err := strconv.ParseUint(key, 10, 64)
+		if err != nil || nonce <= next {
+			continue
+		}
+		if gap == 0 || nonce-next < gap {
+			gap = nonce - next
+		}
+	}
+	return gap
+}
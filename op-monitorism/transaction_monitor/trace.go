@@ -0,0 +1,121 @@
+package transaction_monitor
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// traceTimeout is the timeout of the debug_traceBlockByHash request
+const traceTimeout = 60 * time.Second
+
+// callFrame is a call of the callTracer
+type callFrame struct {
+	Type  string         `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+	Input hexutil.Bytes  `json:"input"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+// txTrace is the trace of a transaction returned by debug_traceBlockByHash
+type txTrace struct {
+	TxHash common.Hash `json:"txHash"`
+	Result callFrame   `json:"result"`
+}
+
+// InternalCall is a value transfer made by a contract (an internal CALL or CREATE) during a transaction
+type InternalCall struct {
+	TxHash common.Hash // the transaction the transfer is attributed to
+	From   common.Address
+	To     common.Address
+	Value  *big.Int
+	Input  []byte
+}
+
+// collectInternalCalls appends the internal calls moving value in the sub-calls of a frame. The reverted calls (and their sub-calls) didn't move any value and are skipped.
+func collectInternalCalls(txHash common.Hash, frame callFrame, calls *[]InternalCall) {
+	for _, sub := range frame.Calls {
+		if sub.Error != "" {
+			continue
+		}
+		switch sub.Type {
+		case "CALL", "CREATE", "CREATE2":
+			if sub.Value != nil && sub.Value.ToInt().Sign() > 0 {
+				*calls = append(*calls, InternalCall{TxHash: txHash, From: sub.From, To: sub.To, Value: sub.Value.ToInt(), Input: sub.Input})
+			}
+		}
+		collectInternalCalls(txHash, sub, calls)
+	}
+}
+
+// traceInternalCalls returns the internal calls moving value of all the transactions of the block
+func traceInternalCalls(ctx context.Context, client *ethclient.Client, block *types.Block) ([]InternalCall, error) {
+	ctx, cancel := context.WithTimeout(ctx, traceTimeout)
+	defer cancel()
+
+	var traces []txTrace
+	if err := client.Client().CallContext(ctx, &traces, "debug_traceBlockByHash", block.Hash(), map[string]string{"tracer": "callTracer"}); err != nil {
+		return nil, fmt.Errorf("failed to trace block: %w", err)
+	}
+	var calls []InternalCall
+	for _, trace := range traces {
+		if trace.Result.Error != "" {
+			continue
+		}
+		collectInternalCalls(trace.TxHash, trace.Result, &calls)
+	}
+	return calls, nil
+}
+
+// internalCallResult is an internal call from a watched address with the result of its checks
+type internalCallResult struct {
+	call    InternalCall
+	allowed bool
+}
+
+// processBlockTrace applies the filters and the limits of the watched addresses to the value they move through internal calls.
+// The filters see an internal call as a transaction from the watched address with its value and its input.
+func (m *Monitor) processBlockTrace(block *types.Block, client *ethclient.Client) error {
+	ctx := context.Background()
+	calls, err := traceInternalCalls(ctx, client, block)
+	if err != nil {
+		return err
+	}
+
+	// All the checks are run before updating the metrics, so a retry doesn't count a call twice.
+	var results []internalCallResult
+	for _, call := range calls {
+		if _, exists := m.watchConfigs[call.From]; !exists {
+			continue
+		}
+		to := call.To
+		tx := types.NewTx(&types.LegacyTx{To: &to, Value: call.Value, Data: call.Input})
+		allowed, err := m.isTxAllowed(ctx, block, call.From, tx, call.To)
+		if err != nil {
+			return fmt.Errorf("error checking internal call: %w", err)
+		}
+		results = append(results, internalCallResult{call: call, allowed: allowed})
+	}
+
+	for _, result := range results {
+		call := result.call
+		m.metrics.internalCalls.WithLabelValues(call.From.String()).Inc()
+		m.metrics.ethSpent.WithLabelValues(call.From.String()).Add(weiToEther(call.Value))
+		if !result.allowed {
+			m.log.Warn("unauthorized internal call", "from", call.From, "to", call.To, "value", call.Value, "tx", call.TxHash, "block", block.Number())
+			m.metrics.unauthorizedTx.WithLabelValues(call.From.String()).Inc()
+		}
+		// Only the value limits apply, the fees are paid by the sender of the transaction.
+		m.checkLimits(block, call.TxHash, call.From, m.limits[call.From], TxCost{Value: call.Value})
+	}
+	return nil
+}